@@ -1,11 +1,33 @@
 package chef
 
 import (
+	"database/sql"
+	"fmt"
 	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/rjxby/eat-repeat/backend/pantry"
 	"github.com/rjxby/eat-repeat/backend/store"
 )
 
+// Error messages
+var (
+	ErrServingCooked     = fmt.Errorf("serving is already cooked: %w", store.ErrConflict)
+	ErrServingNotPlanned = fmt.Errorf("serving is not planned for any day: %w", store.ErrConflict)
+	ErrServingNotCooked  = fmt.Errorf("serving is not cooked: %w", store.ErrConflict)
+	ErrMealSlotTaken     = fmt.Errorf("meal slot is taken: %w", store.ErrConflict)
+	ErrInvalidRating     = fmt.Errorf("rating should be from %d to %d: %w", minRating, maxRating, store.ErrInvalid)
+)
+
+const (
+	minRating = 1
+	maxRating = 5
+	// maxNotesLength is the size of the serving notes column
+	maxNotesLength = 4000
+)
+
 // RecipeProc creates and save recipes
 type RecipeProc struct {
 	engine Engine
@@ -20,14 +42,35 @@ func New(engine Engine) *RecipeProc {
 
 // Engine defines interface to save and load recipes
 type Engine interface {
-	LoadRecipes(page int, pageSize int, searchTerm string) (result *store.Recipes, err error)
+	LoadRecipes(page int, pageSize int, filter store.RecipeFilter) (result *store.Recipes, err error)
+	GetRecipe(id uint) (result *store.RecipeV1, err error)
+	CreateRecipe(recipe *store.RecipeV1) (err error)
+	UpdateRecipe(recipe *store.RecipeV1) (err error)
+	DeleteRecipe(id uint) (err error)
+	UpdateRecipeFiles(recipe *store.RecipeV1) (err error)
+	SaveRecipeNutrition(nutrition *store.RecipeNutritionV1) (err error)
+	ReplaceRecipeSteps(recipeID uint, steps []store.RecipeStepV1) (err error)
+	LoadRecipeDifficulties() (result *[]store.RecipeDifficultyV1, err error)
+	GetRecipeDifficulty(id uint) (result *store.RecipeDifficultyV1, err error)
+	CheckSearchIndex() (status *store.SearchIndexStatus, err error)
+	RebuildSearchIndex() (err error)
+	GetIngredients() (result *store.Ingredients, err error)
 	LoadServings() (result *[]store.ServingV1, err error)
 	SaveServing(serving *store.ServingV1) (err error)
 	GetServing(id uint) (result *store.ServingV1, err error)
+	LoadPlannedServings(from time.Time, to time.Time) (result *[]store.ServingV1, err error)
+	LoadUnplannedServings() (result *[]store.ServingV1, err error)
+	LoadMealSlots() (result *[]store.MealSlotV1, err error)
+	GetMealSlot(id uint) (result *store.MealSlotV1, err error)
+	CookServing(id uint, cookedAt time.Time, deductions []store.PantryDeductionV1) (err error)
+	UncookServing(id uint) (err error)
+	RateServing(id uint, rating uint, notes string) (err error)
+	CookRatedServing(id uint, cookedAt time.Time, deductions []store.PantryDeductionV1, rating uint, notes string) (err error)
+	GetUnits() (result *[]store.UnitV1, err error)
 }
 
-func (p RecipeProc) GetRecipes(page int, pageSize int, searchTerm string) (recipes *store.Recipes, err error) {
-	recipes, err = p.engine.LoadRecipes(page, pageSize, searchTerm)
+func (p RecipeProc) GetRecipes(page int, pageSize int, filter store.RecipeFilter) (recipes *store.Recipes, err error) {
+	recipes, err = p.engine.LoadRecipes(page, pageSize, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -44,6 +87,29 @@ func (p RecipeProc) GetServings() (servings *[]store.ServingV1, err error) {
 	return servings, nil
 }
 
+// CreateServing selects a recipe to cook for the number of portions, zero portions means the recipe portions
+func (p RecipeProc) CreateServing(recipeID uint, portions uint) (serving *store.ServingV1, err error) {
+	recipe, err := p.engine.GetRecipe(recipeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if portions == 0 {
+		portions = recipe.Portions
+	}
+
+	serving = &store.ServingV1{
+		RecipeID: recipe.ID,
+		Portions: portions,
+	}
+
+	if err := p.SaveServing(serving); err != nil {
+		return nil, err
+	}
+
+	return serving, nil
+}
+
 func (p RecipeProc) SaveServing(serving *store.ServingV1) (err error) {
 	err = p.engine.SaveServing(serving)
 	if err != nil {
@@ -61,7 +127,330 @@ func (p RecipeProc) GetServing(id uint) (serving *store.ServingV1, err error) {
 		return nil, err
 	}
 
+	serving.ScaledIngredients = pantry.ScaleServing(*serving)
+
 	log.Printf("[INFO] serving is loaded: %v", serving)
 
 	return serving, nil
 }
+
+// GetBacklog returns selected servings which are not planned for any day yet
+func (p RecipeProc) GetBacklog() (servings *[]store.ServingV1, err error) {
+	servings, err = p.engine.LoadUnplannedServings()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range *servings {
+		(*servings)[i].ScaledIngredients = pantry.ScaleServing((*servings)[i])
+	}
+
+	return servings, nil
+}
+
+// PlanWeek places servings planned for the week into the (day, meal slot) cells of the week grid
+func (p RecipeProc) PlanWeek(week *store.Week) (result *store.Week, err error) {
+	if len(week.Days) == 0 {
+		return week, nil
+	}
+
+	mealSlots, err := p.engine.LoadMealSlots()
+	if err != nil {
+		return nil, err
+	}
+
+	from := week.Days[0].Date
+	to := week.Days[len(week.Days)-1].Date
+
+	servings, err := p.engine.LoadPlannedServings(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	week.MealSlots = *mealSlots
+
+	for i := range *servings {
+		(*servings)[i].ScaledIngredients = pantry.ScaleServing((*servings)[i])
+	}
+
+	for i := range week.Days {
+		day := &week.Days[i]
+
+		day.Meals = make([]store.Meal, len(week.MealSlots))
+		for j, mealSlot := range week.MealSlots {
+			day.Meals[j].MealSlot = mealSlot
+		}
+		day.Unslotted = nil
+
+		for _, serving := range *servings {
+			if !isSameDay(serving.PlannedFor.Time, day.Date) {
+				continue
+			}
+
+			slotted := false
+			if serving.MealSlotID != nil {
+				for j := range day.Meals {
+					if day.Meals[j].MealSlot.ID == *serving.MealSlotID {
+						day.Meals[j].Servings = append(day.Meals[j].Servings, serving)
+						slotted = true
+						break
+					}
+				}
+			}
+
+			if !slotted {
+				day.Unslotted = append(day.Unslotted, serving)
+			}
+		}
+	}
+
+	return week, nil
+}
+
+// AssignServing plans a serving for the day and a meal slot, zero mealSlotID plans it without a slot
+func (p RecipeProc) AssignServing(id uint, day time.Time, mealSlotID uint) (err error) {
+	serving, err := p.engine.GetServing(id)
+	if err != nil {
+		return err
+	}
+
+	if serving.CookedAt.Valid {
+		return ErrServingCooked
+	}
+
+	serving.PlannedFor = sql.NullTime{Time: day, Valid: true}
+	serving.MealSlotID = nil
+	serving.MealSlot = nil
+
+	if mealSlotID != 0 {
+		mealSlot, err := p.engine.GetMealSlot(mealSlotID)
+		if err != nil {
+			return err
+		}
+		serving.MealSlotID = &mealSlot.ID
+	}
+
+	if err := p.checkMealSlotFree(serving); err != nil {
+		return err
+	}
+
+	if err := p.SaveServing(serving); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] serving %d is assigned to %s (meal slot %d)", id, day.Format(time.DateOnly), mealSlotID)
+
+	return nil
+}
+
+// MoveServing moves an already planned serving to another day keeping its meal slot
+func (p RecipeProc) MoveServing(id uint, day time.Time) (err error) {
+	serving, err := p.engine.GetServing(id)
+	if err != nil {
+		return err
+	}
+
+	if !serving.PlannedFor.Valid {
+		return ErrServingNotPlanned
+	}
+
+	if serving.CookedAt.Valid {
+		return ErrServingCooked
+	}
+
+	serving.PlannedFor = sql.NullTime{Time: day, Valid: true}
+
+	if err := p.checkMealSlotFree(serving); err != nil {
+		return err
+	}
+
+	if err := p.SaveServing(serving); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] serving %d is moved to %s", id, day.Format(time.DateOnly))
+
+	return nil
+}
+
+// UnassignServing returns a serving back to the backlog
+func (p RecipeProc) UnassignServing(id uint) (err error) {
+	serving, err := p.engine.GetServing(id)
+	if err != nil {
+		return err
+	}
+
+	serving.PlannedFor = sql.NullTime{}
+	serving.MealSlotID = nil
+	serving.MealSlot = nil
+
+	if err := p.SaveServing(serving); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] serving %d is unassigned", id)
+
+	return nil
+}
+
+// checkMealSlotFree fails when another serving is planned for the (day, meal slot) cell of the serving,
+// servings planned without a meal slot are not limited
+func (p RecipeProc) checkMealSlotFree(serving *store.ServingV1) (err error) {
+	if serving.MealSlotID == nil {
+		return nil
+	}
+
+	day := serving.PlannedFor.Time
+	planned, err := p.engine.LoadPlannedServings(day, day)
+	if err != nil {
+		return err
+	}
+
+	for _, other := range *planned {
+		if other.ID != serving.ID && other.MealSlotID != nil && *other.MealSlotID == *serving.MealSlotID {
+			return fmt.Errorf("%w: serving %d is planned for %s", ErrMealSlotTaken, other.ID, day.Format(time.DateOnly))
+		}
+	}
+
+	return nil
+}
+
+// CookServing marks a serving cooked and deducts ingredients of its recipe scaled to the serving portions from the pantry
+func (p RecipeProc) CookServing(id uint) (serving *store.ServingV1, err error) {
+	deductions, err := p.cookDeductions(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.engine.CookServing(id, time.Now().UTC(), deductions); err != nil {
+		return nil, err
+	}
+
+	return p.cookedServing(id)
+}
+
+// cookDeductions are the pantry deductions of cooking a serving, the serving must not be cooked yet
+func (p RecipeProc) cookDeductions(id uint) (deductions []store.PantryDeductionV1, err error) {
+	serving, err := p.GetServing(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if serving.CookedAt.Valid {
+		return nil, ErrServingCooked
+	}
+
+	units, err := p.engine.GetUnits()
+	if err != nil {
+		return nil, err
+	}
+	catalogue := pantry.NewCatalogue(*units)
+
+	// pantry stock is kept in the ingredient unit
+	deductions = []store.PantryDeductionV1{}
+	for _, line := range catalogue.LineAmounts(serving.ScaledIngredients) {
+		deductions = append(deductions, store.PantryDeductionV1{
+			IngredientV1ID: line.IngredientV1ID,
+			Amount:         line.Amount,
+		})
+	}
+
+	return deductions, nil
+}
+
+// cookedServing loads the cooked serving and logs the ingredients the pantry was short of
+func (p RecipeProc) cookedServing(id uint) (serving *store.ServingV1, err error) {
+	serving, err = p.GetServing(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, deduction := range serving.Deductions {
+		if deduction.Shortage > 0 {
+			log.Printf("[WARN] serving %d is short of %v %s %s in the pantry", id, deduction.Shortage, deduction.Ingredient.Unit.Name, deduction.Ingredient.Name)
+		}
+	}
+
+	log.Printf("[INFO] serving %d is cooked", id)
+
+	return serving, nil
+}
+
+// UncookServing undoes cooking of a serving returning the deducted ingredients to the pantry
+func (p RecipeProc) UncookServing(id uint) (err error) {
+	if err := p.engine.UncookServing(id); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] serving %d cooking is undone", id)
+
+	return nil
+}
+
+// RateServing rates a cooked serving from 1 to 5 with optional notes, the recipe rating is the average of its servings
+func (p RecipeProc) RateServing(id uint, rating uint, notes string) (serving *store.ServingV1, err error) {
+	notes, err = ratingNotes(rating, notes)
+	if err != nil {
+		return nil, err
+	}
+
+	serving, err = p.GetServing(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !serving.CookedAt.Valid {
+		return nil, ErrServingNotCooked
+	}
+
+	if err := p.engine.RateServing(id, rating, notes); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] serving %d is rated %d", id, rating)
+
+	return p.GetServing(id)
+}
+
+// CookRatedServing cooks a serving and rates it in one store transaction, so a failed rating doesn't leave
+// the serving cooked with the stock deducted
+func (p RecipeProc) CookRatedServing(id uint, rating uint, notes string) (serving *store.ServingV1, err error) {
+	notes, err = ratingNotes(rating, notes)
+	if err != nil {
+		return nil, err
+	}
+
+	deductions, err := p.cookDeductions(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.engine.CookRatedServing(id, time.Now().UTC(), deductions, rating, notes); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] serving %d is rated %d", id, rating)
+
+	return p.cookedServing(id)
+}
+
+// ratingNotes checks the rating and its notes, it returns the notes trimmed
+func ratingNotes(rating uint, notes string) (string, error) {
+	if rating < minRating || rating > maxRating {
+		return "", ErrInvalidRating
+	}
+
+	notes = strings.TrimSpace(notes)
+	if utf8.RuneCountInString(notes) > maxNotesLength {
+		return "", fmt.Errorf("notes are longer than %d characters: %w", maxNotesLength, store.ErrInvalid)
+	}
+
+	return notes, nil
+}
+
+func isSameDay(first time.Time, second time.Time) bool {
+	firstYear, firstMonth, firstDay := first.UTC().Date()
+	secondYear, secondMonth, secondDay := second.UTC().Date()
+
+	return firstYear == secondYear && firstMonth == secondMonth && firstDay == secondDay
+}
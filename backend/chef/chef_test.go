@@ -0,0 +1,410 @@
+package chef
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// servingsEngine keeps servings and meal slots in memory to plan and rate them
+type servingsEngine struct {
+	Engine
+
+	servings  map[uint]store.ServingV1
+	mealSlots []store.MealSlotV1
+	// rateErr fails rating of a serving
+	rateErr error
+}
+
+func (e *servingsEngine) SaveServing(serving *store.ServingV1) error {
+	e.servings[serving.ID] = *serving
+	return nil
+}
+
+func (e *servingsEngine) LoadPlannedServings(from time.Time, to time.Time) (*[]store.ServingV1, error) {
+	servings := []store.ServingV1{}
+	for _, serving := range e.servings {
+		if serving.PlannedFor.Valid && !serving.PlannedFor.Time.Before(from) && !serving.PlannedFor.Time.After(to) {
+			servings = append(servings, serving)
+		}
+	}
+	sort.Slice(servings, func(i, j int) bool { return servings[i].ID < servings[j].ID })
+	return &servings, nil
+}
+
+func (e *servingsEngine) LoadMealSlots() (*[]store.MealSlotV1, error) {
+	return &e.mealSlots, nil
+}
+
+func (e *servingsEngine) GetMealSlot(id uint) (*store.MealSlotV1, error) {
+	for _, mealSlot := range e.mealSlots {
+		if mealSlot.ID == id {
+			return &mealSlot, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (e *servingsEngine) GetServing(id uint) (*store.ServingV1, error) {
+	serving, ok := e.servings[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &serving, nil
+}
+
+func (e *servingsEngine) RateServing(id uint, rating uint, notes string) error {
+	serving := e.servings[id]
+	serving.Rating = rating
+	serving.Notes = notes
+	e.servings[id] = serving
+	return nil
+}
+
+func (e *servingsEngine) CookServing(id uint, cookedAt time.Time, deductions []store.PantryDeductionV1) error {
+	serving := e.servings[id]
+	serving.CookedAt = sql.NullTime{Time: cookedAt, Valid: true}
+	e.servings[id] = serving
+	return nil
+}
+
+// CookRatedServing keeps the serving as it was when the rating fails, like the store transaction does
+func (e *servingsEngine) CookRatedServing(id uint, cookedAt time.Time, deductions []store.PantryDeductionV1, rating uint, notes string) error {
+	if e.rateErr != nil {
+		return e.rateErr
+	}
+
+	serving := e.servings[id]
+	serving.CookedAt = sql.NullTime{Time: cookedAt, Valid: true}
+	serving.Rating = rating
+	serving.Notes = notes
+	e.servings[id] = serving
+	return nil
+}
+
+func (e *servingsEngine) GetUnits() (*[]store.UnitV1, error) {
+	units := store.DefaultUnits()
+	return &units, nil
+}
+
+// planDay is the day of the test week, days are from Monday 2024-01-01
+func planDay(day int) time.Time {
+	return time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC)
+}
+
+func planned(day int) sql.NullTime {
+	return sql.NullTime{Time: planDay(day), Valid: true}
+}
+
+func slotID(id uint) *uint {
+	return &id
+}
+
+func TestPlanWeek(t *testing.T) {
+	engine := &servingsEngine{
+		mealSlots: []store.MealSlotV1{{ID: 1, Name: "Breakfast"}, {ID: 2, Name: "Dinner"}},
+		servings: map[uint]store.ServingV1{
+			1: {ID: 1, PlannedFor: planned(1), MealSlotID: slotID(2)},
+			2: {ID: 2, PlannedFor: planned(1)},
+			3: {ID: 3, PlannedFor: planned(3), MealSlotID: slotID(1)},
+			4: {ID: 4, PlannedFor: planned(3), MealSlotID: slotID(2)},
+			// the meal slot is deleted meanwhile, the serving is kept for its day without a slot
+			5: {ID: 5, PlannedFor: planned(2), MealSlotID: slotID(9)},
+			// in the backlog and the next week
+			6: {ID: 6},
+			7: {ID: 7, PlannedFor: planned(8), MealSlotID: slotID(1)},
+		},
+	}
+
+	week := &store.Week{}
+	for day := 1; day <= 7; day++ {
+		week.Days = append(week.Days, store.Day{ID: planDay(day).Format(time.DateOnly), Date: planDay(day)})
+	}
+
+	week, err := New(engine).PlanWeek(week)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(week.MealSlots) != 2 {
+		t.Fatalf("expected 2 meal slots, got %+v", week.MealSlots)
+	}
+
+	cell := func(servings []store.ServingV1) []uint {
+		ids := []uint{}
+		for _, serving := range servings {
+			ids = append(ids, serving.ID)
+		}
+		return ids
+	}
+
+	want := []string{
+		"Breakfast [] Dinner [1] unslotted [2]",
+		"Breakfast [] Dinner [] unslotted [5]",
+		"Breakfast [3] Dinner [4] unslotted []",
+		"Breakfast [] Dinner [] unslotted []",
+		"Breakfast [] Dinner [] unslotted []",
+		"Breakfast [] Dinner [] unslotted []",
+		"Breakfast [] Dinner [] unslotted []",
+	}
+	for i, day := range week.Days {
+		got := ""
+		for _, meal := range day.Meals {
+			got += fmt.Sprintf("%s %v ", meal.MealSlot.Name, cell(meal.Servings))
+		}
+		got += fmt.Sprintf("unslotted %v", cell(day.Unslotted))
+
+		if got != want[i] {
+			t.Errorf("expected day %s planned as %q, got %q", day.ID, want[i], got)
+		}
+	}
+}
+
+func TestAssignServing(t *testing.T) {
+	cookedAt := sql.NullTime{Time: planDay(1), Valid: true}
+
+	tests := []struct {
+		name       string
+		servingID  uint
+		mealSlotID uint
+		wantErr    error
+		wantSlot   *uint
+	}{
+		{name: "backlog serving to meal slot", servingID: 1, mealSlotID: 2, wantSlot: slotID(2)},
+		{name: "backlog serving without meal slot", servingID: 1},
+		{name: "planned serving to other day", servingID: 2, mealSlotID: 2, wantSlot: slotID(2)},
+		{name: "planned serving without meal slot", servingID: 2},
+		{name: "serving of the meal slot again", servingID: 4, mealSlotID: 1, wantSlot: slotID(1)},
+		{name: "taken meal slot", servingID: 1, mealSlotID: 1, wantErr: ErrMealSlotTaken},
+		{name: "cooked serving", servingID: 3, mealSlotID: 1, wantErr: ErrServingCooked},
+		{name: "unknown meal slot", servingID: 1, mealSlotID: 9, wantErr: store.ErrNotFound},
+		{name: "unknown serving", servingID: 9, wantErr: store.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &servingsEngine{
+				mealSlots: []store.MealSlotV1{{ID: 1, Name: "Breakfast"}, {ID: 2, Name: "Dinner"}},
+				servings: map[uint]store.ServingV1{
+					1: {ID: 1},
+					2: {ID: 2, PlannedFor: planned(1), MealSlotID: slotID(2)},
+					3: {ID: 3, PlannedFor: planned(1), CookedAt: cookedAt},
+					4: {ID: 4, PlannedFor: planned(4), MealSlotID: slotID(1)},
+				},
+			}
+
+			err := New(engine).AssignServing(tt.servingID, planDay(4), tt.mealSlotID)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			serving := engine.servings[tt.servingID]
+			if !serving.PlannedFor.Valid || !serving.PlannedFor.Time.Equal(planDay(4)) {
+				t.Fatalf("expected serving planned for %v, got %v", planDay(4), serving.PlannedFor)
+			}
+			if fmt.Sprint(deref(serving.MealSlotID)) != fmt.Sprint(deref(tt.wantSlot)) {
+				t.Fatalf("expected meal slot %v, got %v", deref(tt.wantSlot), deref(serving.MealSlotID))
+			}
+		})
+	}
+}
+
+func TestMoveServing(t *testing.T) {
+	tests := []struct {
+		name      string
+		servingID uint
+		wantErr   error
+		wantSlot  *uint
+	}{
+		{name: "planned to meal slot", servingID: 1, wantSlot: slotID(2)},
+		{name: "planned without meal slot", servingID: 2},
+		{name: "to day of taken meal slot", servingID: 5, wantErr: ErrMealSlotTaken},
+		{name: "not planned", servingID: 3, wantErr: ErrServingNotPlanned},
+		{name: "cooked", servingID: 4, wantErr: ErrServingCooked},
+		{name: "unknown serving", servingID: 9, wantErr: store.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &servingsEngine{
+				mealSlots: []store.MealSlotV1{{ID: 1, Name: "Breakfast"}, {ID: 2, Name: "Dinner"}},
+				servings: map[uint]store.ServingV1{
+					1: {ID: 1, PlannedFor: planned(1), MealSlotID: slotID(2)},
+					2: {ID: 2, PlannedFor: planned(1)},
+					3: {ID: 3},
+					4: {ID: 4, PlannedFor: planned(1), CookedAt: planned(1)},
+					5: {ID: 5, PlannedFor: planned(2), MealSlotID: slotID(1)},
+					6: {ID: 6, PlannedFor: planned(5), MealSlotID: slotID(1)},
+				},
+			}
+
+			err := New(engine).MoveServing(tt.servingID, planDay(5))
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			serving := engine.servings[tt.servingID]
+			if !serving.PlannedFor.Time.Equal(planDay(5)) || fmt.Sprint(deref(serving.MealSlotID)) != fmt.Sprint(deref(tt.wantSlot)) {
+				t.Fatalf("expected serving planned for %v with meal slot %v, got %v with %v",
+					planDay(5), deref(tt.wantSlot), serving.PlannedFor.Time, deref(serving.MealSlotID))
+			}
+		})
+	}
+}
+
+func TestUnassignServing(t *testing.T) {
+	engine := &servingsEngine{servings: map[uint]store.ServingV1{
+		1: {ID: 1, PlannedFor: planned(1), MealSlotID: slotID(2), MealSlot: &store.MealSlotV1{ID: 2, Name: "Dinner"}},
+	}}
+	proc := New(engine)
+
+	if err := proc.UnassignServing(1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if serving := engine.servings[1]; serving.PlannedFor.Valid || serving.MealSlotID != nil || serving.MealSlot != nil {
+		t.Fatalf("expected serving in the backlog, got %+v", serving)
+	}
+
+	if err := proc.UnassignServing(9); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected error %v, got %v", store.ErrNotFound, err)
+	}
+}
+
+// deref is the meal slot id or nil of a serving without meal slot
+func deref(id *uint) any {
+	if id == nil {
+		return nil
+	}
+	return *id
+}
+
+func TestRateServing(t *testing.T) {
+	cookedAt := sql.NullTime{Time: time.Date(2024, 1, 2, 18, 0, 0, 0, time.UTC), Valid: true}
+
+	tests := []struct {
+		name      string
+		servingID uint
+		rating    uint
+		notes     string
+		wantErr   error
+		wantNotes string
+	}{
+		{name: "rated", servingID: 1, rating: 4, notes: " more salt next time ", wantNotes: "more salt next time"},
+		{name: "rated again", servingID: 2, rating: 5},
+		{name: "rating too low", servingID: 1, rating: 0, wantErr: ErrInvalidRating},
+		{name: "rating too high", servingID: 1, rating: 6, wantErr: ErrInvalidRating},
+		{name: "not cooked", servingID: 3, rating: 3, wantErr: ErrServingNotCooked},
+		{name: "unknown serving", servingID: 4, rating: 3, wantErr: store.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &servingsEngine{servings: map[uint]store.ServingV1{
+				1: {ID: 1, CookedAt: cookedAt},
+				2: {ID: 2, CookedAt: cookedAt, Rating: 2, Notes: "too dry"},
+				3: {ID: 3},
+			}}
+			proc := New(engine)
+
+			serving, err := proc.RateServing(tt.servingID, tt.rating, tt.notes)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if serving.Rating != tt.rating || serving.Notes != tt.wantNotes {
+				t.Fatalf("expected rating %d with notes %q, got %d with %q", tt.rating, tt.wantNotes, serving.Rating, serving.Notes)
+			}
+		})
+	}
+}
+
+func TestCookRatedServing(t *testing.T) {
+	tests := []struct {
+		name       string
+		rating     uint
+		notes      string
+		rateErr    error
+		wantErr    error
+		wantCooked bool
+	}{
+		{name: "rated", rating: 5, notes: "crispy", wantCooked: true},
+		{name: "rating too high", rating: 6, wantErr: ErrInvalidRating},
+		{name: "notes too long", rating: 4, notes: strings.Repeat("a", maxNotesLength+1), wantErr: store.ErrInvalid},
+		{name: "rating failed", rating: 4, rateErr: store.ErrNotFound, wantErr: store.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &servingsEngine{servings: map[uint]store.ServingV1{1: {ID: 1}}, rateErr: tt.rateErr}
+			proc := New(engine)
+
+			serving, err := proc.CookRatedServing(1, tt.rating, tt.notes)
+
+			if cooked := engine.servings[1].CookedAt.Valid; cooked != tt.wantCooked {
+				t.Fatalf("expected cooked %t, got %t", tt.wantCooked, cooked)
+			}
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if serving.Rating != tt.rating || serving.Notes != tt.notes {
+				t.Fatalf("expected rating %d with notes %q, got %d with %q", tt.rating, tt.notes, serving.Rating, serving.Notes)
+			}
+		})
+	}
+}
+
+func TestRecipeTags(t *testing.T) {
+	tags, err := recipeTags([]string{" Vegetarian ", "one   pan", "", "vegetarian", "Quick"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"vegetarian", "one pan", "quick"}
+	if len(tags) != len(want) {
+		t.Fatalf("expected tags %v, got %+v", want, tags)
+	}
+	for i, tag := range tags {
+		if tag.Name != want[i] {
+			t.Fatalf("expected tags %v, got %+v", want, tags)
+		}
+	}
+
+	if _, err := recipeTags([]string{strings.Repeat("a", maxTagLength+1)}); !errors.Is(err, store.ErrInvalid) {
+		t.Fatalf("expected invalid tag error, got %v", err)
+	}
+}
@@ -0,0 +1,551 @@
+package chef
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rjxby/eat-repeat/backend/pantry"
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// ErrInvalidImport is a url without a recipe to import
+var ErrInvalidImport = fmt.Errorf("invalid recipe import: %w", store.ErrInvalid)
+
+const (
+	// maxImportPageSize and maxImportImageSize limit downloads of the import
+	maxImportPageSize  = 5 << 20
+	maxImportImageSize = 10 << 20
+	importTimeout      = 30 * time.Second
+	maxImportRedirects = 5
+)
+
+var (
+	// importClient downloads pages and images of the import, it connects only to public addresses
+	importClient = newImportClient(publicAddress)
+
+	// reservedPrefixes are special purpose networks which aren't private but aren't the internet either
+	reservedPrefixes = []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/8"),
+		netip.MustParsePrefix("100.64.0.0/10"),
+		netip.MustParsePrefix("192.0.0.0/24"),
+		netip.MustParsePrefix("198.18.0.0/15"),
+		netip.MustParsePrefix("240.0.0.0/4"),
+		netip.MustParsePrefix("64:ff9b::/96"),
+	}
+
+	jsonLdRegexp = regexp.MustCompile(`(?is)<script[^>]+type\s*=\s*["']?application/ld\+json["']?[^>]*>(.*?)</script>`)
+	// duration in ISO 8601 like "PT1H20M" or "P0DT0H20M"
+	isoDurationRegexp = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:\d+(?:\.\d+)?S)?)?$`)
+	numberRegexp      = regexp.MustCompile(`\d+(?:[.,]\d+)?`)
+	tagRegexp         = regexp.MustCompile(`<[^>]*>`)
+)
+
+// importedRecipe is the schema.org Recipe found on a page
+type importedRecipe struct {
+	Title        string
+	Description  string
+	Images       []string
+	Ingredients  []string
+	Instructions []string
+	PrepTime     uint
+	CookTime     uint
+	Portions     uint
+	Nutrition    *store.RecipeNutritionV1
+}
+
+// ldRecipe is the schema.org Recipe of JSON-LD, only the fields the import uses
+type ldRecipe struct {
+	Name               ldText       `json:"name"`
+	Description        ldText       `json:"description"`
+	Image              interface{}  `json:"image"`
+	RecipeIngredient   []ldText     `json:"recipeIngredient"`
+	RecipeInstructions interface{}  `json:"recipeInstructions"`
+	PrepTime           ldText       `json:"prepTime"`
+	CookTime           ldText       `json:"cookTime"`
+	TotalTime          ldText       `json:"totalTime"`
+	RecipeYield        ldText       `json:"recipeYield"`
+	Nutrition          *ldNutrition `json:"nutrition"`
+}
+
+// ldNutrition is the schema.org NutritionInformation, values are texts like "240 kcal" or "12 g"
+type ldNutrition struct {
+	Calories     ldText `json:"calories"`
+	Carbohydrate ldText `json:"carbohydrateContent"`
+	Protein      ldText `json:"proteinContent"`
+	Fat          ldText `json:"fatContent"`
+	Fiber        ldText `json:"fiberContent"`
+	Sugar        ldText `json:"sugarContent"`
+	Sodium       ldText `json:"sodiumContent"`
+}
+
+// ldText is a JSON-LD text, pages write it as a string, a number or a list of them, a list keeps its first item
+type ldText string
+
+func (t *ldText) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case string:
+		*t = ldText(cleanText(v))
+	case float64:
+		*t = ldText(strconv.FormatFloat(v, 'f', -1, 64))
+	case []interface{}:
+		if len(v) > 0 {
+			item, err := json.Marshal(v[0])
+			if err != nil {
+				return err
+			}
+			return t.UnmarshalJSON(item)
+		}
+	}
+
+	return nil
+}
+
+// ImportRecipe creates a recipe of the schema.org Recipe JSON-LD of a web page, ingredient lines which
+// can't be matched to the ingredients are dropped, the first image which can be downloaded is the thumbnail
+func (p RecipeProc) ImportRecipe(ctx context.Context, pageUrl string) (recipe *store.RecipeV1, err error) {
+	source, err := url.Parse(strings.TrimSpace(pageUrl))
+	if err != nil || (source.Scheme != "http" && source.Scheme != "https") || source.Host == "" {
+		return nil, fmt.Errorf("%w: url %q is not a http or https url", ErrInvalidImport, pageUrl)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, importTimeout)
+	defer cancel()
+
+	page, err := download(ctx, source.String(), maxImportPageSize)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read %s: %v", ErrInvalidImport, source, err)
+	}
+
+	imported, err := parseRecipePage(page)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := p.importLines(imported.Ingredients)
+	if err != nil {
+		return nil, err
+	}
+
+	draft := store.RecipeDraft{
+		Title:                    imported.Title,
+		Description:              imported.Description,
+		PreparationTimeInMinutes: imported.PrepTime,
+		CookingTimeInMinutes:     imported.CookTime,
+		Portions:                 imported.Portions,
+		Ingredients:              lines,
+	}
+
+	recipe = &store.RecipeV1{
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := p.applyDraft(recipe, draft); err != nil {
+		return nil, err
+	}
+
+	if err := p.engine.CreateRecipe(recipe); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] recipe %d is imported from %s: %s", recipe.ID, source, recipe.Title)
+
+	if imported.Nutrition != nil {
+		imported.Nutrition.RecipeV1ID = recipe.ID
+		if err := p.engine.SaveRecipeNutrition(imported.Nutrition); err != nil {
+			log.Printf("[ERROR] failed to save nutrition of imported recipe %d: %v", recipe.ID, err)
+		}
+	}
+
+	if len(imported.Instructions) > 0 {
+		ingredients := []store.IngredientV1{}
+		for _, line := range recipe.Ingredients {
+			ingredients = append(ingredients, line.Ingredient)
+		}
+
+		steps := []store.RecipeStepV1{}
+		for _, text := range imported.Instructions {
+			steps = append(steps, pantry.ParseStep(text, ingredients))
+		}
+
+		if err := p.engine.ReplaceRecipeSteps(recipe.ID, steps); err != nil {
+			log.Printf("[ERROR] failed to save steps of imported recipe %d: %v", recipe.ID, err)
+		}
+	}
+
+	p.importThumbnail(ctx, source, recipe.ID, imported.Images)
+
+	return p.engine.GetRecipe(recipe.ID)
+}
+
+// importLines parses ingredient lines, lines which can't be parsed or resolved are dropped,
+// new ingredients without a unit are counted in pieces
+func (p RecipeProc) importLines(texts []string) (lines []store.RecipeLineDraft, err error) {
+	catalogue, ingredientsByName, err := p.lineResolver()
+	if err != nil {
+		return nil, err
+	}
+
+	lines = []store.RecipeLineDraft{}
+	for _, text := range texts {
+		line, err := pantry.ParseIngredientLine(catalogue, text)
+		if err != nil {
+			log.Printf("[WARN] skip imported ingredient line: %v", err)
+			continue
+		}
+
+		if _, ok := ingredientsByName[strings.ToLower(line.Ingredient)]; !ok && line.Unit == "" {
+			line.Unit = pantry.CountUnit
+		}
+
+		if _, err := resolveLine(catalogue, ingredientsByName, line); err != nil {
+			log.Printf("[WARN] skip imported ingredient line %q: %v", text, err)
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+// importThumbnail saves the first image which can be downloaded as the recipe thumbnail
+func (p RecipeProc) importThumbnail(ctx context.Context, source *url.URL, recipeID uint, images []string) {
+	for _, image := range images {
+		imageUrl, err := source.Parse(image)
+		if err != nil || (imageUrl.Scheme != "http" && imageUrl.Scheme != "https") {
+			log.Printf("[WARN] skip image %q of imported recipe %d", image, recipeID)
+			continue
+		}
+
+		data, err := download(ctx, imageUrl.String(), maxImportImageSize)
+		if err != nil {
+			log.Printf("[WARN] failed to download image %s of imported recipe %d: %v", imageUrl, recipeID, err)
+			continue
+		}
+
+		if _, err := p.SaveRecipeThumbnail(recipeID, bytes.NewReader(data)); err != nil {
+			log.Printf("[WARN] failed to save image %s of imported recipe %d: %v", imageUrl, recipeID, err)
+			continue
+		}
+
+		return
+	}
+}
+
+// newImportClient makes the client of the import downloads, it connects only to addresses the allow func accepts,
+// the address is checked when the host name is resolved, so redirects and names of local addresses fail too
+func newImportClient(allow func(netip.Addr) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := addrPort.Addr().Unmap(); !allow(ip) {
+				return fmt.Errorf("address %s is not public", ip)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would connect to the address instead of the dialer
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   importTimeout,
+		Transport: transport,
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) >= maxImportRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxImportRedirects)
+			}
+			if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to %q is not a http or https url", request.URL)
+			}
+			return nil
+		},
+	}
+}
+
+// publicAddress accepts addresses of the internet, loopback, private, link-local and other special addresses are refused
+func publicAddress(ip netip.Addr) bool {
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// download reads the body of a successful response, a body larger than the limit fails
+func download(ctx context.Context, target string, limit int64) (body []byte, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := importClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", response.StatusCode)
+	}
+
+	body, err = io.ReadAll(io.LimitReader(response.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("response is larger than %d bytes", limit)
+	}
+
+	return body, nil
+}
+
+// parseRecipePage finds the schema.org Recipe in JSON-LD scripts of the page
+func parseRecipePage(page []byte) (imported importedRecipe, err error) {
+	for _, match := range jsonLdRegexp.FindAllSubmatch(page, -1) {
+		var document interface{}
+		if err := json.Unmarshal(bytes.TrimSpace(match[1]), &document); err != nil {
+			log.Printf("[WARN] skip invalid JSON-LD of imported page: %v", err)
+			continue
+		}
+
+		node := findRecipeNode(document)
+		if node == nil {
+			continue
+		}
+
+		data, err := json.Marshal(node)
+		if err != nil {
+			return imported, err
+		}
+
+		var recipe ldRecipe
+		if err := json.Unmarshal(data, &recipe); err != nil {
+			return imported, fmt.Errorf("%w: invalid recipe JSON-LD: %v", ErrInvalidImport, err)
+		}
+
+		return mapImportedRecipe(recipe)
+	}
+
+	return imported, fmt.Errorf("%w: no schema.org recipe on the page", ErrInvalidImport)
+}
+
+// findRecipeNode finds the first node of Recipe type, nodes may be listed or nested in a @graph
+func findRecipeNode(node interface{}) map[string]interface{} {
+	switch v := node.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if recipe := findRecipeNode(item); recipe != nil {
+				return recipe
+			}
+		}
+	case map[string]interface{}:
+		if hasRecipeType(v["@type"]) {
+			return v
+		}
+		if graph, ok := v["@graph"]; ok {
+			return findRecipeNode(graph)
+		}
+	}
+
+	return nil
+}
+
+func hasRecipeType(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return v == "Recipe"
+	case []interface{}:
+		for _, item := range v {
+			if item == "Recipe" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func mapImportedRecipe(recipe ldRecipe) (imported importedRecipe, err error) {
+	imported = importedRecipe{
+		Title:        string(recipe.Name),
+		Description:  string(recipe.Description),
+		Images:       imageUrls(recipe.Image),
+		Ingredients:  []string{},
+		Instructions: instructionSteps(recipe.RecipeInstructions),
+		PrepTime:     parseIsoMinutes(string(recipe.PrepTime)),
+		CookTime:     parseIsoMinutes(string(recipe.CookTime)),
+		Portions:     uint(parseNumber(string(recipe.RecipeYield))),
+		Nutrition:    mapImportedNutrition(recipe.Nutrition),
+	}
+
+	if imported.Title == "" {
+		return imported, fmt.Errorf("%w: recipe has no name", ErrInvalidImport)
+	}
+
+	totalTime := parseIsoMinutes(string(recipe.TotalTime))
+	if imported.CookTime == 0 && totalTime > imported.PrepTime {
+		imported.CookTime = totalTime - imported.PrepTime
+	}
+
+	for _, line := range recipe.RecipeIngredient {
+		if line != "" {
+			imported.Ingredients = append(imported.Ingredients, string(line))
+		}
+	}
+
+	return imported, nil
+}
+
+// imageUrls reads the image of a recipe, a url, an ImageObject or a list of them
+func imageUrls(value interface{}) []string {
+	urls := []string{}
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			urls = append(urls, v)
+		}
+	case []interface{}:
+		for _, item := range v {
+			urls = append(urls, imageUrls(item)...)
+		}
+	case map[string]interface{}:
+		urls = append(urls, imageUrls(v["url"])...)
+	}
+
+	return urls
+}
+
+// instructionSteps reads recipe instructions, a text, a list of texts or HowToStep nodes, sections are flattened
+func instructionSteps(value interface{}) []string {
+	steps := []string{}
+	switch v := value.(type) {
+	case string:
+		for _, line := range strings.Split(tagRegexp.ReplaceAllString(v, "\n"), "\n") {
+			if step := cleanText(line); step != "" {
+				steps = append(steps, step)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			steps = append(steps, instructionSteps(item)...)
+		}
+	case map[string]interface{}:
+		if items, ok := v["itemListElement"]; ok {
+			return instructionSteps(items)
+		}
+		if text, ok := v["text"].(string); ok {
+			if step := cleanText(text); step != "" {
+				steps = append(steps, step)
+			}
+		}
+	}
+
+	return steps
+}
+
+func mapImportedNutrition(source *ldNutrition) *store.RecipeNutritionV1 {
+	if source == nil {
+		return nil
+	}
+
+	nutrition := store.RecipeNutritionV1{
+		Calories: parseNutritionValue(string(source.Calories)),
+		Carbs:    parseNutritionValue(string(source.Carbohydrate)),
+		Protein:  parseNutritionValue(string(source.Protein)),
+		Fat:      parseNutritionValue(string(source.Fat)),
+		Fibre:    parseNutritionValue(string(source.Fiber)),
+		Sugar:    parseNutritionValue(string(source.Sugar)),
+	}
+
+	// salt is 2.5 times the sodium
+	if sodium := parseNutritionValue(string(source.Sodium)); sodium.Valid {
+		nutrition.Salt = sql.NullFloat64{Float64: sodium.Float64 * 2.5, Valid: true}
+	}
+
+	if nutrition == (store.RecipeNutritionV1{}) {
+		return nil
+	}
+
+	return &nutrition
+}
+
+// parseNutritionValue reads a value like "12.5 g", values in milligrams are converted to grams
+func parseNutritionValue(text string) sql.NullFloat64 {
+	match := numberRegexp.FindString(text)
+	if match == "" {
+		return sql.NullFloat64{}
+	}
+
+	value, err := strconv.ParseFloat(strings.ReplaceAll(match, ",", "."), 64)
+	if err != nil {
+		return sql.NullFloat64{}
+	}
+
+	if strings.HasSuffix(strings.ToLower(strings.TrimSpace(text)), "mg") {
+		value = value / 1000
+	}
+
+	return sql.NullFloat64{Float64: value, Valid: true}
+}
+
+// parseIsoMinutes reads an ISO 8601 duration in minutes, seconds are dropped
+func parseIsoMinutes(text string) uint {
+	match := isoDurationRegexp.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(text)))
+	if match == nil {
+		return 0
+	}
+
+	days, _ := strconv.ParseUint(match[1], 10, 32)
+	hours, _ := strconv.ParseUint(match[2], 10, 32)
+	minutes, _ := strconv.ParseUint(match[3], 10, 32)
+
+	return uint(days*24*60 + hours*60 + minutes)
+}
+
+// parseNumber reads the first number of a text like "4 servings", it's zero when there is none
+func parseNumber(text string) float64 {
+	value, err := strconv.ParseFloat(strings.ReplaceAll(numberRegexp.FindString(text), ",", "."), 64)
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
+
+// cleanText unescapes html entities, drops tags and collapses spaces
+func cleanText(text string) string {
+	text = html.UnescapeString(tagRegexp.ReplaceAllString(text, " "))
+	return strings.Join(strings.Fields(text), " ")
+}
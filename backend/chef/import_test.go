@@ -0,0 +1,377 @@
+package chef
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// fakeEngine keeps created recipes in memory, methods the import doesn't use are not implemented
+type fakeEngine struct {
+	Engine
+
+	recipes     map[uint]store.RecipeV1
+	ingredients []store.IngredientV1
+	nutrition   map[uint]store.RecipeNutritionV1
+}
+
+func newFakeEngine(ingredients []store.IngredientV1) *fakeEngine {
+	return &fakeEngine{
+		recipes:     make(map[uint]store.RecipeV1),
+		ingredients: ingredients,
+		nutrition:   make(map[uint]store.RecipeNutritionV1),
+	}
+}
+
+func (e *fakeEngine) GetUnits() (*[]store.UnitV1, error) {
+	units := testUnits()
+	return &units, nil
+}
+
+func (e *fakeEngine) GetIngredients() (*store.Ingredients, error) {
+	return &store.Ingredients{Ingredients: e.ingredients}, nil
+}
+
+func (e *fakeEngine) CreateRecipe(recipe *store.RecipeV1) error {
+	recipe.ID = uint(len(e.recipes) + 1)
+	for i := range recipe.Ingredients {
+		line := &recipe.Ingredients[i]
+		if line.IngredientV1ID == 0 {
+			line.Ingredient.ID = uint(len(e.ingredients) + 1)
+			line.IngredientV1ID = line.Ingredient.ID
+			e.ingredients = append(e.ingredients, line.Ingredient)
+		}
+	}
+	e.recipes[recipe.ID] = *recipe
+	return nil
+}
+
+func (e *fakeEngine) GetRecipe(id uint) (*store.RecipeV1, error) {
+	recipe, ok := e.recipes[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &recipe, nil
+}
+
+func (e *fakeEngine) UpdateRecipeFiles(recipe *store.RecipeV1) error {
+	saved := e.recipes[recipe.ID]
+	saved.ThumbnailUrl = recipe.ThumbnailUrl
+	saved.PdfUrl = recipe.PdfUrl
+	e.recipes[recipe.ID] = saved
+	return nil
+}
+
+func (e *fakeEngine) ReplaceRecipeSteps(recipeID uint, steps []store.RecipeStepV1) error {
+	recipe := e.recipes[recipeID]
+	recipe.Steps = steps
+	e.recipes[recipeID] = recipe
+	return nil
+}
+
+func (e *fakeEngine) SaveRecipeNutrition(nutrition *store.RecipeNutritionV1) error {
+	e.nutrition[nutrition.RecipeV1ID] = *nutrition
+	return nil
+}
+
+func testUnits() []store.UnitV1 {
+	units := store.DefaultUnits()
+	for i := range units {
+		units[i].ID = uint(i + 1)
+	}
+	return units
+}
+
+func testUnit(t *testing.T, name string) store.UnitV1 {
+	t.Helper()
+
+	for _, unit := range testUnits() {
+		if unit.Name == name {
+			return unit
+		}
+	}
+	t.Fatalf("unit %s is not in the catalogue", name)
+	return store.UnitV1{}
+}
+
+// testSite serves the fixture pages and png images, missing.png is not found
+func testSite(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle("/recipes/", http.StripPrefix("/recipes/", http.FileServer(http.Dir("testdata"))))
+	mux.HandleFunc("/images/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/images/missing.png" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// allowLocalImports lets the import download of the test site on the loopback address
+func allowLocalImports(t *testing.T) {
+	t.Helper()
+
+	previous := importClient
+	importClient = newImportClient(func(netip.Addr) bool { return true })
+	t.Cleanup(func() { importClient = previous })
+}
+
+func useTempImageStore(t *testing.T) {
+	t.Helper()
+
+	previous := imageStore
+	imageStore = t.TempDir()
+	t.Cleanup(func() { imageStore = previous })
+}
+
+func TestImportRecipe(t *testing.T) {
+	useTempImageStore(t)
+	allowLocalImports(t)
+	site := testSite(t)
+
+	ml := testUnit(t, "ml")
+	engine := newFakeEngine([]store.IngredientV1{{ID: 1, Name: "Olive oil", UnitID: ml.ID, Unit: ml}})
+	proc := New(engine)
+
+	recipe, err := proc.ImportRecipe(context.Background(), site.URL+"/recipes/recipe-graph.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if recipe.Title != "Shakshuka" || recipe.PreparationTimeInMinutes != 10 || recipe.CookingTimeInMinutes != 25 || recipe.Portions != 4 {
+		t.Errorf("recipe = %q, prep %d, cook %d, portions %d", recipe.Title, recipe.PreparationTimeInMinutes, recipe.CookingTimeInMinutes, recipe.Portions)
+	}
+
+	if recipe.Description != "Eggs poached in tomato & pepper sauce." {
+		t.Errorf("description = %q", recipe.Description)
+	}
+
+	// steps of sections are flattened and linked to the ingredients they mention
+	steps := []struct {
+		text        string
+		timer       int64
+		ingredients []string
+	}{
+		{text: "Heat the oil.", ingredients: []string{"Olive oil"}},
+		{text: "Add tomatoes and cumin, simmer for 15 minutes.", timer: 900, ingredients: []string{"tomatoes", "ground cumin"}},
+		{text: "Crack the eggs into the sauce and cover.", ingredients: []string{"eggs"}},
+	}
+	if len(recipe.Steps) != len(steps) {
+		t.Fatalf("steps = %+v, want %d steps", recipe.Steps, len(steps))
+	}
+	for i, want := range steps {
+		step := recipe.Steps[i]
+		names := []string{}
+		for _, link := range step.Ingredients {
+			names = append(names, link.Ingredient.Name)
+		}
+		if step.Text != want.text || step.TimerInSeconds.Int64 != want.timer || strings.Join(names, ",") != strings.Join(want.ingredients, ",") {
+			t.Errorf("step %d = %q, timer %d, ingredients %v", i, step.Text, step.TimerInSeconds.Int64, names)
+		}
+	}
+
+	// the tomatoes in cups can't convert to the grams the new ingredient is measured in
+	tests := []struct {
+		ingredient string
+		amount     float64
+		unit       string
+		lineUnit   string
+	}{
+		{ingredient: "Olive oil", amount: 2, unit: "ml", lineUnit: "tbsp"},
+		{ingredient: "tomatoes", amount: 400, unit: "g"},
+		{ingredient: "ground cumin", amount: 1, unit: "tsp"},
+		{ingredient: "eggs", amount: 4, unit: "pcs"},
+	}
+	if len(recipe.Ingredients) != len(tests) {
+		t.Fatalf("ingredients = %+v, want %d lines", recipe.Ingredients, len(tests))
+	}
+	for i, tt := range tests {
+		line := recipe.Ingredients[i]
+		if line.Ingredient.Name != tt.ingredient || line.Amount != tt.amount || line.Ingredient.Unit.Name != tt.unit {
+			t.Errorf("line %d = %s %v (%s), want %s %v (%s)", i, line.Ingredient.Name, line.Amount, line.Ingredient.Unit.Name, tt.ingredient, tt.amount, tt.unit)
+		}
+
+		lineUnit := ""
+		if line.Unit != nil {
+			lineUnit = line.Unit.Name
+		}
+		if lineUnit != tt.lineUnit {
+			t.Errorf("line %d unit = %q, want %q", i, lineUnit, tt.lineUnit)
+		}
+	}
+
+	nutrition, ok := engine.nutrition[recipe.ID]
+	if !ok {
+		t.Fatal("nutrition is not saved")
+	}
+	if nutrition.Calories.Float64 != 320 || nutrition.Protein.Float64 != 14 || math.Abs(nutrition.Salt.Float64-2) > 1e-9 || nutrition.Fat.Valid {
+		t.Errorf("nutrition = %+v", nutrition)
+	}
+
+	if !recipe.ThumbnailUrl.Valid || !strings.HasSuffix(recipe.ThumbnailUrl.String, "/1-shakshuka/1.png") {
+		t.Fatalf("thumbnail = %+v", recipe.ThumbnailUrl)
+	}
+	if _, err := os.Stat(recipe.ThumbnailUrl.String); err != nil {
+		t.Errorf("thumbnail is not saved: %v", err)
+	}
+}
+
+func TestImportRecipeOfList(t *testing.T) {
+	useTempImageStore(t)
+	allowLocalImports(t)
+	site := testSite(t)
+
+	engine := newFakeEngine(nil)
+	recipe, err := New(engine).ImportRecipe(context.Background(), site.URL+"/recipes/recipe-list.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the cooking time is the rest of the total time
+	if recipe.Title != "Overnight oats" || recipe.PreparationTimeInMinutes != 5 || recipe.CookingTimeInMinutes != 60 || recipe.Portions != 2 {
+		t.Errorf("recipe = %q, prep %d, cook %d, portions %d", recipe.Title, recipe.PreparationTimeInMinutes, recipe.CookingTimeInMinutes, recipe.Portions)
+	}
+
+	if len(recipe.Steps) != 2 || recipe.Steps[0].Text != "Mix oats and milk." || recipe.Steps[1].Text != "Leave in the fridge overnight." {
+		t.Errorf("steps = %+v", recipe.Steps)
+	}
+
+	if len(recipe.Ingredients) != 2 {
+		t.Errorf("ingredients = %+v, want 2 lines", recipe.Ingredients)
+	}
+
+	if _, ok := engine.nutrition[recipe.ID]; ok {
+		t.Error("nutrition is saved for a recipe without nutrition")
+	}
+
+	// the first image is missing, the next one is the thumbnail
+	if !recipe.ThumbnailUrl.Valid || !strings.HasSuffix(recipe.ThumbnailUrl.String, "/1-overnight oats/1.png") {
+		t.Errorf("thumbnail = %+v", recipe.ThumbnailUrl)
+	}
+}
+
+func TestImportRecipeFails(t *testing.T) {
+	allowLocalImports(t)
+	site := testSite(t)
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{name: "page without recipe", url: site.URL + "/recipes/no-recipe.html"},
+		{name: "missing page", url: site.URL + "/recipes/missing.html"},
+		{name: "not a http url", url: "file:///etc/passwd"},
+		{name: "not a url", url: "shakshuka"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newFakeEngine(nil)
+			_, err := New(engine).ImportRecipe(context.Background(), tt.url)
+			if !errors.Is(err, ErrInvalidImport) || !errors.Is(err, store.ErrInvalid) {
+				t.Fatalf("expected error %v, got %v", ErrInvalidImport, err)
+			}
+			if len(engine.recipes) != 0 {
+				t.Errorf("recipe is created: %+v", engine.recipes)
+			}
+		})
+	}
+}
+
+func TestImportRecipeRefusesLocalAddresses(t *testing.T) {
+	site := testSite(t)
+
+	redirect := httptest.NewServer(http.RedirectHandler(site.URL+"/recipes/recipe-graph.html", http.StatusFound))
+	t.Cleanup(redirect.Close)
+
+	// the public check is of the resolved address, the redirect is checked as well
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{name: "loopback address", url: site.URL + "/recipes/recipe-graph.html"},
+		{name: "local host name", url: strings.Replace(site.URL, "127.0.0.1", "localhost", 1) + "/recipes/recipe-graph.html"},
+		{name: "redirect to loopback", url: redirect.URL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newFakeEngine(nil)
+			_, err := New(engine).ImportRecipe(context.Background(), tt.url)
+			if !errors.Is(err, ErrInvalidImport) || !strings.Contains(err.Error(), "is not public") {
+				t.Fatalf("expected error of a not public address, got %v", err)
+			}
+			if len(engine.recipes) != 0 {
+				t.Errorf("recipe is created: %+v", engine.recipes)
+			}
+		})
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{address: "93.184.216.34", want: true},
+		{address: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{address: "127.0.0.1"},
+		{address: "::1"},
+		{address: "10.1.2.3"},
+		{address: "172.16.0.1"},
+		{address: "192.168.1.1"},
+		{address: "169.254.169.254"},
+		{address: "fe80::1"},
+		{address: "fd00::1"},
+		{address: "100.64.0.1"},
+		{address: "0.0.0.0"},
+		{address: "224.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			if got := publicAddress(netip.MustParseAddr(tt.address)); got != tt.want {
+				t.Errorf("publicAddress(%s) = %t, want %t", tt.address, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIsoMinutes(t *testing.T) {
+	tests := []struct {
+		duration string
+		want     uint
+	}{
+		{duration: "PT20M", want: 20},
+		{duration: "PT1H30M", want: 90},
+		{duration: "P0DT0H45M", want: 45},
+		{duration: "P1D", want: 1440},
+		{duration: "PT2H", want: 120},
+		{duration: "PT90S", want: 0},
+		{duration: "20 minutes", want: 0},
+		{duration: "", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.duration, func(t *testing.T) {
+			if got := parseIsoMinutes(tt.duration); got != tt.want {
+				t.Errorf("parseIsoMinutes(%q) = %d, want %d", tt.duration, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package chef
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// maxNutritionDays limits the range of the nutrition summary
+const maxNutritionDays = 366
+
+// GetPlanNutrition sums nutrition of the servings planned between from and to (both inclusive) per day and week
+func (p RecipeProc) GetPlanNutrition(from time.Time, to time.Time) (summary *store.NutritionSummary, err error) {
+	from = truncateToDay(from)
+	to = truncateToDay(to)
+
+	if to.Before(from) {
+		return nil, fmt.Errorf("to should not be before from: %w", store.ErrInvalid)
+	}
+	if to.Sub(from) >= maxNutritionDays*24*time.Hour {
+		return nil, fmt.Errorf("range should be at most %d days: %w", maxNutritionDays, store.ErrInvalid)
+	}
+
+	servings, err := p.engine.LoadPlannedServings(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return summarizeNutrition(from, to, *servings), nil
+}
+
+// summarizeNutrition sums the servings into days from and to, weeks start on Sunday and are numbered
+// like the planned weeks by the ISO week of their first day
+func summarizeNutrition(from time.Time, to time.Time, servings []store.ServingV1) *store.NutritionSummary {
+	summary := store.NutritionSummary{From: from, To: to}
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		summary.Days = append(summary.Days, store.DayNutrition{Date: day})
+	}
+
+	for _, serving := range servings {
+		if !serving.PlannedFor.Valid {
+			continue
+		}
+
+		for i := range summary.Days {
+			if !isSameDay(serving.PlannedFor.Time, summary.Days[i].Date) {
+				continue
+			}
+
+			if serving.Recipe.Nutrition == nil {
+				summary.MissingServings++
+				break
+			}
+
+			summary.Days[i].Servings++
+			addNutrition(&summary.Days[i].Total, *serving.Recipe.Nutrition)
+			break
+		}
+	}
+
+	var plannedDays uint
+	for _, day := range summary.Days {
+		year, number := day.Date.AddDate(0, 0, -int(day.Date.Weekday())).ISOWeek()
+		if len(summary.Weeks) == 0 || summary.Weeks[len(summary.Weeks)-1].Year != year || summary.Weeks[len(summary.Weeks)-1].Number != number {
+			summary.Weeks = append(summary.Weeks, store.WeekNutrition{Year: year, Number: number})
+		}
+
+		if day.Servings == 0 {
+			continue
+		}
+
+		week := &summary.Weeks[len(summary.Weeks)-1]
+		week.Days++
+		sumNutrition(&week.Total, day.Total)
+
+		plannedDays++
+		sumNutrition(&summary.Total, day.Total)
+	}
+
+	for i := range summary.Weeks {
+		summary.Weeks[i].DailyAverage = averageNutrition(summary.Weeks[i].Total, summary.Weeks[i].Days)
+	}
+	summary.DailyAverage = averageNutrition(summary.Total, plannedDays)
+
+	return &summary
+}
+
+func addNutrition(sum *store.Nutrition, nutrition store.RecipeNutritionV1) {
+	sumNutrition(sum, store.Nutrition{
+		Calories: nutrition.Calories.Float64,
+		Carbs:    nutrition.Carbs.Float64,
+		Protein:  nutrition.Protein.Float64,
+		Fat:      nutrition.Fat.Float64,
+		Fibre:    nutrition.Fibre.Float64,
+		Sugar:    nutrition.Sugar.Float64,
+		Salt:     nutrition.Salt.Float64,
+	})
+}
+
+func sumNutrition(sum *store.Nutrition, value store.Nutrition) {
+	sum.Calories += value.Calories
+	sum.Carbs += value.Carbs
+	sum.Protein += value.Protein
+	sum.Fat += value.Fat
+	sum.Fibre += value.Fibre
+	sum.Sugar += value.Sugar
+	sum.Salt += value.Salt
+}
+
+func averageNutrition(sum store.Nutrition, days uint) store.Nutrition {
+	if days == 0 {
+		return store.Nutrition{}
+	}
+
+	count := float64(days)
+	return store.Nutrition{
+		Calories: sum.Calories / count,
+		Carbs:    sum.Carbs / count,
+		Protein:  sum.Protein / count,
+		Fat:      sum.Fat / count,
+		Fibre:    sum.Fibre / count,
+		Sugar:    sum.Sugar / count,
+		Salt:     sum.Salt / count,
+	}
+}
+
+func truncateToDay(day time.Time) time.Time {
+	year, month, date := day.UTC().Date()
+	return time.Date(year, month, date, 0, 0, 0, 0, time.UTC)
+}
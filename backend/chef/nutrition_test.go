@@ -0,0 +1,63 @@
+package chef
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+func TestSummarizeNutrition(t *testing.T) {
+	day := func(date int) time.Time { return time.Date(2024, time.January, date, 0, 0, 0, 0, time.UTC) }
+	serving := func(date int, nutrition *store.RecipeNutritionV1) store.ServingV1 {
+		return store.ServingV1{
+			PlannedFor: sql.NullTime{Time: day(date), Valid: true},
+			Recipe:     store.RecipeV1{Nutrition: nutrition},
+		}
+	}
+	nutrition := func(calories, carbs float64) *store.RecipeNutritionV1 {
+		return &store.RecipeNutritionV1{
+			Calories: sql.NullFloat64{Float64: calories, Valid: true},
+			Carbs:    sql.NullFloat64{Float64: carbs, Valid: true},
+		}
+	}
+
+	// 2024-01-06 is Saturday of the week starting on 2023-12-31, the next week starts on Sunday 2024-01-07
+	summary := summarizeNutrition(day(6), day(8), []store.ServingV1{
+		serving(6, nutrition(500, 40)),
+		serving(6, nutrition(700, 60)),
+		serving(8, nutrition(300, 10)),
+		serving(8, nil),
+	})
+
+	if len(summary.Days) != 3 {
+		t.Fatalf("%d days, want 3", len(summary.Days))
+	}
+	if got := summary.Days[0]; got.Servings != 2 || got.Total.Calories != 1200 || got.Total.Carbs != 100 {
+		t.Errorf("first day = %+v, want 2 servings with 1200 kcal and 100 g carbs", got)
+	}
+	if got := summary.Days[1]; got.Servings != 0 || got.Total != (store.Nutrition{}) {
+		t.Errorf("empty day = %+v", got)
+	}
+
+	if summary.Total.Calories != 1500 || summary.Total.Carbs != 110 {
+		t.Errorf("total = %+v, want 1500 kcal and 110 g carbs", summary.Total)
+	}
+	if summary.DailyAverage.Calories != 750 || summary.DailyAverage.Carbs != 55 {
+		t.Errorf("daily average = %+v, want 750 kcal and 55 g carbs over the planned days", summary.DailyAverage)
+	}
+	if summary.MissingServings != 1 {
+		t.Errorf("missing servings = %d, want 1", summary.MissingServings)
+	}
+
+	if len(summary.Weeks) != 2 {
+		t.Fatalf("%d weeks, want 2", len(summary.Weeks))
+	}
+	if got := summary.Weeks[0]; got.Year != 2023 || got.Number != 52 || got.Days != 1 || got.DailyAverage.Calories != 1200 {
+		t.Errorf("first week = %+v, want week 52 of 2023 with 1 day of 1200 kcal", got)
+	}
+	if got := summary.Weeks[1]; got.Year != 2024 || got.Number != 1 || got.Days != 1 || got.Total.Calories != 300 {
+		t.Errorf("second week = %+v, want week 1 of 2024 with 1 day of 300 kcal", got)
+	}
+}
@@ -0,0 +1,367 @@
+package chef
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rjxby/eat-repeat/backend/pantry"
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// Error messages
+var (
+	ErrInvalidRecipe = fmt.Errorf("invalid recipe: %w", store.ErrInvalid)
+	ErrInvalidFile   = fmt.Errorf("invalid recipe file: %w", store.ErrInvalid)
+)
+
+const (
+	// defaultPortions is used for recipes created without portions
+	defaultPortions = 2
+	// maxTagLength is the size of the tag name column
+	maxTagLength = 255
+)
+
+// uploaded files follow the layout of the seeded ones, data/recipes/<title>.pdf and data/images/<title>/1.jpeg
+var pdfStore = "data/recipes/"
+var imageStore = "data/images/"
+
+// thumbnailExtensions are the accepted thumbnail content types with the extension the file is saved with
+var thumbnailExtensions = map[string]string{
+	"image/jpeg": ".jpeg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+func (p RecipeProc) GetRecipe(id uint) (recipe *store.RecipeV1, err error) {
+	recipe, err = p.engine.GetRecipe(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return recipe, nil
+}
+
+// CreateRecipe validates the draft and creates a recipe of it
+func (p RecipeProc) CreateRecipe(draft store.RecipeDraft) (recipe *store.RecipeV1, err error) {
+	recipe = &store.RecipeV1{
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := p.applyDraft(recipe, draft); err != nil {
+		return nil, err
+	}
+
+	if err := p.engine.CreateRecipe(recipe); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] recipe %d is created: %s", recipe.ID, recipe.Title)
+
+	return p.engine.GetRecipe(recipe.ID)
+}
+
+// UpdateRecipe validates the draft and replaces the recipe fields and ingredient lines with it,
+// thumbnail, pdf and rating of the recipe are kept
+func (p RecipeProc) UpdateRecipe(id uint, draft store.RecipeDraft) (recipe *store.RecipeV1, err error) {
+	recipe, err = p.engine.GetRecipe(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.applyDraft(recipe, draft); err != nil {
+		return nil, err
+	}
+	recipe.UpdatedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+
+	if err := p.engine.UpdateRecipe(recipe); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] recipe %d is updated: %s", recipe.ID, recipe.Title)
+
+	return p.engine.GetRecipe(recipe.ID)
+}
+
+func (p RecipeProc) GetRecipeDifficulties() (difficulties *[]store.RecipeDifficultyV1, err error) {
+	difficulties, err = p.engine.LoadRecipeDifficulties()
+	if err != nil {
+		return nil, err
+	}
+
+	return difficulties, nil
+}
+
+// CheckSearchIndex compares the recipes search index with the recipes
+func (p RecipeProc) CheckSearchIndex() (status *store.SearchIndexStatus, err error) {
+	status, err = p.engine.CheckSearchIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// RebuildSearchIndex indexes all recipes again and checks the rebuilt index
+func (p RecipeProc) RebuildSearchIndex() (status *store.SearchIndexStatus, err error) {
+	if err := p.engine.RebuildSearchIndex(); err != nil {
+		return nil, err
+	}
+
+	return p.engine.CheckSearchIndex()
+}
+
+// SaveRecipeThumbnail saves a jpeg, png or webp image to the images store and sets it as the recipe thumbnail
+func (p RecipeProc) SaveRecipeThumbnail(id uint, content io.Reader) (recipe *store.RecipeV1, err error) {
+	recipe, err = p.engine.GetRecipe(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := http.DetectContentType(data)
+	extension, ok := thumbnailExtensions[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: thumbnail of %s type is not supported", ErrInvalidFile, contentType)
+	}
+
+	path := filepath.Join(imageStore, recipeFileName(*recipe), "1"+extension)
+	if err := saveFile(path, data); err != nil {
+		return nil, err
+	}
+
+	recipe.ThumbnailUrl = sql.NullString{String: filepath.ToSlash(path), Valid: true}
+
+	return p.updateRecipeFiles(recipe)
+}
+
+// SaveRecipePdf saves a pdf to the recipes store and sets it as the recipe pdf
+func (p RecipeProc) SaveRecipePdf(id uint, content io.Reader) (recipe *store.RecipeV1, err error) {
+	recipe, err = p.engine.GetRecipe(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType := http.DetectContentType(data); contentType != "application/pdf" {
+		return nil, fmt.Errorf("%w: pdf of %s type is not supported", ErrInvalidFile, contentType)
+	}
+
+	path := filepath.Join(pdfStore, recipeFileName(*recipe)+".pdf")
+	if err := saveFile(path, data); err != nil {
+		return nil, err
+	}
+
+	recipe.PdfUrl = sql.NullString{String: filepath.ToSlash(path), Valid: true}
+
+	return p.updateRecipeFiles(recipe)
+}
+
+func (p RecipeProc) updateRecipeFiles(recipe *store.RecipeV1) (result *store.RecipeV1, err error) {
+	recipe.UpdatedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+
+	if err := p.engine.UpdateRecipeFiles(recipe); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] recipe %d files are updated: thumbnail %q, pdf %q", recipe.ID, recipe.ThumbnailUrl.String, recipe.PdfUrl.String)
+
+	return recipe, nil
+}
+
+func (p RecipeProc) DeleteRecipe(id uint) (err error) {
+	if err := p.engine.DeleteRecipe(id); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] recipe %d is deleted", id)
+
+	return nil
+}
+
+// applyDraft validates the draft and copies it to the recipe resolving ingredients and units by name,
+// unknown ingredients are created with the unit of their line
+func (p RecipeProc) applyDraft(recipe *store.RecipeV1, draft store.RecipeDraft) (err error) {
+	title := strings.TrimSpace(draft.Title)
+	if title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalidRecipe)
+	}
+
+	portions := draft.Portions
+	if portions == 0 {
+		portions = defaultPortions
+	}
+
+	catalogue, ingredientsByName, err := p.lineResolver()
+	if err != nil {
+		return err
+	}
+
+	var difficulty *store.RecipeDifficultyV1
+	if draft.DifficultyID != 0 {
+		difficulty, err = p.engine.GetRecipeDifficulty(draft.DifficultyID)
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("unknown difficulty %d: %w", draft.DifficultyID, store.ErrInvalid)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	tags, err := recipeTags(draft.Tags)
+	if err != nil {
+		return err
+	}
+
+	lines := []store.RecipeV1IngredientV1{}
+	for i, lineDraft := range draft.Ingredients {
+		line, err := resolveLine(catalogue, ingredientsByName, lineDraft)
+		if err != nil {
+			return fmt.Errorf("ingredient line %d: %w", i+1, err)
+		}
+		lines = append(lines, line)
+	}
+
+	recipe.Title = title
+	recipe.Description = store.TruncateText(strings.TrimSpace(draft.Description), store.MaxDescriptionLength)
+	recipe.PreparationTimeInMinutes = draft.PreparationTimeInMinutes
+	recipe.CookingTimeInMinutes = draft.CookingTimeInMinutes
+	recipe.Portions = portions
+	recipe.Ingredients = lines
+	recipe.Tags = tags
+	if difficulty != nil {
+		recipe.RecipeDifficultyID = difficulty.ID
+		recipe.RecipeDifficulty = *difficulty
+	}
+
+	return nil
+}
+
+// recipeTags makes tags of their names, names are lower case with single spaces, duplicates are dropped
+func recipeTags(names []string) (tags []store.TagV1, err error) {
+	tags = []store.TagV1{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+		if name == "" || seen[name] {
+			continue
+		}
+		if utf8.RuneCountInString(name) > maxTagLength {
+			return nil, fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidRecipe, name, maxTagLength)
+		}
+
+		seen[name] = true
+		tags = append(tags, store.TagV1{Name: name})
+	}
+
+	return tags, nil
+}
+
+// lineResolver loads the unit catalogue and the ingredients by lower case name to resolve ingredient lines
+func (p RecipeProc) lineResolver() (catalogue *pantry.Catalogue, ingredientsByName map[string]store.IngredientV1, err error) {
+	units, err := p.engine.GetUnits()
+	if err != nil {
+		return nil, nil, err
+	}
+	catalogue = pantry.NewCatalogue(*units)
+
+	ingredients, err := p.engine.GetIngredients()
+	if err != nil {
+		return nil, nil, err
+	}
+	ingredientsByName = make(map[string]store.IngredientV1)
+	for _, ingredient := range ingredients.Ingredients {
+		ingredientsByName[strings.ToLower(ingredient.Name)] = ingredient
+	}
+
+	return catalogue, ingredientsByName, nil
+}
+
+func resolveLine(catalogue *pantry.Catalogue, ingredientsByName map[string]store.IngredientV1, draft store.RecipeLineDraft) (line store.RecipeV1IngredientV1, err error) {
+	name := strings.TrimSpace(draft.Ingredient)
+	if name == "" {
+		return line, fmt.Errorf("%w: ingredient is required", ErrInvalidRecipe)
+	}
+
+	if draft.Amount < 0 {
+		return line, fmt.Errorf("%w: amount of %s can't be negative", ErrInvalidRecipe, name)
+	}
+
+	var unit *store.UnitV1
+	if strings.TrimSpace(draft.Unit) != "" {
+		found, ok := catalogue.Lookup(draft.Unit)
+		if !ok {
+			return line, fmt.Errorf("%w %q", pantry.ErrUnknownUnit, draft.Unit)
+		}
+		unit = &found
+	}
+
+	ingredient, ok := ingredientsByName[strings.ToLower(name)]
+	if !ok {
+		if unit == nil {
+			return line, fmt.Errorf("%w: unit is required for new ingredient %s", ErrInvalidRecipe, name)
+		}
+
+		// the line is in the unit of the new ingredient
+		ingredient = store.IngredientV1{Name: name, UnitID: unit.ID, Unit: *unit, CreatedAt: time.Now().UTC()}
+		ingredientsByName[strings.ToLower(name)] = ingredient
+
+		return store.RecipeV1IngredientV1{Ingredient: ingredient, Amount: draft.Amount}, nil
+	}
+
+	line = store.RecipeV1IngredientV1{IngredientV1ID: ingredient.ID, Ingredient: ingredient, Amount: draft.Amount}
+
+	if unit != nil && unit.ID != ingredient.UnitID {
+		// the pantry keeps the ingredient in its unit, so the line must convert to it
+		if _, err := catalogue.ConvertToIngredientUnit(1, unit.Name, ingredient); err != nil {
+			return line, err
+		}
+		line.UnitID = &unit.ID
+		line.Unit = unit
+	}
+
+	return line, nil
+}
+
+// recipeFileName is the recipe id and the lower case recipe title, e.g. "12-pancakes", the id keeps files of recipes
+// with titles differing only by characters unsafe for a path apart, these characters are dropped
+func recipeFileName(recipe store.RecipeV1) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == ' ' || r == '-' || r == '_' {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, recipe.Title)
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Sprintf("%d-recipe", recipe.ID)
+	}
+
+	return fmt.Sprintf("%d-%s", recipe.ID, name)
+}
+
+func saveFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,61 @@
+package chef
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+func TestRecipeFileName(t *testing.T) {
+	tests := []struct {
+		name   string
+		recipe store.RecipeV1
+		want   string
+	}{
+		{name: "title", recipe: store.RecipeV1{ID: 12, Title: "Pancakes"}, want: "12-pancakes"},
+		{name: "title of the same name", recipe: store.RecipeV1{ID: 13, Title: "Pancakes!"}, want: "13-pancakes"},
+		{name: "unsafe characters", recipe: store.RecipeV1{ID: 3, Title: "Mac & Cheese / Bake"}, want: "3-mac  cheese  bake"},
+		{name: "title of unsafe characters", recipe: store.RecipeV1{ID: 5, Title: "?!"}, want: "5-recipe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recipeFileName(tt.recipe); got != tt.want {
+				t.Errorf("recipeFileName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func (e *fakeEngine) UpdateRecipe(recipe *store.RecipeV1) error {
+	if _, ok := e.recipes[recipe.ID]; !ok {
+		return store.ErrNotFound
+	}
+	e.recipes[recipe.ID] = *recipe
+	return nil
+}
+
+func TestRecipeDescriptionIsTruncated(t *testing.T) {
+	engine := newFakeEngine(nil)
+	proc := New(engine)
+
+	description := " " + strings.Repeat("é", store.MaxDescriptionLength+10) + " "
+
+	created, err := proc.CreateRecipe(store.RecipeDraft{Title: "Crème brûlée", Description: description})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if length := utf8.RuneCountInString(created.Description); length != store.MaxDescriptionLength || !utf8.ValidString(created.Description) {
+		t.Fatalf("expected created description of %d characters, got %d", store.MaxDescriptionLength, length)
+	}
+
+	updated, err := proc.UpdateRecipe(created.ID, store.RecipeDraft{Title: "Crème brûlée", Description: "a" + description})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if length := utf8.RuneCountInString(updated.Description); length != store.MaxDescriptionLength || !strings.HasPrefix(updated.Description, "a") {
+		t.Fatalf("expected updated description of %d characters, got %d", store.MaxDescriptionLength, length)
+	}
+}
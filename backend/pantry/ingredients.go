@@ -0,0 +1,105 @@
+package pantry
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// ErrInvalidIngredientLine is an ingredient line without an ingredient name
+var ErrInvalidIngredientLine = fmt.Errorf("invalid ingredient line: %w", store.ErrInvalid)
+
+var (
+	// amount like "2", "1.5", "1,5", "1/2", "1 1/2" or "1½", a range like "2-3" keeps its lower bound
+	amountRegexp = regexp.MustCompile(`^(\d+\s+\d+/\d+|\d+/\d+|\d*[½¼¾⅓⅔⅛]|\d+(?:[.,]\d+)?)(?:\s*[-–]\s*(?:\d+(?:[.,/]\d+)?|[½¼¾⅓⅔⅛]))?`)
+	// notes of an ingredient like "(about 400 g)" or ", finely chopped" are not the ingredient name
+	parenthesesRegexp = regexp.MustCompile(`\([^)]*\)`)
+	lineBulletRegexp  = regexp.MustCompile(`^[•·*\-–]\s*`)
+)
+
+var vulgarFractions = map[rune]float64{
+	'½': 0.5,
+	'¼': 0.25,
+	'¾': 0.75,
+	'⅓': 1.0 / 3,
+	'⅔': 2.0 / 3,
+	'⅛': 0.125,
+}
+
+// ParseIngredientLine parses an ingredient line as written in a recipe, e.g. "200 g flour" or "2 tomatoes, diced",
+// the unit is a catalogue unit name, empty when the line has none, a line without amount has zero amount
+func ParseIngredientLine(catalogue *Catalogue, line string) (draft store.RecipeLineDraft, err error) {
+	text := lineBulletRegexp.ReplaceAllString(strings.TrimSpace(line), "")
+	text = parenthesesRegexp.ReplaceAllString(text, "")
+	if i := strings.Index(text, ","); i >= 0 && !amountRegexp.MatchString(text[i+1:]) {
+		text = text[:i]
+	}
+	text = strings.Join(strings.Fields(text), " ")
+
+	if match := amountRegexp.FindStringSubmatch(text); match != nil {
+		draft.Amount = parseAmount(match[1])
+		text = strings.TrimSpace(text[len(match[0]):])
+
+		draft.Unit, text = splitUnit(catalogue, text)
+	}
+
+	text = strings.TrimSpace(strings.TrimPrefix(text, "of "))
+	if text == "" {
+		return draft, fmt.Errorf("%w %q", ErrInvalidIngredientLine, line)
+	}
+	draft.Ingredient = text
+
+	return draft, nil
+}
+
+// splitUnit splits the catalogue unit the text starts with, a unit may be glued to the amount as in "200g",
+// two word units like "fl oz" win over single word ones
+func splitUnit(catalogue *Catalogue, text string) (unit string, rest string) {
+	words := strings.Fields(text)
+
+	for count := 2; count >= 1; count-- {
+		if len(words) < count {
+			continue
+		}
+
+		if found, ok := catalogue.Lookup(strings.Join(words[:count], " ")); ok {
+			return found.Name, strings.Join(words[count:], " ")
+		}
+	}
+
+	return "", text
+}
+
+func parseAmount(text string) float64 {
+	text = strings.ReplaceAll(text, ",", ".")
+
+	var amount float64
+	for _, part := range strings.Fields(text) {
+		if numerator, denominator, ok := strings.Cut(part, "/"); ok {
+			n, _ := strconv.ParseFloat(numerator, 64)
+			d, _ := strconv.ParseFloat(denominator, 64)
+			if d != 0 {
+				amount += n / d
+			}
+			continue
+		}
+
+		for r, value := range vulgarFractions {
+			if strings.HasSuffix(part, string(r)) {
+				part = strings.TrimSuffix(part, string(r))
+				amount += value
+				break
+			}
+		}
+
+		if part != "" {
+			value, _ := strconv.ParseFloat(part, 64)
+			amount += value
+		}
+	}
+
+	return amount
+}
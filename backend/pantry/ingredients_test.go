@@ -0,0 +1,57 @@
+package pantry
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+func TestParseIngredientLine(t *testing.T) {
+	catalogue := testCatalogue()
+
+	tests := []struct {
+		name    string
+		line    string
+		want    store.RecipeLineDraft
+		wantErr error
+	}{
+		{name: "amount, unit and name", line: "200 g flour", want: store.RecipeLineDraft{Ingredient: "flour", Amount: 200, Unit: "g"}},
+		{name: "unit glued to amount", line: "1.5kg potatoes", want: store.RecipeLineDraft{Ingredient: "potatoes", Amount: 1.5, Unit: "kg"}},
+		{name: "decimal comma", line: "0,5 l milk", want: store.RecipeLineDraft{Ingredient: "milk", Amount: 0.5, Unit: "l"}},
+		{name: "unit alias", line: "2 tablespoons olive oil", want: store.RecipeLineDraft{Ingredient: "olive oil", Amount: 2, Unit: "tbsp"}},
+		{name: "two word unit", line: "4 fl oz cream", want: store.RecipeLineDraft{Ingredient: "cream", Amount: 4, Unit: "fl oz"}},
+		{name: "fraction", line: "1/2 cup sugar", want: store.RecipeLineDraft{Ingredient: "sugar", Amount: 0.5, Unit: "cup"}},
+		{name: "mixed number", line: "1 1/2 tsp salt", want: store.RecipeLineDraft{Ingredient: "salt", Amount: 1.5, Unit: "tsp"}},
+		{name: "vulgar fraction", line: "1½ cups rice", want: store.RecipeLineDraft{Ingredient: "rice", Amount: 1.5, Unit: "cup"}},
+		{name: "range keeps lower bound", line: "2-3 cloves garlic", want: store.RecipeLineDraft{Ingredient: "cloves garlic", Amount: 2}},
+		{name: "without unit", line: "2 tomatoes", want: store.RecipeLineDraft{Ingredient: "tomatoes", Amount: 2}},
+		{name: "bullet and notes", line: "• 400 g tomatoes (canned), chopped", want: store.RecipeLineDraft{Ingredient: "tomatoes", Amount: 400, Unit: "g"}},
+		{name: "of after unit", line: "1 cup of milk", want: store.RecipeLineDraft{Ingredient: "milk", Amount: 1, Unit: "cup"}},
+		{name: "unit without name", line: "2 cups", wantErr: ErrInvalidIngredientLine},
+		{name: "without amount", line: "Salt and pepper", want: store.RecipeLineDraft{Ingredient: "Salt and pepper"}},
+		{name: "amount only", line: "200 g", wantErr: ErrInvalidIngredientLine},
+		{name: "empty line", line: " - ", wantErr: ErrInvalidIngredientLine},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseIngredientLine(catalogue, tt.line)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Ingredient != tt.want.Ingredient || got.Unit != tt.want.Unit || math.Abs(got.Amount-tt.want.Amount) > 1e-6 {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
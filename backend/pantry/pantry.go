@@ -1,11 +1,22 @@
 package pantry
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"strings"
+	"time"
 
 	"github.com/rjxby/eat-repeat/backend/store"
 )
 
+// Error messages
+var (
+	ErrInvalidPantryItem = fmt.Errorf("invalid pantry item: %w", store.ErrInvalid)
+)
+
 // PantryProc creates and save recipes
 type PantryProc struct {
 	engine Engine
@@ -18,11 +29,17 @@ func New(engine Engine) *PantryProc {
 	}
 }
 
-// Engine defines interface to save and load ingredients
+// Engine defines interface to save and load ingredients and their pantry stock
 type Engine interface {
 	GetIngredients() (result *store.Ingredients, err error)
+	GetIngredient(id uint) (result *store.IngredientV1, err error)
 	GetUnits() (result *[]store.UnitV1, err error)
 	SaveIngredient(ingredient *store.IngredientV1) (err error)
+	LoadPantry() (result *[]store.PantryV1, err error)
+	GetPantryStock(ingredientID uint) (result *store.PantryV1, err error)
+	AddPantryStock(ingredient *store.IngredientV1, amount float64) (err error)
+	UpdatePantryStock(ingredient *store.IngredientV1, amount float64) (err error)
+	DeletePantryStock(ingredientID uint) (err error)
 }
 
 func (p PantryProc) GetIngredients() (ingredients *store.Ingredients, err error) {
@@ -59,3 +76,192 @@ func (p PantryProc) SaveIngredient(ingredient *store.IngredientV1) (err error) {
 
 	return nil
 }
+
+// GetPantry lists all ingredients with their pantry stock, ingredients out of the pantry have zero amount
+func (p PantryProc) GetPantry() (items *[]store.PantryItem, err error) {
+	ingredients, err := p.engine.GetIngredients()
+	if err != nil {
+		return nil, err
+	}
+
+	stock, err := p.engine.LoadPantry()
+	if err != nil {
+		return nil, err
+	}
+
+	amounts := make(map[uint]float64)
+	for _, entry := range *stock {
+		amounts[entry.IngredientV1ID] = entry.Amount
+	}
+
+	result := []store.PantryItem{}
+	for _, ingredient := range ingredients.Ingredients {
+		amount, inStock := amounts[ingredient.ID]
+		result = append(result, store.PantryItem{Ingredient: ingredient, Amount: amount, InStock: inStock})
+	}
+
+	return &result, nil
+}
+
+// GetPantryItem loads an ingredient with its pantry stock
+func (p PantryProc) GetPantryItem(ingredientID uint) (item *store.PantryItem, err error) {
+	ingredient, err := p.engine.GetIngredient(ingredientID)
+	if err != nil {
+		return nil, err
+	}
+
+	item = &store.PantryItem{Ingredient: *ingredient}
+
+	stock, err := p.engine.GetPantryStock(ingredientID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	if stock != nil {
+		item.Amount = stock.Amount
+		item.InStock = true
+	}
+
+	return item, nil
+}
+
+// AddToPantry adds the draft amount to the ingredient stock, unknown ingredients are created with the draft unit
+func (p PantryProc) AddToPantry(draft store.PantryDraft) (item *store.PantryItem, err error) {
+	name, err := validatePantryDraft(draft)
+	if err != nil {
+		return nil, err
+	}
+
+	catalogue, err := p.GetCatalogue()
+	if err != nil {
+		return nil, err
+	}
+
+	ingredients, err := p.engine.GetIngredients()
+	if err != nil {
+		return nil, err
+	}
+
+	var ingredient *store.IngredientV1
+	for i := range ingredients.Ingredients {
+		if strings.EqualFold(ingredients.Ingredients[i].Name, name) {
+			ingredient = &ingredients.Ingredients[i]
+			break
+		}
+	}
+
+	amount := draft.Amount
+	if ingredient == nil {
+		if strings.TrimSpace(draft.Unit) == "" {
+			return nil, fmt.Errorf("%w: unit is required for new ingredient %s", ErrInvalidPantryItem, name)
+		}
+
+		unit, ok := catalogue.Lookup(draft.Unit)
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownUnit, draft.Unit)
+		}
+
+		ingredient = &store.IngredientV1{Name: name, UnitID: unit.ID, Density: draft.Density, CreatedAt: time.Now().UTC()}
+	} else {
+		if draft.Density.Valid {
+			ingredient.Density = draft.Density
+		}
+
+		amount, err = catalogue.ConvertToIngredientUnit(draft.Amount, draft.Unit, *ingredient)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.engine.AddPantryStock(ingredient, amount); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] %v of ingredient %d is added to the pantry", amount, ingredient.ID)
+
+	return p.GetPantryItem(ingredient.ID)
+}
+
+// UpdatePantryItem renames the ingredient and sets its stock to the draft amount converted to the ingredient unit
+func (p PantryProc) UpdatePantryItem(ingredientID uint, draft store.PantryDraft) (item *store.PantryItem, err error) {
+	name, err := validatePantryDraft(draft)
+	if err != nil {
+		return nil, err
+	}
+
+	ingredient, err := p.engine.GetIngredient(ingredientID)
+	if err != nil {
+		return nil, err
+	}
+
+	catalogue, err := p.GetCatalogue()
+	if err != nil {
+		return nil, err
+	}
+
+	// the amount is converted with the new density
+	ingredient.Density = draft.Density
+
+	amount, err := catalogue.ConvertToIngredientUnit(draft.Amount, draft.Unit, *ingredient)
+	if err != nil {
+		return nil, err
+	}
+
+	ingredient.Name = name
+	ingredient.UpdatedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+
+	if err := p.engine.UpdatePantryStock(ingredient, amount); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] pantry stock of ingredient %d is set to %v", ingredientID, amount)
+
+	return p.GetPantryItem(ingredientID)
+}
+
+// DeletePantryItem removes the ingredient stock from the pantry, the ingredient is kept for recipes
+func (p PantryProc) DeletePantryItem(ingredientID uint) (err error) {
+	if err := p.engine.DeletePantryStock(ingredientID); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] ingredient %d is removed from the pantry", ingredientID)
+
+	return nil
+}
+
+func validatePantryDraft(draft store.PantryDraft) (name string, err error) {
+	name = strings.TrimSpace(draft.Ingredient)
+	if name == "" {
+		return "", fmt.Errorf("%w: ingredient is required", ErrInvalidPantryItem)
+	}
+
+	if draft.Amount < 0 {
+		return "", fmt.Errorf("%w: amount of %s can't be negative", ErrInvalidPantryItem, name)
+	}
+
+	if draft.Density.Valid && !(draft.Density.Float64 > 0 && !math.IsInf(draft.Density.Float64, 0)) {
+		return "", fmt.Errorf("%w: density of %s should be positive", ErrInvalidPantryItem, name)
+	}
+
+	return name, nil
+}
+
+// GetCatalogue loads the unit catalogue to convert amounts
+func (p PantryProc) GetCatalogue() (catalogue *Catalogue, err error) {
+	units, err := p.engine.GetUnits()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCatalogue(*units), nil
+}
+
+// Convert converts an amount between units by their names or aliases
+func (p PantryProc) Convert(amount float64, from string, to string) (result float64, err error) {
+	catalogue, err := p.GetCatalogue()
+	if err != nil {
+		return 0, err
+	}
+
+	return catalogue.Convert(amount, from, to)
+}
@@ -0,0 +1,236 @@
+package pantry
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// pantryEngine keeps ingredients and their stock in memory, units are the default ones
+type pantryEngine struct {
+	Engine
+
+	units       []store.UnitV1
+	ingredients map[uint]store.IngredientV1
+	stock       map[uint]float64
+}
+
+func newPantryEngine() *pantryEngine {
+	units := store.DefaultUnits()
+	for i := range units {
+		units[i].ID = uint(i + 1)
+	}
+
+	engine := &pantryEngine{units: units, ingredients: map[uint]store.IngredientV1{}, stock: map[uint]float64{}}
+	engine.ingredients[1] = store.IngredientV1{ID: 1, Name: "Flour", UnitID: engine.unit("g").ID, Unit: engine.unit("g")}
+	engine.ingredients[2] = store.IngredientV1{ID: 2, Name: "Egg", UnitID: engine.unit("pcs").ID, Unit: engine.unit("pcs")}
+	engine.stock[1] = 300
+
+	return engine
+}
+
+func (e *pantryEngine) unit(name string) store.UnitV1 {
+	for _, unit := range e.units {
+		if unit.Name == name {
+			return unit
+		}
+	}
+	return store.UnitV1{}
+}
+
+func (e *pantryEngine) GetUnits() (*[]store.UnitV1, error) {
+	return &e.units, nil
+}
+
+func (e *pantryEngine) GetIngredients() (*store.Ingredients, error) {
+	result := store.Ingredients{}
+	for id := uint(1); id <= uint(len(e.ingredients)); id++ {
+		result.Ingredients = append(result.Ingredients, e.ingredients[id])
+	}
+	return &result, nil
+}
+
+func (e *pantryEngine) GetIngredient(id uint) (*store.IngredientV1, error) {
+	ingredient, ok := e.ingredients[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &ingredient, nil
+}
+
+func (e *pantryEngine) GetPantryStock(ingredientID uint) (*store.PantryV1, error) {
+	amount, ok := e.stock[ingredientID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &store.PantryV1{IngredientV1ID: ingredientID, Amount: amount}, nil
+}
+
+func (e *pantryEngine) AddPantryStock(ingredient *store.IngredientV1, amount float64) error {
+	if ingredient.ID == 0 {
+		ingredient.ID = uint(len(e.ingredients) + 1)
+		for _, unit := range e.units {
+			if unit.ID == ingredient.UnitID {
+				ingredient.Unit = unit
+			}
+		}
+	}
+	e.ingredients[ingredient.ID] = *ingredient
+	e.stock[ingredient.ID] += amount
+	return nil
+}
+
+func (e *pantryEngine) UpdatePantryStock(ingredient *store.IngredientV1, amount float64) error {
+	if _, ok := e.ingredients[ingredient.ID]; !ok {
+		return store.ErrNotFound
+	}
+	e.ingredients[ingredient.ID] = *ingredient
+	e.stock[ingredient.ID] = amount
+	return nil
+}
+
+func (e *pantryEngine) DeletePantryStock(ingredientID uint) error {
+	if _, ok := e.stock[ingredientID]; !ok {
+		return store.ErrNotFound
+	}
+	delete(e.stock, ingredientID)
+	return nil
+}
+
+func density(value float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: value, Valid: true}
+}
+
+func TestAddToPantry(t *testing.T) {
+	tests := []struct {
+		name       string
+		draft      store.PantryDraft
+		wantErr    error
+		wantID     uint
+		wantUnit   string
+		wantAmount float64
+	}{
+		{name: "known ingredient in other unit", draft: store.PantryDraft{Ingredient: "flour", Amount: 0.5, Unit: "kg"},
+			wantID: 1, wantUnit: "g", wantAmount: 800},
+		{name: "known ingredient in unit alias", draft: store.PantryDraft{Ingredient: "Flour", Amount: 1, Unit: "pound"},
+			wantID: 1, wantUnit: "g", wantAmount: 753.59237},
+		{name: "known ingredient without unit", draft: store.PantryDraft{Ingredient: " Egg ", Amount: 6},
+			wantID: 2, wantUnit: "pcs", wantAmount: 6},
+		{name: "known ingredient in volume with density", draft: store.PantryDraft{Ingredient: "Flour", Amount: 2, Unit: "cups", Density: density(0.5)},
+			wantID: 1, wantUnit: "g", wantAmount: 536.5882365},
+		{name: "known ingredient in volume without density", draft: store.PantryDraft{Ingredient: "Flour", Amount: 2, Unit: "cups"},
+			wantErr: ErrIncompatibleUnits},
+		{name: "new ingredient", draft: store.PantryDraft{Ingredient: " Milk ", Amount: 2, Unit: "litres"},
+			wantID: 3, wantUnit: "l", wantAmount: 2},
+		{name: "new ingredient without unit", draft: store.PantryDraft{Ingredient: "Milk", Amount: 2},
+			wantErr: ErrInvalidPantryItem},
+		{name: "new ingredient of unknown unit", draft: store.PantryDraft{Ingredient: "Milk", Amount: 2, Unit: "jug"},
+			wantErr: ErrUnknownUnit},
+		{name: "negative amount", draft: store.PantryDraft{Ingredient: "Flour", Amount: -1, Unit: "g"},
+			wantErr: ErrInvalidPantryItem},
+		{name: "negative density", draft: store.PantryDraft{Ingredient: "Flour", Amount: 1, Unit: "cup", Density: density(-1)},
+			wantErr: ErrInvalidPantryItem},
+		{name: "no ingredient", draft: store.PantryDraft{Ingredient: " ", Amount: 1, Unit: "g"},
+			wantErr: ErrInvalidPantryItem},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newPantryEngine()
+
+			item, err := New(engine).AddToPantry(tt.draft)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				if engine.stock[1] != 300 || len(engine.stock) != 1 {
+					t.Fatalf("expected stock unchanged, got %v", engine.stock)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if item.Ingredient.ID != tt.wantID || item.Ingredient.Unit.Name != tt.wantUnit || !item.InStock ||
+				math.Abs(item.Amount-tt.wantAmount) > 1e-9 {
+				t.Fatalf("expected ingredient %d with %v %s in stock, got %d with %v %s (in stock %t)",
+					tt.wantID, tt.wantAmount, tt.wantUnit, item.Ingredient.ID, item.Amount, item.Ingredient.Unit.Name, item.InStock)
+			}
+		})
+	}
+}
+
+func TestUpdatePantryItem(t *testing.T) {
+	tests := []struct {
+		name         string
+		ingredientID uint
+		draft        store.PantryDraft
+		wantErr      error
+		wantName     string
+		wantAmount   float64
+	}{
+		{name: "stock in other unit", ingredientID: 1, draft: store.PantryDraft{Ingredient: "Flour", Amount: 1.5, Unit: "kg"},
+			wantName: "Flour", wantAmount: 1500},
+		{name: "renamed ingredient", ingredientID: 1, draft: store.PantryDraft{Ingredient: " Rye flour ", Amount: 200},
+			wantName: "Rye flour", wantAmount: 200},
+		{name: "ingredient out of the pantry", ingredientID: 2, draft: store.PantryDraft{Ingredient: "Egg", Amount: 1, Unit: "dozen"},
+			wantName: "Egg", wantAmount: 12},
+		{name: "stock in volume with density", ingredientID: 1, draft: store.PantryDraft{Ingredient: "Flour", Amount: 100, Unit: "ml", Density: density(0.6)},
+			wantName: "Flour", wantAmount: 60},
+		{name: "stock in incompatible unit", ingredientID: 2, draft: store.PantryDraft{Ingredient: "Egg", Amount: 100, Unit: "g"},
+			wantErr: ErrIncompatibleUnits},
+		{name: "unknown ingredient", ingredientID: 9, draft: store.PantryDraft{Ingredient: "Milk", Amount: 1},
+			wantErr: store.ErrNotFound},
+		{name: "negative amount", ingredientID: 1, draft: store.PantryDraft{Ingredient: "Flour", Amount: -5},
+			wantErr: ErrInvalidPantryItem},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newPantryEngine()
+
+			item, err := New(engine).UpdatePantryItem(tt.ingredientID, tt.draft)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if item.Ingredient.Name != tt.wantName || math.Abs(item.Amount-tt.wantAmount) > 1e-9 || !item.InStock {
+				t.Fatalf("expected %s with %v in stock, got %s with %v (in stock %t)",
+					tt.wantName, tt.wantAmount, item.Ingredient.Name, item.Amount, item.InStock)
+			}
+		})
+	}
+}
+
+func TestDeletePantryItem(t *testing.T) {
+	engine := newPantryEngine()
+	proc := New(engine)
+
+	if err := proc.DeletePantryItem(1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := engine.stock[1]; ok {
+		t.Fatalf("expected ingredient 1 out of the pantry, got %v", engine.stock)
+	}
+	if _, ok := engine.ingredients[1]; !ok {
+		t.Fatalf("expected ingredient 1 kept for recipes")
+	}
+
+	for _, id := range []uint{1, 2, 9} {
+		if err := proc.DeletePantryItem(id); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("expected error %v of ingredient %d, got %v", store.ErrNotFound, id, err)
+		}
+	}
+}
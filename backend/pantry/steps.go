@@ -0,0 +1,100 @@
+package pantry
+
+import (
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+var (
+	// duration of a step like "15 minutes", "1 h" or "10-12 mins", a range keeps its lower bound
+	stepDurationRegexp = regexp.MustCompile(`(?i)\b(\d+)(?:\s*(?:-|–|to)\s*\d+)?\s*(hours?|hrs?|h|minutes?|mins?|seconds?|secs?)\b`)
+	// durationJoinRegexp is the text between parts of a duration like "1 hour and 20 minutes"
+	durationJoinRegexp = regexp.MustCompile(`(?i)^[\s,]*(?:and)?\s*$`)
+)
+
+// ParseStep makes an instruction step of its text, the first duration of the text is the step timer,
+// ingredients mentioned in the text are linked to the step, steps often name an ingredient by the last
+// word of its name, e.g. "cumin" of "ground cumin"
+func ParseStep(text string, ingredients []store.IngredientV1) store.RecipeStepV1 {
+	step := store.RecipeStepV1{
+		Text:        strings.TrimSpace(text),
+		Ingredients: []store.RecipeStepIngredientV1{},
+	}
+
+	if seconds := stepTimer(step.Text); seconds > 0 {
+		step.TimerInSeconds = sql.NullInt64{Int64: seconds, Valid: true}
+	}
+
+	linked := make(map[uint]bool)
+	for _, ingredient := range ingredients {
+		if ingredient.ID == 0 || linked[ingredient.ID] || !mentionsIngredient(step.Text, ingredient.Name) {
+			continue
+		}
+
+		linked[ingredient.ID] = true
+		step.Ingredients = append(step.Ingredients, store.RecipeStepIngredientV1{IngredientV1ID: ingredient.ID, Ingredient: ingredient})
+	}
+
+	return step
+}
+
+// stepTimer sums the first duration of the text in seconds, parts of a duration follow each other as in "1 h 20 min"
+func stepTimer(text string) int64 {
+	var seconds int64
+	end := -1
+	for _, match := range stepDurationRegexp.FindAllStringSubmatchIndex(text, -1) {
+		if end >= 0 && !durationJoinRegexp.MatchString(text[end:match[0]]) {
+			break
+		}
+
+		value, err := strconv.ParseInt(text[match[2]:match[3]], 10, 64)
+		if err != nil {
+			break
+		}
+
+		switch unit := strings.ToLower(text[match[4]:match[5]]); {
+		case strings.HasPrefix(unit, "h"):
+			seconds += value * 3600
+		case strings.HasPrefix(unit, "m"):
+			seconds += value * 60
+		default:
+			seconds += value
+		}
+		end = match[1]
+	}
+
+	return seconds
+}
+
+func mentionsIngredient(text string, name string) bool {
+	words := strings.Fields(name)
+	if len(words) == 0 {
+		return false
+	}
+
+	return mentions(text, name) || mentions(text, words[len(words)-1])
+}
+
+// mentions tells whether the text mentions the ingredient, singular and plural forms of the name match each other
+func mentions(text string, name string) bool {
+	stem := strings.ToLower(strings.TrimSpace(name))
+	if stem == "" {
+		return false
+	}
+
+	if len(stem) > 3 {
+		if strings.HasSuffix(stem, "es") {
+			stem = strings.TrimSuffix(stem, "es")
+		} else {
+			stem = strings.TrimSuffix(stem, "s")
+		}
+	}
+
+	pattern := `(?i)\b` + regexp.QuoteMeta(stem) + `(?:e?s)?\b`
+	matched, err := regexp.MatchString(pattern, text)
+	return err == nil && matched
+}
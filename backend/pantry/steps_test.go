@@ -0,0 +1,58 @@
+package pantry
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+func TestParseStep(t *testing.T) {
+	ingredients := []store.IngredientV1{
+		{ID: 1, Name: "Tomatoes"},
+		{ID: 2, Name: "Egg"},
+		{ID: 3, Name: "olive oil"},
+		{ID: 4, Name: "Oil"},
+		{ID: 2, Name: "Egg"},
+		{Name: "Pepper"},
+	}
+
+	tests := []struct {
+		name        string
+		text        string
+		timer       int64
+		ingredients []uint
+	}{
+		{name: "without timer and ingredients", text: "Preheat the oven.", ingredients: []uint{}},
+		{name: "minutes", text: "Simmer the tomatoes for 15 minutes.", timer: 900, ingredients: []uint{1}},
+		{name: "hours and minutes", text: "Bake for 1 hour and 20 min, until golden.", timer: 4800, ingredients: []uint{}},
+		{name: "range keeps lower bound", text: "Boil the eggs 8-10 mins.", timer: 480, ingredients: []uint{2}},
+		{name: "only the first duration", text: "Rest 10 minutes, then fry 2 minutes per side in olive oil.", timer: 600, ingredients: []uint{3, 4}},
+		{name: "seconds", text: "Whisk the egg for 30 seconds.", timer: 30, ingredients: []uint{2}},
+		{name: "singular of plural name", text: "Slice a tomato.", ingredients: []uint{1}},
+		{name: "last word of the name", text: "Heat the oil.", ingredients: []uint{3, 4}},
+		{name: "name inside a word", text: "Boil the eggplant.", ingredients: []uint{}},
+		{name: "unsaved ingredients are not linked", text: "Season with pepper.", ingredients: []uint{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := ParseStep(tt.text, ingredients)
+
+			if step.Text != tt.text {
+				t.Errorf("text = %q, want %q", step.Text, tt.text)
+			}
+			if step.TimerInSeconds.Int64 != tt.timer || step.TimerInSeconds.Valid != (tt.timer > 0) {
+				t.Errorf("timer = %+v, want %d", step.TimerInSeconds, tt.timer)
+			}
+
+			linked := []uint{}
+			for _, link := range step.Ingredients {
+				linked = append(linked, link.IngredientV1ID)
+			}
+			if !reflect.DeepEqual(linked, tt.ingredients) {
+				t.Errorf("ingredients = %v, want %v", linked, tt.ingredients)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package pantry
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// CountUnit is the unit of ingredients counted in pieces, lines without a unit are counted in it, e.g. "2 tomatoes"
+const CountUnit = "pcs"
+
+// quarterUnits are the spoon and cup units, their amounts are measured in quarters, e.g. "1/4 tsp"
+var quarterUnits = map[string]bool{"tsp": true, "tbsp": true, "cup": true}
+
+// Error messages
+var (
+	ErrUnknownUnit       = fmt.Errorf("unknown unit: %w", store.ErrInvalid)
+	ErrIncompatibleUnits = fmt.Errorf("incompatible units: %w", store.ErrInvalid)
+)
+
+// Catalogue resolves unit names and aliases and converts amounts between units
+type Catalogue struct {
+	units map[string]store.UnitV1
+	// folded keeps lower case names for case insensitive lookup, exact names win, so "T" and "t" differ
+	folded map[string]store.UnitV1
+}
+
+// NewCatalogue makes Catalogue of units with their aliases
+func NewCatalogue(units []store.UnitV1) *Catalogue {
+	catalogue := &Catalogue{
+		units:  make(map[string]store.UnitV1),
+		folded: make(map[string]store.UnitV1),
+	}
+
+	for _, unit := range units {
+		catalogue.add(unit.Name, unit)
+	}
+
+	// aliases never shadow unit names
+	for _, unit := range units {
+		for _, alias := range unit.Aliases {
+			catalogue.add(alias.Name, unit)
+		}
+	}
+
+	return catalogue
+}
+
+func (c *Catalogue) add(name string, unit store.UnitV1) {
+	name = normalizeUnitName(name)
+
+	if _, ok := c.units[name]; !ok {
+		c.units[name] = unit
+	}
+
+	if _, ok := c.folded[strings.ToLower(name)]; !ok {
+		c.folded[strings.ToLower(name)] = unit
+	}
+}
+
+// Lookup finds a unit by its name or alias
+func (c *Catalogue) Lookup(name string) (unit store.UnitV1, ok bool) {
+	name = normalizeUnitName(name)
+
+	if unit, ok = c.units[name]; ok {
+		return unit, true
+	}
+
+	unit, ok = c.folded[strings.ToLower(name)]
+	return unit, ok
+}
+
+// Convert converts an amount between units of the same dimension
+func (c *Catalogue) Convert(amount float64, from string, to string) (result float64, err error) {
+	return c.ConvertWithDensity(amount, from, to, sql.NullFloat64{})
+}
+
+// ConvertWithDensity converts an amount between units, density (g/ml) allows volume to mass conversion
+func (c *Catalogue) ConvertWithDensity(amount float64, from string, to string, density sql.NullFloat64) (result float64, err error) {
+	fromUnit, ok := c.Lookup(from)
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrUnknownUnit, from)
+	}
+
+	toUnit, ok := c.Lookup(to)
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrUnknownUnit, to)
+	}
+
+	if fromUnit.Name == toUnit.Name {
+		return amount, nil
+	}
+
+	if !isConvertible(fromUnit) || !isConvertible(toUnit) {
+		return 0, fmt.Errorf("%w %q and %q", ErrIncompatibleUnits, fromUnit.Name, toUnit.Name)
+	}
+
+	base := amount * fromUnit.Factor
+
+	switch {
+	case fromUnit.Dimension == toUnit.Dimension:
+	case fromUnit.Dimension == store.UnitDimensionVolume && toUnit.Dimension == store.UnitDimensionMass && hasDensity(density):
+		base = base * density.Float64
+	case fromUnit.Dimension == store.UnitDimensionMass && toUnit.Dimension == store.UnitDimensionVolume && hasDensity(density):
+		base = base / density.Float64
+	default:
+		return 0, fmt.Errorf("%w %q (%s) and %q (%s)", ErrIncompatibleUnits, fromUnit.Name, fromUnit.Dimension, toUnit.Name, toUnit.Dimension)
+	}
+
+	return base / toUnit.Factor, nil
+}
+
+// ConvertToIngredientUnit converts an amount to the unit the ingredient is measured in,
+// empty from unit means the amount is already in the ingredient unit
+func (c *Catalogue) ConvertToIngredientUnit(amount float64, from string, ingredient store.IngredientV1) (result float64, err error) {
+	if from == "" {
+		return amount, nil
+	}
+
+	return c.ConvertWithDensity(amount, from, ingredient.Unit.Name, ingredient.Density)
+}
+
+// LineAmount converts the amount of a recipe ingredient line to the ingredient unit
+func (c *Catalogue) LineAmount(line store.RecipeV1IngredientV1) (result float64, err error) {
+	if line.Unit == nil {
+		return line.Amount, nil
+	}
+
+	return c.ConvertToIngredientUnit(line.Amount, line.Unit.Name, line.Ingredient)
+}
+
+// LineAmounts converts recipe ingredient lines to the ingredient units, a line of a unit which doesn't convert
+// to the ingredient unit is left out with a warning, so cooking and the shopping list leave out the same lines
+func (c *Catalogue) LineAmounts(lines []store.RecipeV1IngredientV1) []store.RecipeV1IngredientV1 {
+	result := []store.RecipeV1IngredientV1{}
+	for _, line := range lines {
+		amount, err := c.LineAmount(line)
+		if err != nil {
+			log.Printf("[WARN] skip %s of recipe %d: %v", line.Ingredient.Name, line.RecipeV1ID, err)
+			continue
+		}
+
+		line.Amount = amount
+		line.UnitID = nil
+		line.Unit = nil
+		result = append(result, line)
+	}
+
+	return result
+}
+
+func isConvertible(unit store.UnitV1) bool {
+	return unit.Dimension != store.UnitDimensionUnknown && unit.Factor > 0
+}
+
+func hasDensity(density sql.NullFloat64) bool {
+	return density.Valid && density.Float64 > 0
+}
+
+// normalizeUnitName trims spaces and trailing dots and collapses inner spaces, e.g. " fl.  oz. " to "fl. oz"
+func normalizeUnitName(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	return strings.TrimSuffix(name, ".")
+}
+
+// ServingFactor is the ratio of the serving portions to the recipe portions ingredient amounts are for
+func ServingFactor(serving store.ServingV1) float64 {
+	if serving.Portions == 0 || serving.Recipe.Portions == 0 {
+		return 1
+	}
+
+	return float64(serving.Portions) / float64(serving.Recipe.Portions)
+}
+
+// ScaleLine scales the amount of a recipe ingredient line and rounds it in the line unit
+func ScaleLine(line store.RecipeV1IngredientV1, factor float64) store.RecipeV1IngredientV1 {
+	if factor == 1 {
+		return line
+	}
+
+	unit := line.Ingredient.Unit
+	if line.Unit != nil {
+		unit = *line.Unit
+	}
+
+	line.Amount = Round(line.Amount*factor, unit)
+	return line
+}
+
+// ScaleServing scales ingredient lines of the serving recipe to the serving portions
+func ScaleServing(serving store.ServingV1) []store.RecipeV1IngredientV1 {
+	factor := ServingFactor(serving)
+
+	lines := []store.RecipeV1IngredientV1{}
+	for _, line := range serving.Recipe.Ingredients {
+		lines = append(lines, ScaleLine(line, factor))
+	}
+
+	return lines
+}
+
+// Round rounds a scaled amount to a precision sensible for the unit: count units up to whole pieces,
+// spoons and cups to quarters, other volume units to whole or one-decimal values, other units by magnitude,
+// a non zero amount never rounds to zero
+func Round(amount float64, unit store.UnitV1) float64 {
+	if amount <= 0 {
+		return amount
+	}
+
+	var step float64
+	switch {
+	case unit.Dimension == store.UnitDimensionCount:
+		// small epsilon keeps 2.0000000001 eggs at 2
+		return math.Max(1, math.Ceil(amount-1e-9))
+	case quarterUnits[unit.Name]:
+		step = 0.25
+	case unit.Dimension == store.UnitDimensionVolume && amount >= 10:
+		step = 1
+	case unit.Dimension == store.UnitDimensionVolume:
+		step = 0.1
+	case unit.Dimension == store.UnitDimensionUnknown:
+		step = 0.25
+	case amount >= 100:
+		step = 5
+	case amount >= 10:
+		step = 1
+	case amount >= 1:
+		step = 0.1
+	default:
+		step = 0.01
+	}
+
+	// rounding to cents drops float noise of the step multiplication
+	return math.Max(step, math.Round(math.Round(amount/step)*step*100)/100)
+}
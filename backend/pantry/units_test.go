@@ -0,0 +1,288 @@
+package pantry
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+func testCatalogue() *Catalogue {
+	units := store.DefaultUnits()
+	units = append(units, store.UnitV1{Name: "clove"})
+	return NewCatalogue(units)
+}
+
+func TestCatalogueConvert(t *testing.T) {
+	catalogue := testCatalogue()
+
+	tests := []struct {
+		name    string
+		amount  float64
+		from    string
+		to      string
+		density sql.NullFloat64
+		want    float64
+		wantErr error
+	}{
+		{name: "same unit", amount: 200, from: "g", to: "g", want: 200},
+		{name: "alias of the same unit", amount: 200, from: "grams", to: "g", want: 200},
+		{name: "kilograms to grams", amount: 1.5, from: "kg", to: "g", want: 1500},
+		{name: "grams to kilograms", amount: 250, from: "g", to: "kg", want: 0.25},
+		{name: "pounds to kilograms", amount: 1, from: "lb", to: "kg", want: 0.45359237},
+		{name: "litres to millilitres", amount: 0.5, from: "l", to: "ml", want: 500},
+		{name: "upper case litre", amount: 2, from: "L", to: "ml", want: 2000},
+		{name: "capital T is tablespoon", amount: 1, from: "T", to: "tsp", want: 3},
+		{name: "small t is teaspoon", amount: 3, from: "t", to: "tbsp", want: 1},
+		{name: "case insensitive name", amount: 2, from: "TBSP", to: "tsp", want: 6},
+		{name: "trailing dot and spaces", amount: 2, from: " tbsp. ", to: "tsp", want: 6},
+		{name: "fluid ounce is volume", amount: 1, from: "fl  oz", to: "ml", want: 29.5735295625},
+		{name: "cup to tablespoons", amount: 1, from: "cup", to: "tbsp", want: 16},
+		{name: "dozen to pieces", amount: 2, from: "dozen", to: "pcs", want: 24},
+		{name: "unknown dimension to itself", amount: 3, from: "clove", to: "clove", want: 3},
+		{name: "volume to mass with density", amount: 1, from: "cup", to: "g", density: sql.NullFloat64{Float64: 0.53, Valid: true}, want: 125.3917653},
+		{name: "mass to volume with density", amount: 92, from: "g", to: "ml", density: sql.NullFloat64{Float64: 0.92, Valid: true}, want: 100},
+		{name: "ounce is mass, not volume", amount: 1, from: "oz", to: "ml", wantErr: ErrIncompatibleUnits},
+		{name: "volume to mass without density", amount: 1, from: "cup", to: "g", wantErr: ErrIncompatibleUnits},
+		{name: "volume to mass with zero density", amount: 1, from: "cup", to: "g", density: sql.NullFloat64{Float64: 0, Valid: true}, wantErr: ErrIncompatibleUnits},
+		{name: "count to mass even with density", amount: 2, from: "pcs", to: "g", density: sql.NullFloat64{Float64: 1, Valid: true}, wantErr: ErrIncompatibleUnits},
+		{name: "unknown dimension to count", amount: 2, from: "clove", to: "pcs", wantErr: ErrIncompatibleUnits},
+		{name: "unknown unit", amount: 1, from: "handful", to: "g", wantErr: ErrUnknownUnit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := catalogue.ConvertWithDensity(tt.amount, tt.from, tt.to, tt.density)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				if !errors.Is(err, store.ErrInvalid) {
+					t.Fatalf("expected error %v to be invalid data", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if math.Abs(got-tt.want) > 1e-6 {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCatalogueLineAmount(t *testing.T) {
+	catalogue := testCatalogue()
+
+	kg, _ := catalogue.Lookup("kg")
+	g, _ := catalogue.Lookup("g")
+	cup, _ := catalogue.Lookup("cup")
+
+	flour := store.IngredientV1{Name: "Flour", Unit: g, Density: sql.NullFloat64{Float64: 0.53, Valid: true}}
+
+	tests := []struct {
+		name string
+		line store.RecipeV1IngredientV1
+		want float64
+	}{
+		{name: "line without unit is in ingredient unit", line: store.RecipeV1IngredientV1{Ingredient: flour, Amount: 200}, want: 200},
+		{name: "line in other mass unit", line: store.RecipeV1IngredientV1{Ingredient: flour, Amount: 0.5, Unit: &kg}, want: 500},
+		{name: "line in volume unit uses ingredient density", line: store.RecipeV1IngredientV1{Ingredient: flour, Amount: 2, Unit: &cup}, want: 250.7835307},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := catalogue.LineAmount(tt.line)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if math.Abs(got-tt.want) > 1e-6 {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCatalogueLineAmounts(t *testing.T) {
+	catalogue := testCatalogue()
+
+	kg, _ := catalogue.Lookup("kg")
+	g, _ := catalogue.Lookup("g")
+	cup, _ := catalogue.Lookup("cup")
+	pcs, _ := catalogue.Lookup("pcs")
+
+	flour := store.IngredientV1{ID: 1, Name: "Flour", Unit: g}
+	egg := store.IngredientV1{ID: 2, Name: "Egg", Unit: pcs}
+
+	lines := []store.RecipeV1IngredientV1{
+		{IngredientV1ID: 1, Ingredient: flour, Amount: 0.5, UnitID: &kg.ID, Unit: &kg},
+		// flour without density doesn't convert from cups, the line is left out
+		{IngredientV1ID: 1, Ingredient: flour, Amount: 1, UnitID: &cup.ID, Unit: &cup},
+		{IngredientV1ID: 2, Ingredient: egg, Amount: 3},
+	}
+
+	got := catalogue.LineAmounts(lines)
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 lines, got %+v", got)
+	}
+	for i, want := range []struct {
+		ingredientID uint
+		amount       float64
+	}{{ingredientID: 1, amount: 500}, {ingredientID: 2, amount: 3}} {
+		if got[i].IngredientV1ID != want.ingredientID || got[i].Amount != want.amount || got[i].Unit != nil || got[i].UnitID != nil {
+			t.Errorf("line %d: expected %v of ingredient %d in its unit, got %+v", i, want.amount, want.ingredientID, got[i])
+		}
+	}
+	if lines[0].Amount != 0.5 || lines[0].Unit == nil {
+		t.Errorf("source line is changed: %+v", lines[0])
+	}
+}
+
+func TestCatalogueAliasesDoNotShadowNames(t *testing.T) {
+	catalogue := NewCatalogue([]store.UnitV1{
+		{Name: "c", Dimension: store.UnitDimensionCount, Factor: 1},
+		{Name: "cup", Dimension: store.UnitDimensionVolume, Factor: 236.5882365, Aliases: []store.UnitAliasV1{{Name: "c"}}},
+	})
+
+	unit, ok := catalogue.Lookup("c")
+	if !ok {
+		t.Fatal("expected unit c to be found")
+	}
+	if unit.Name != "c" {
+		t.Fatalf("expected unit name to win over alias, got %s", unit.Name)
+	}
+}
+
+func TestRound(t *testing.T) {
+	catalogue := testCatalogue()
+
+	tests := []struct {
+		name   string
+		amount float64
+		unit   string
+		want   float64
+	}{
+		{name: "zero is kept", amount: 0, unit: "g", want: 0},
+		{name: "negative is kept", amount: -1.234, unit: "g", want: -1.234},
+		{name: "pieces up to whole pieces", amount: 1.2, unit: "pcs", want: 2},
+		{name: "float noise of pieces", amount: 2.0000000001, unit: "pcs", want: 2},
+		{name: "part of a piece is a piece", amount: 0.3, unit: "pcs", want: 1},
+		{name: "spoons to quarters", amount: 1.1, unit: "tbsp", want: 1},
+		{name: "cups to quarters", amount: 0.7, unit: "cup", want: 0.75},
+		{name: "small spoon amount is a quarter", amount: 0.05, unit: "tsp", want: 0.25},
+		{name: "unknown dimension to quarters", amount: 1.6, unit: "clove", want: 1.5},
+		{name: "hundreds to fives", amount: 123, unit: "g", want: 125},
+		{name: "tens to whole", amount: 12.4, unit: "g", want: 12},
+		{name: "ones to tenths", amount: 1.26, unit: "l", want: 1.3},
+		{name: "millilitres to tenths", amount: 7.54, unit: "ml", want: 7.5},
+		{name: "centilitres to tenths", amount: 3.3, unit: "cl", want: 3.3},
+		{name: "decilitres to tenths", amount: 1.125, unit: "dl", want: 1.1},
+		{name: "fluid ounces to tenths", amount: 1.33, unit: "fl oz", want: 1.3},
+		{name: "hundreds of millilitres to whole", amount: 123.4, unit: "ml", want: 123},
+		{name: "tens of centilitres to whole", amount: 12.6, unit: "cl", want: 13},
+		{name: "tiny volume is a tenth", amount: 0.02, unit: "l", want: 0.1},
+		{name: "fractions to hundredths", amount: 0.123, unit: "kg", want: 0.12},
+		{name: "tiny amount is a hundredth", amount: 0.001, unit: "kg", want: 0.01},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unit, ok := catalogue.Lookup(tt.unit)
+			if !ok {
+				t.Fatalf("unknown unit %s", tt.unit)
+			}
+
+			if got := Round(tt.amount, unit); math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestScaleLine(t *testing.T) {
+	catalogue := testCatalogue()
+
+	g, _ := catalogue.Lookup("g")
+	pcs, _ := catalogue.Lookup("pcs")
+
+	flour := store.IngredientV1{Name: "Flour", Unit: g}
+
+	tests := []struct {
+		name   string
+		line   store.RecipeV1IngredientV1
+		factor float64
+		want   float64
+	}{
+		{name: "same portions keep the amount", line: store.RecipeV1IngredientV1{Ingredient: flour, Amount: 123.4}, factor: 1, want: 123.4},
+		{name: "double in ingredient unit", line: store.RecipeV1IngredientV1{Ingredient: flour, Amount: 150}, factor: 2, want: 300},
+		{name: "rounded in ingredient unit", line: store.RecipeV1IngredientV1{Ingredient: flour, Amount: 82}, factor: 1.5, want: 125},
+		{name: "rounded in line unit", line: store.RecipeV1IngredientV1{Ingredient: flour, Amount: 1, Unit: &pcs}, factor: 1.5, want: 2},
+		{name: "half rounded to whole grams", line: store.RecipeV1IngredientV1{Ingredient: flour, Amount: 25}, factor: 0.5, want: 13},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ScaleLine(tt.line, tt.factor)
+
+			if math.Abs(got.Amount-tt.want) > 1e-9 {
+				t.Fatalf("expected %v, got %v", tt.want, got.Amount)
+			}
+			if got.Unit != tt.line.Unit || got.Ingredient.Name != tt.line.Ingredient.Name {
+				t.Fatalf("expected only the amount to change, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestScaleServing(t *testing.T) {
+	catalogue := testCatalogue()
+
+	g, _ := catalogue.Lookup("g")
+	pcs, _ := catalogue.Lookup("pcs")
+
+	recipe := store.RecipeV1{
+		Portions: 2,
+		Ingredients: []store.RecipeV1IngredientV1{
+			{Ingredient: store.IngredientV1{Name: "Flour", Unit: g}, Amount: 200},
+			{Ingredient: store.IngredientV1{Name: "Egg", Unit: pcs}, Amount: 1},
+		},
+	}
+	unknownPortions := recipe
+	unknownPortions.Portions = 0
+
+	tests := []struct {
+		name    string
+		serving store.ServingV1
+		want    []float64
+	}{
+		{name: "more portions", serving: store.ServingV1{Portions: 3, Recipe: recipe}, want: []float64{300, 2}},
+		{name: "less portions", serving: store.ServingV1{Portions: 1, Recipe: recipe}, want: []float64{100, 1}},
+		{name: "recipe portions", serving: store.ServingV1{Portions: 2, Recipe: recipe}, want: []float64{200, 1}},
+		{name: "serving without portions is of recipe portions", serving: store.ServingV1{Recipe: recipe}, want: []float64{200, 1}},
+		{name: "recipe without portions", serving: store.ServingV1{Portions: 4, Recipe: unknownPortions}, want: []float64{200, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := ScaleServing(tt.serving)
+
+			got := []float64{}
+			for _, line := range lines {
+				got = append(got, line.Amount)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			if recipe.Ingredients[0].Amount != 200 {
+				t.Fatalf("recipe lines are changed: %+v", recipe.Ingredients)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package scheduler
 
 import (
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/rjxby/eat-repeat/backend/store"
@@ -9,14 +11,31 @@ import (
 
 const DayFormat = "2006-01-02"
 const DayTitleFormat = "January 02, Monday"
+const MealTimeFormat = "15:04"
+
+// Error messages
+var (
+	ErrInvalidMealSlot = fmt.Errorf("invalid meal slot: %w", store.ErrInvalid)
+)
 
 // ScheduleProc creates and save schedules
 type ScheduleProc struct {
+	engine Engine
 }
 
 // New makes ScheduleProc
-func New() *ScheduleProc {
-	return &ScheduleProc{}
+func New(engine Engine) *ScheduleProc {
+	return &ScheduleProc{
+		engine: engine,
+	}
+}
+
+// Engine defines interface to save and load meal slots
+type Engine interface {
+	LoadMealSlots() (result *[]store.MealSlotV1, err error)
+	GetMealSlot(id uint) (result *store.MealSlotV1, err error)
+	SaveMealSlot(mealSlot *store.MealSlotV1) (err error)
+	DeleteMealSlot(id uint) (err error)
 }
 
 func generateWeek(offsetInDays int) (week *store.Week, err error) {
@@ -33,6 +52,7 @@ func generateWeek(offsetInDays int) (week *store.Week, err error) {
 			ID:           day.Format(DayFormat),
 			Title:        day.Format(DayTitleFormat),
 			IsCurrentDay: day.Format(DayFormat) == currentTime.Format(DayFormat),
+			Date:         time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC),
 		}
 
 		days = append(days, dayToAdd)
@@ -58,3 +78,63 @@ func (p ScheduleProc) GetWeek() (week *store.Week, err error) {
 func (p ScheduleProc) GetNextWeek() (week *store.Week, err error) {
 	return generateWeek(7)
 }
+
+// ParseDay converts a day ID (see DayFormat) to the date servings are planned for
+func (p ScheduleProc) ParseDay(id string) (day time.Time, err error) {
+	day, err = time.ParseInLocation(DayFormat, id, time.UTC)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return day, nil
+}
+
+func (p ScheduleProc) GetMealSlots() (mealSlots *[]store.MealSlotV1, err error) {
+	mealSlots, err = p.engine.LoadMealSlots()
+	if err != nil {
+		return nil, err
+	}
+
+	return mealSlots, nil
+}
+
+func (p ScheduleProc) GetMealSlot(id uint) (mealSlot *store.MealSlotV1, err error) {
+	mealSlot, err = p.engine.GetMealSlot(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return mealSlot, nil
+}
+
+// SaveMealSlot validates and saves a meal slot, default time is optional and formatted as MealTimeFormat
+func (p ScheduleProc) SaveMealSlot(mealSlot *store.MealSlotV1) (err error) {
+	mealSlot.Name = strings.TrimSpace(mealSlot.Name)
+	if mealSlot.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidMealSlot)
+	}
+
+	if mealSlot.DefaultTime.Valid {
+		if _, err := time.Parse(MealTimeFormat, mealSlot.DefaultTime.String); err != nil {
+			return fmt.Errorf("%w: default time %q is not formatted as %s", ErrInvalidMealSlot, mealSlot.DefaultTime.String, MealTimeFormat)
+		}
+	}
+
+	if err := p.engine.SaveMealSlot(mealSlot); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] meal slot is saved: %v", mealSlot)
+
+	return nil
+}
+
+func (p ScheduleProc) DeleteMealSlot(id uint) (err error) {
+	if err := p.engine.DeleteMealSlot(id); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] meal slot %d is deleted", id)
+
+	return nil
+}
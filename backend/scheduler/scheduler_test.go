@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// mealSlotsEngine keeps saved meal slots in memory
+type mealSlotsEngine struct {
+	Engine
+
+	saved []store.MealSlotV1
+}
+
+func (e *mealSlotsEngine) SaveMealSlot(mealSlot *store.MealSlotV1) error {
+	e.saved = append(e.saved, *mealSlot)
+	return nil
+}
+
+func TestSaveMealSlot(t *testing.T) {
+	tests := []struct {
+		name     string
+		mealSlot store.MealSlotV1
+		wantErr  error
+		wantName string
+	}{
+		{name: "name", mealSlot: store.MealSlotV1{Name: " Brunch "}, wantName: "Brunch"},
+		{name: "default time", mealSlot: store.MealSlotV1{Name: "Dinner", DefaultTime: sql.NullString{String: "19:30", Valid: true}}, wantName: "Dinner"},
+		{name: "no name", mealSlot: store.MealSlotV1{Name: "  "}, wantErr: ErrInvalidMealSlot},
+		{name: "default time of other format", mealSlot: store.MealSlotV1{Name: "Dinner", DefaultTime: sql.NullString{String: "7pm", Valid: true}}, wantErr: ErrInvalidMealSlot},
+		{name: "default time out of day", mealSlot: store.MealSlotV1{Name: "Dinner", DefaultTime: sql.NullString{String: "25:00", Valid: true}}, wantErr: store.ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &mealSlotsEngine{}
+
+			err := New(engine).SaveMealSlot(&tt.mealSlot)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				if len(engine.saved) != 0 {
+					t.Fatalf("expected invalid meal slot not saved, got %+v", engine.saved)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(engine.saved) != 1 || engine.saved[0].Name != tt.wantName {
+				t.Fatalf("expected meal slot %q saved, got %+v", tt.wantName, engine.saved)
+			}
+		})
+	}
+}
+
+func TestParseDay(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "day", id: "2024-02-29", want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "day of other format", id: "29.02.2024", wantErr: true},
+		{name: "day out of month", id: "2023-02-29", wantErr: true},
+		{name: "empty", id: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			day, err := New(nil).ParseDay(tt.id)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %t, got %v", tt.wantErr, err)
+			}
+			if !day.Equal(tt.want) || (!tt.wantErr && day.Location() != time.UTC) {
+				t.Fatalf("expected day %v, got %v", tt.want, day)
+			}
+		})
+	}
+}
+
+func TestGetWeeks(t *testing.T) {
+	proc := New(nil)
+
+	current, err := proc.GetWeek()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	next, err := proc.GetNextWeek()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	days := append(append([]store.Day{}, current.Days...), next.Days...)
+	if len(days) != 14 {
+		t.Fatalf("expected 7 days a week, got %d and %d", len(current.Days), len(next.Days))
+	}
+
+	today := 0
+	for i, day := range days {
+		// servings are planned for days of the week grid, so the day is the one of its ID at midnight UTC
+		parsed, err := proc.ParseDay(day.ID)
+		if err != nil || !parsed.Equal(day.Date) {
+			t.Fatalf("expected day %s at %v, got %v (%v)", day.ID, parsed, day.Date, err)
+		}
+		if i > 0 && !day.Date.Equal(days[i-1].Date.AddDate(0, 0, 1)) {
+			t.Fatalf("expected day %s after %s", day.ID, days[i-1].ID)
+		}
+		if day.IsCurrentDay {
+			today++
+		}
+	}
+
+	if days[0].Date.Weekday() != time.Sunday {
+		t.Fatalf("expected week from Sunday, got %s", days[0].Date.Weekday())
+	}
+	if today != 1 {
+		t.Fatalf("expected one current day, got %d", today)
+	}
+}
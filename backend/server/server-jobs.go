@@ -0,0 +1,117 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+type JobJSON struct {
+	ID         int        `json:"id"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Processed  uint       `json:"processed"`
+	Failed     uint       `json:"failed"`
+	Skipped    uint       `json:"skipped"`
+
+	Items []JobItemJSON `json:"items,omitempty"`
+}
+
+type JobItemJSON struct {
+	RecipeID    int       `json:"recipeId"`
+	RecipeTitle string    `json:"recipeTitle"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// GET /v1/jobs
+func (s Server) getJobsCtrl(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.Worker.GetJobs()
+	if err != nil {
+		renderInternalServerError(w, r, "failed to load jobs", err)
+		return
+	}
+
+	result := []JobJSON{}
+	for _, job := range *jobs {
+		result = append(result, mapJobToJSON(job))
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, result)
+}
+
+// GET /v1/jobs/{id}
+func (s Server) getJobCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid job id", err)
+		return
+	}
+
+	job, err := s.Worker.GetJob(id)
+	if err != nil {
+		renderError(w, r, "failed to load job", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapJobToJSON(*job))
+}
+
+// POST /v1/jobs/{id}/cancel, responds when the job is stopped
+func (s Server) cancelJobCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid job id", err)
+		return
+	}
+
+	job, err := s.Worker.CancelJob(id)
+	if err != nil {
+		renderError(w, r, "failed to cancel job", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapJobToJSON(*job))
+}
+
+func mapJobToJSON(job store.JobV1) JobJSON {
+	result := JobJSON{
+		ID:         int(job.ID),
+		Status:     string(job.Status),
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  mapOptionalTime(job.StartedAt),
+		FinishedAt: mapOptionalTime(job.FinishedAt),
+		Processed:  job.Processed,
+		Failed:     job.Failed,
+		Skipped:    job.Skipped,
+	}
+
+	for _, item := range job.Items {
+		result.Items = append(result.Items, JobItemJSON{
+			RecipeID:    int(item.RecipeID),
+			RecipeTitle: item.RecipeTitle,
+			Status:      string(item.Status),
+			Error:       item.Error,
+			CreatedAt:   item.CreatedAt,
+		})
+	}
+
+	return result
+}
+
+func mapOptionalTime(src sql.NullTime) *time.Time {
+	if src.Valid {
+		value := src.Time
+		return &value
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// fakeWorker keeps the jobs in memory and fails loading them with the error, other methods of the embedded interface aren't used
+type fakeWorker struct {
+	Worker
+	err  error
+	jobs map[uint]store.JobV1
+}
+
+func newFakeWorker(err error) *fakeWorker {
+	started := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	return &fakeWorker{err: err, jobs: map[uint]store.JobV1{
+		1: {ID: 1, Status: store.JobStatusInProgress, CreatedAt: started, StartedAt: sql.NullTime{Time: started, Valid: true},
+			Processed: 1, Failed: 1, Items: []store.JobItemV1{
+				{JobV1ID: 1, RecipeID: 3, RecipeTitle: "Pancakes", Status: store.JobItemStatusFailed, Error: "pdf is not readable", CreatedAt: started},
+			}},
+		2: {ID: 2, Status: store.JobStatusCompleted, CreatedAt: started, Processed: 2},
+	}}
+}
+
+func (w *fakeWorker) GetJobs() (*[]store.JobV1, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	jobs := []store.JobV1{w.jobs[2], w.jobs[1]}
+	return &jobs, nil
+}
+
+func (w *fakeWorker) GetJob(id uint) (*store.JobV1, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	job, ok := w.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("job %d: %w", id, store.ErrNotFound)
+	}
+	return &job, nil
+}
+
+func (w *fakeWorker) CancelJob(id uint) (*store.JobV1, error) {
+	job, err := w.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != store.JobStatusInProgress {
+		return nil, fmt.Errorf("job %d: job is not running: %w", id, store.ErrConflict)
+	}
+	job.Status = store.JobStatusCancelled
+	return job, nil
+}
+
+func TestGetJobs(t *testing.T) {
+	server := Server{Worker: newFakeWorker(nil)}
+
+	response := httptest.NewRecorder()
+	server.routes().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/jobs", nil))
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", response.Code, http.StatusOK, response.Body)
+	}
+
+	var jobs []JobJSON
+	if err := json.Unmarshal(response.Body.Bytes(), &jobs); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != 2 || jobs[1].ID != 1 {
+		t.Fatalf("jobs = %+v, want jobs 2 and 1", jobs)
+	}
+	if jobs[0].StartedAt != nil || jobs[0].Processed != 2 {
+		t.Errorf("job 2 = %+v, want 2 processed without start time", jobs[0])
+	}
+
+	response = httptest.NewRecorder()
+	Server{Worker: newFakeWorker(fmt.Errorf("database is locked"))}.routes().
+		ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/jobs", nil))
+	if response.Code != http.StatusInternalServerError {
+		t.Errorf("status of failed store = %d, want %d", response.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestGetJob(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		err        error
+		wantStatus int
+		wantJob    string
+	}{
+		{name: "job", method: http.MethodGet, path: "/api/v1/jobs/1", wantStatus: http.StatusOK,
+			wantJob: "1 in_progress 1/1/0 started, item 3 Pancakes failed: pdf is not readable"},
+		{name: "unknown job", method: http.MethodGet, path: "/api/v1/jobs/9", wantStatus: http.StatusNotFound},
+		{name: "job of invalid id", method: http.MethodGet, path: "/api/v1/jobs/first", wantStatus: http.StatusBadRequest},
+		{name: "job rejected by the worker", method: http.MethodGet, path: "/api/v1/jobs/1",
+			err: fmt.Errorf("job id is out of range: %w", store.ErrInvalid), wantStatus: http.StatusUnprocessableEntity},
+		{name: "cancel", method: http.MethodPost, path: "/api/v1/jobs/1/cancel", wantStatus: http.StatusOK,
+			wantJob: "1 cancelled 1/1/0 started, item 3 Pancakes failed: pdf is not readable"},
+		{name: "cancel of unknown job", method: http.MethodPost, path: "/api/v1/jobs/9/cancel", wantStatus: http.StatusNotFound},
+		{name: "cancel of finished job", method: http.MethodPost, path: "/api/v1/jobs/2/cancel", wantStatus: http.StatusConflict},
+		{name: "cancel rejected by the worker", method: http.MethodPost, path: "/api/v1/jobs/1/cancel",
+			err: fmt.Errorf("job id is out of range: %w", store.ErrInvalid), wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := Server{Worker: newFakeWorker(tt.err)}
+
+			response := httptest.NewRecorder()
+			server.routes().ServeHTTP(response, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if response.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", response.Code, tt.wantStatus, response.Body)
+			}
+			if tt.wantJob == "" {
+				return
+			}
+
+			var job JobJSON
+			if err := json.Unmarshal(response.Body.Bytes(), &job); err != nil {
+				t.Fatal(err)
+			}
+			if got := jobText(job); got != tt.wantJob {
+				t.Errorf("job = %q, want %q", got, tt.wantJob)
+			}
+		})
+	}
+}
+
+// jobText is the job status, counts of processed/failed/skipped recipes and its items
+func jobText(job JobJSON) string {
+	text := fmt.Sprintf("%d %s %d/%d/%d", job.ID, job.Status, job.Processed, job.Failed, job.Skipped)
+	if job.StartedAt != nil {
+		text += " started"
+	}
+	for _, item := range job.Items {
+		text += fmt.Sprintf(", item %d %s %s: %s", item.RecipeID, item.RecipeTitle, item.Status, item.Error)
+	}
+	return text
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+type PlanNutritionJSON struct {
+	From            string              `json:"from"`
+	To              string              `json:"to"`
+	Total           NutritionTotalsJSON `json:"total"`
+	DailyAverage    NutritionTotalsJSON `json:"dailyAverage"`
+	MissingServings uint                `json:"missingServings"`
+
+	Weeks []WeekNutritionJSON `json:"weeks"`
+	Days  []DayNutritionJSON  `json:"days"`
+}
+
+type WeekNutritionJSON struct {
+	Year         int                 `json:"year"`
+	Number       int                 `json:"number"`
+	Days         uint                `json:"days"`
+	Total        NutritionTotalsJSON `json:"total"`
+	DailyAverage NutritionTotalsJSON `json:"dailyAverage"`
+}
+
+type DayNutritionJSON struct {
+	Day      string              `json:"day"`
+	Servings uint                `json:"servings"`
+	Total    NutritionTotalsJSON `json:"total"`
+}
+
+type NutritionTotalsJSON struct {
+	Calories float64 `json:"calories"`
+	Carbs    float64 `json:"carbs"`
+	Protein  float64 `json:"protein"`
+	Fat      float64 `json:"fat"`
+	Fibre    float64 `json:"fibre"`
+	Sugar    float64 `json:"sugar"`
+	Salt     float64 `json:"salt"`
+}
+
+// GET /v1/plan/nutrition?from=&to=, the current week when the range is not set
+func (s Server) getPlanNutritionCtrl(w http.ResponseWriter, r *http.Request) {
+	from, to, err := s.parseDateRange(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid date range", err)
+		return
+	}
+
+	if !from.Valid {
+		week, err := s.Scheduler.GetWeek()
+		if err != nil {
+			renderInternalServerError(w, r, "failed to generate week", err)
+			return
+		}
+		from.Time = week.Days[0].Date
+		to.Time = week.Days[len(week.Days)-1].Date
+	}
+
+	summary, err := s.Chef.GetPlanNutrition(from.Time, to.Time)
+	if err != nil {
+		renderError(w, r, "failed to summarize plan nutrition", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapNutritionSummaryToJSON(summary))
+}
+
+func mapNutritionSummaryToJSON(summary *store.NutritionSummary) PlanNutritionJSON {
+	result := PlanNutritionJSON{
+		From:            summary.From.Format(time.DateOnly),
+		To:              summary.To.Format(time.DateOnly),
+		Total:           mapNutritionTotalsToJSON(summary.Total),
+		DailyAverage:    mapNutritionTotalsToJSON(summary.DailyAverage),
+		MissingServings: summary.MissingServings,
+		Weeks:           []WeekNutritionJSON{},
+		Days:            []DayNutritionJSON{},
+	}
+
+	for _, week := range summary.Weeks {
+		result.Weeks = append(result.Weeks, WeekNutritionJSON{
+			Year:         week.Year,
+			Number:       week.Number,
+			Days:         week.Days,
+			Total:        mapNutritionTotalsToJSON(week.Total),
+			DailyAverage: mapNutritionTotalsToJSON(week.DailyAverage),
+		})
+	}
+
+	for _, day := range summary.Days {
+		result.Days = append(result.Days, DayNutritionJSON{
+			Day:      day.Date.Format(time.DateOnly),
+			Servings: day.Servings,
+			Total:    mapNutritionTotalsToJSON(day.Total),
+		})
+	}
+
+	return result
+}
+
+// mapNutritionTotalsToJSON rounds the values to two decimals
+func mapNutritionTotalsToJSON(src store.Nutrition) NutritionTotalsJSON {
+	return NutritionTotalsJSON{
+		Calories: roundNutrition(src.Calories),
+		Carbs:    roundNutrition(src.Carbs),
+		Protein:  roundNutrition(src.Protein),
+		Fat:      roundNutrition(src.Fat),
+		Fibre:    roundNutrition(src.Fibre),
+		Sugar:    roundNutrition(src.Sugar),
+		Salt:     roundNutrition(src.Salt),
+	}
+}
+
+func roundNutrition(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/render"
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// PantryItemJSON is an ingredient with its pantry stock in the ingredient unit
+type PantryItemJSON struct {
+	IngredientID int     `json:"ingredientId"`
+	Name         string  `json:"name"`
+	Amount       float64 `json:"amount"`
+	Unit         string  `json:"unit"`
+	// Density in grams per millilitre converts the ingredient between volume and mass
+	Density *float64 `json:"density,omitempty"`
+	InStock bool     `json:"inStock"`
+}
+
+type PantryItemRequestJSON struct {
+	Ingredient string  `json:"ingredient"`
+	Amount     float64 `json:"amount"`
+	Unit       string  `json:"unit,omitempty"`
+	// Density in grams per millilitre, adding stock without it keeps the ingredient density, an update without it clears it
+	Density *float64 `json:"density,omitempty"`
+}
+
+type UnitJSON struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	Dimension string   `json:"dimension,omitempty"`
+	Factor    float64  `json:"factor"`
+	Aliases   []string `json:"aliases"`
+}
+
+type ConversionJSON struct {
+	Amount float64 `json:"amount"`
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Result float64 `json:"result"`
+}
+
+// GET /v1/units
+func (s Server) getUnitsCtrl(w http.ResponseWriter, r *http.Request) {
+	units, err := s.Pantry.GetUnits()
+	if err != nil {
+		renderInternalServerError(w, r, "failed to load units", err)
+		return
+	}
+
+	result := []UnitJSON{}
+	for _, unit := range *units {
+		aliases := []string{}
+		for _, alias := range unit.Aliases {
+			aliases = append(aliases, alias.Name)
+		}
+
+		result = append(result, UnitJSON{
+			ID:        int(unit.ID),
+			Name:      unit.Name,
+			Dimension: string(unit.Dimension),
+			Factor:    unit.Factor,
+			Aliases:   aliases,
+		})
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, result)
+}
+
+// GET /v1/units/convert?amount=&from=&to=
+func (s Server) convertUnitsCtrl(w http.ResponseWriter, r *http.Request) {
+	amount, err := strconv.ParseFloat(r.URL.Query().Get("amount"), 64)
+	if err != nil {
+		renderBadRequest(w, r, "invalid amount parameter", err)
+		return
+	}
+
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+
+	result, err := s.Pantry.Convert(amount, from, to)
+	if err != nil {
+		renderError(w, r, "failed to convert amount", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, ConversionJSON{Amount: amount, From: from, To: to, Result: result})
+}
+
+// GET /v1/pantry
+func (s Server) getPantryCtrl(w http.ResponseWriter, r *http.Request) {
+	items, err := s.Pantry.GetPantry()
+	if err != nil {
+		renderInternalServerError(w, r, "failed to load pantry", err)
+		return
+	}
+
+	result := []PantryItemJSON{}
+	for _, item := range *items {
+		result = append(result, mapPantryItemToJSON(item))
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, result)
+}
+
+// GET /v1/pantry/{id}
+func (s Server) getPantryItemCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid ingredient id", err)
+		return
+	}
+
+	item, err := s.Pantry.GetPantryItem(id)
+	if err != nil {
+		renderError(w, r, "failed to load pantry item", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapPantryItemToJSON(*item))
+}
+
+// POST /v1/pantry, the amount is added to the stock, unknown ingredients are created in the request unit
+func (s Server) addToPantryCtrl(w http.ResponseWriter, r *http.Request) {
+	var request PantryItemRequestJSON
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		renderBadRequest(w, r, "invalid request body", err)
+		return
+	}
+
+	item, err := s.Pantry.AddToPantry(mapPantryItemRequest(request))
+	if err != nil {
+		renderError(w, r, "failed to add to pantry", err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, mapPantryItemToJSON(*item))
+}
+
+// PUT /v1/pantry/{id}, the ingredient is renamed and its stock is set to the amount
+func (s Server) updatePantryItemCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid ingredient id", err)
+		return
+	}
+
+	var request PantryItemRequestJSON
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		renderBadRequest(w, r, "invalid request body", err)
+		return
+	}
+
+	item, err := s.Pantry.UpdatePantryItem(id, mapPantryItemRequest(request))
+	if err != nil {
+		renderError(w, r, "failed to update pantry item", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapPantryItemToJSON(*item))
+}
+
+// DELETE /v1/pantry/{id}
+func (s Server) deletePantryItemCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid ingredient id", err)
+		return
+	}
+
+	if err := s.Pantry.DeletePantryItem(id); err != nil {
+		renderError(w, r, "failed to delete pantry item", err)
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+func mapPantryItemToJSON(item store.PantryItem) PantryItemJSON {
+	return PantryItemJSON{
+		IngredientID: int(item.Ingredient.ID),
+		Name:         item.Ingredient.Name,
+		Amount:       item.Amount,
+		Unit:         item.Ingredient.Unit.Name,
+		Density:      mapOptionalFloat(item.Ingredient.Density),
+		InStock:      item.InStock,
+	}
+}
+
+func mapPantryItemRequest(request PantryItemRequestJSON) store.PantryDraft {
+	return store.PantryDraft{
+		Ingredient: request.Ingredient,
+		Amount:     request.Amount,
+		Unit:       request.Unit,
+		Density:    mapNullFloat(request.Density),
+	}
+}
+
+// mapNullFloat is the reverse of mapOptionalFloat, a missing value is null
+func mapNullFloat(src *float64) sql.NullFloat64 {
+	if src == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *src, Valid: true}
+}
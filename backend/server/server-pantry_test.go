@@ -0,0 +1,220 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// fakePantry fails pantry changes with the error, other methods of the embedded interface aren't used
+type fakePantry struct {
+	Pantry
+	err     error
+	drafts  []store.PantryDraft
+	deleted []uint
+}
+
+func (p *fakePantry) item(id uint, amount float64) *store.PantryItem {
+	return &store.PantryItem{
+		Ingredient: store.IngredientV1{ID: id, Name: "Flour", Unit: store.UnitV1{Name: "g"}},
+		Amount:     amount,
+		InStock:    true,
+	}
+}
+
+func (p *fakePantry) GetPantry() (*[]store.PantryItem, error) {
+	items := []store.PantryItem{*p.item(1, 300), {Ingredient: store.IngredientV1{ID: 2, Name: "Egg", Unit: store.UnitV1{Name: "pcs"}}}}
+	return &items, nil
+}
+
+func (p *fakePantry) GetPantryItem(ingredientID uint) (*store.PantryItem, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.item(ingredientID, 300), nil
+}
+
+func (p *fakePantry) AddToPantry(draft store.PantryDraft) (*store.PantryItem, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	p.drafts = append(p.drafts, draft)
+	return p.item(1, 300+draft.Amount), nil
+}
+
+func (p *fakePantry) UpdatePantryItem(ingredientID uint, draft store.PantryDraft) (*store.PantryItem, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	p.drafts = append(p.drafts, draft)
+	return p.item(ingredientID, draft.Amount), nil
+}
+
+func (p *fakePantry) DeletePantryItem(ingredientID uint) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.deleted = append(p.deleted, ingredientID)
+	return nil
+}
+
+func TestGetPantry(t *testing.T) {
+	server := Server{Pantry: &fakePantry{}}
+
+	response := httptest.NewRecorder()
+	server.routes().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/pantry", nil))
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", response.Code, http.StatusOK, response.Body)
+	}
+	var items []PantryItemJSON
+	if err := json.Unmarshal(response.Body.Bytes(), &items); err != nil {
+		t.Fatal(err)
+	}
+	want := []PantryItemJSON{
+		{IngredientID: 1, Name: "Flour", Amount: 300, Unit: "g", InStock: true},
+		{IngredientID: 2, Name: "Egg", Unit: "pcs"},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("pantry = %+v, want %+v", items, want)
+	}
+}
+
+func TestGetPantryItem(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		err        error
+		wantStatus int
+	}{
+		{name: "item", path: "/api/v1/pantry/1", wantStatus: http.StatusOK},
+		{name: "unknown ingredient", path: "/api/v1/pantry/9", err: store.ErrNotFound, wantStatus: http.StatusNotFound},
+		{name: "invalid id", path: "/api/v1/pantry/flour", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := Server{Pantry: &fakePantry{err: tt.err}}
+
+			response := httptest.NewRecorder()
+			server.routes().ServeHTTP(response, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if response.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", response.Code, tt.wantStatus, response.Body)
+			}
+		})
+	}
+}
+
+func TestAddToPantryCtrl(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantStatus int
+		wantDrafts []store.PantryDraft
+	}{
+		{name: "stock", body: `{"ingredient": "Flour", "amount": 0.5, "unit": "kg"}`, wantStatus: http.StatusCreated,
+			wantDrafts: []store.PantryDraft{{Ingredient: "Flour", Amount: 0.5, Unit: "kg"}}},
+		{name: "stock with density", body: `{"ingredient": "Flour", "amount": 1, "unit": "cup", "density": 0.55}`, wantStatus: http.StatusCreated,
+			wantDrafts: []store.PantryDraft{{Ingredient: "Flour", Amount: 1, Unit: "cup", Density: sqlFloat(0.55)}}},
+		{name: "stock of unknown unit", body: `{"ingredient": "Flour", "amount": 1, "unit": "jug"}`,
+			err: fmt.Errorf("unknown unit %q: %w", "jug", store.ErrInvalid), wantStatus: http.StatusUnprocessableEntity},
+		{name: "malformed body", body: `{"ingredient": `, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pantry := &fakePantry{err: tt.err}
+			server := Server{Pantry: pantry}
+
+			response := httptest.NewRecorder()
+			server.routes().ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/api/v1/pantry", strings.NewReader(tt.body)))
+
+			if response.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", response.Code, tt.wantStatus, response.Body)
+			}
+			if !reflect.DeepEqual(pantry.drafts, tt.wantDrafts) {
+				t.Errorf("drafts = %+v, want %+v", pantry.drafts, tt.wantDrafts)
+			}
+		})
+	}
+}
+
+func TestUpdatePantryItemCtrl(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		err        error
+		wantStatus int
+		wantDrafts []store.PantryDraft
+	}{
+		{name: "stock", path: "/api/v1/pantry/1", body: `{"ingredient": "Rye flour", "amount": 200}`, wantStatus: http.StatusOK,
+			wantDrafts: []store.PantryDraft{{Ingredient: "Rye flour", Amount: 200}}},
+		{name: "unknown ingredient", path: "/api/v1/pantry/9", body: `{"ingredient": "Milk", "amount": 1}`,
+			err: store.ErrNotFound, wantStatus: http.StatusNotFound},
+		{name: "name of other ingredient", path: "/api/v1/pantry/1", body: `{"ingredient": "Egg", "amount": 1}`,
+			err: store.ErrConflict, wantStatus: http.StatusConflict},
+		{name: "invalid id", path: "/api/v1/pantry/flour", body: `{"ingredient": "Flour", "amount": 1}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pantry := &fakePantry{err: tt.err}
+			server := Server{Pantry: pantry}
+
+			response := httptest.NewRecorder()
+			server.routes().ServeHTTP(response, httptest.NewRequest(http.MethodPut, tt.path, strings.NewReader(tt.body)))
+
+			if response.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", response.Code, tt.wantStatus, response.Body)
+			}
+			if !reflect.DeepEqual(pantry.drafts, tt.wantDrafts) {
+				t.Errorf("drafts = %+v, want %+v", pantry.drafts, tt.wantDrafts)
+			}
+		})
+	}
+}
+
+func TestDeletePantryItemCtrl(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		err         error
+		wantStatus  int
+		wantDeleted []uint
+	}{
+		{name: "item", path: "/api/v1/pantry/1", wantStatus: http.StatusNoContent, wantDeleted: []uint{1}},
+		{name: "ingredient out of the pantry", path: "/api/v1/pantry/2", err: store.ErrNotFound, wantStatus: http.StatusNotFound},
+		{name: "invalid id", path: "/api/v1/pantry/flour", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pantry := &fakePantry{err: tt.err}
+			server := Server{Pantry: pantry}
+
+			response := httptest.NewRecorder()
+			server.routes().ServeHTTP(response, httptest.NewRequest(http.MethodDelete, tt.path, nil))
+
+			if response.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", response.Code, tt.wantStatus, response.Body)
+			}
+			if !reflect.DeepEqual(pantry.deleted, tt.wantDeleted) {
+				t.Errorf("deleted = %v, want %v", pantry.deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func sqlFloat(value float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: value, Valid: true}
+}
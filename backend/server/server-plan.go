@@ -0,0 +1,446 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+type PlanJSON struct {
+	Year      int            `json:"year"`
+	Number    int            `json:"number"`
+	MealSlots []MealSlotJSON `json:"mealSlots"`
+	Days      []PlanDayJSON  `json:"days"`
+}
+
+type PlanDayJSON struct {
+	ID           string         `json:"id"`
+	Title        string         `json:"title"`
+	IsCurrentDay bool           `json:"isCurrentDay"`
+	Meals        []PlanMealJSON `json:"meals"`
+	Unslotted    []ServingJSON  `json:"unslotted"`
+}
+
+type PlanMealJSON struct {
+	MealSlotID uint          `json:"mealSlotId"`
+	Servings   []ServingJSON `json:"servings"`
+}
+
+type ServingJSON struct {
+	ID         int        `json:"id"`
+	RecipeID   int        `json:"recipeId"`
+	Title      string     `json:"title"`
+	Portions   uint       `json:"portions"`
+	PlannedFor *string    `json:"plannedFor,omitempty"`
+	MealSlotID *uint      `json:"mealSlotId,omitempty"`
+	CookedAt   *time.Time `json:"cookedAt,omitempty"`
+	Rating     *uint      `json:"rating,omitempty"`
+	Notes      string     `json:"notes,omitempty"`
+
+	Ingredients []IngredientLineJSON `json:"ingredients"`
+	Deductions  []DeductionJSON      `json:"deductions,omitempty"`
+}
+
+type DeductionJSON struct {
+	IngredientID int     `json:"ingredientId"`
+	Name         string  `json:"name"`
+	Unit         string  `json:"unit"`
+	Amount       float64 `json:"amount"`
+	Deducted     float64 `json:"deducted"`
+	Shortage     float64 `json:"shortage"`
+}
+
+type MealSlotJSON struct {
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	Position    uint    `json:"position"`
+	DefaultTime *string `json:"defaultTime,omitempty"`
+}
+
+type CreateServingRequestJSON struct {
+	RecipeID uint `json:"recipeId"`
+	Portions uint `json:"portions"`
+}
+
+type PlanServingRequestJSON struct {
+	Day        string `json:"day"`
+	MealSlotID uint   `json:"mealSlotId"`
+}
+
+// RateServingRequestJSON is a 1-5 rating of a cooked serving with optional notes
+type RateServingRequestJSON struct {
+	Rating uint   `json:"rating"`
+	Notes  string `json:"notes"`
+}
+
+type MealSlotRequestJSON struct {
+	Name        string  `json:"name"`
+	Position    uint    `json:"position"`
+	DefaultTime *string `json:"defaultTime"`
+}
+
+// GET /v1/plan?week=current|next
+func (s Server) getPlanCtrl(w http.ResponseWriter, r *http.Request) {
+	var week *store.Week
+	var err error
+
+	switch r.URL.Query().Get("week") {
+	case "", "current":
+		week, err = s.Scheduler.GetWeek()
+	case "next":
+		week, err = s.Scheduler.GetNextWeek()
+	default:
+		renderBadRequest(w, r, "invalid week parameter", fmt.Errorf("week should be current or next"))
+		return
+	}
+	if err != nil {
+		renderInternalServerError(w, r, "failed to generate week", err)
+		return
+	}
+
+	plannedWeek, err := s.Chef.PlanWeek(week)
+	if err != nil {
+		renderInternalServerError(w, r, "failed to load plan", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapPlanToJSON(plannedWeek))
+}
+
+// POST /v1/servings
+func (s Server) createServingCtrl(w http.ResponseWriter, r *http.Request) {
+	var request CreateServingRequestJSON
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		renderBadRequest(w, r, "invalid request body", err)
+		return
+	}
+
+	serving, err := s.Chef.CreateServing(request.RecipeID, request.Portions)
+	if err != nil {
+		renderError(w, r, "failed to create serving", err)
+		return
+	}
+
+	serving, err = s.Chef.GetServing(serving.ID)
+	if err != nil {
+		renderError(w, r, "failed to load serving", err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, mapServingToJSON(*serving))
+}
+
+// PUT /v1/servings/{id}/plan
+func (s Server) planServingCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid serving id", err)
+		return
+	}
+
+	var request PlanServingRequestJSON
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		renderBadRequest(w, r, "invalid request body", err)
+		return
+	}
+
+	day, err := s.Scheduler.ParseDay(request.Day)
+	if err != nil {
+		renderBadRequest(w, r, "invalid day", err)
+		return
+	}
+
+	if err := s.Chef.AssignServing(id, day, request.MealSlotID); err != nil {
+		renderError(w, r, "failed to plan serving", err)
+		return
+	}
+
+	s.renderServing(w, r, id)
+}
+
+// DELETE /v1/servings/{id}/plan
+func (s Server) unplanServingCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid serving id", err)
+		return
+	}
+
+	if err := s.Chef.UnassignServing(id); err != nil {
+		renderError(w, r, "failed to unplan serving", err)
+		return
+	}
+
+	s.renderServing(w, r, id)
+}
+
+// POST /v1/servings/{id}/cook
+func (s Server) cookServingCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid serving id", err)
+		return
+	}
+
+	serving, err := s.Chef.CookServing(id)
+	if err != nil {
+		renderError(w, r, "failed to cook serving", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapServingToJSON(*serving))
+}
+
+// DELETE /v1/servings/{id}/cook
+func (s Server) uncookServingCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid serving id", err)
+		return
+	}
+
+	if err := s.Chef.UncookServing(id); err != nil {
+		renderError(w, r, "failed to undo serving cooking", err)
+		return
+	}
+
+	s.renderServing(w, r, id)
+}
+
+// POST /v1/servings/{id}/rating
+func (s Server) rateServingCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid serving id", err)
+		return
+	}
+
+	var request RateServingRequestJSON
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		renderBadRequest(w, r, "invalid request body", err)
+		return
+	}
+
+	serving, err := s.Chef.RateServing(id, request.Rating, request.Notes)
+	if err != nil {
+		renderError(w, r, "failed to rate serving", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapServingToJSON(*serving))
+}
+
+// GET /v1/meal-slots
+func (s Server) getMealSlotsCtrl(w http.ResponseWriter, r *http.Request) {
+	mealSlots, err := s.Scheduler.GetMealSlots()
+	if err != nil {
+		renderInternalServerError(w, r, "failed to load meal slots", err)
+		return
+	}
+
+	result := []MealSlotJSON{}
+	for _, mealSlot := range *mealSlots {
+		result = append(result, mapMealSlotToJSON(mealSlot))
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, result)
+}
+
+// POST /v1/meal-slots
+func (s Server) createMealSlotCtrl(w http.ResponseWriter, r *http.Request) {
+	var request MealSlotRequestJSON
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		renderBadRequest(w, r, "invalid request body", err)
+		return
+	}
+
+	mealSlot := store.MealSlotV1{}
+	mapMealSlotRequest(&mealSlot, request)
+
+	if err := s.Scheduler.SaveMealSlot(&mealSlot); err != nil {
+		renderError(w, r, "failed to create meal slot", err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, mapMealSlotToJSON(mealSlot))
+}
+
+// PUT /v1/meal-slots/{id}
+func (s Server) updateMealSlotCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid meal slot id", err)
+		return
+	}
+
+	var request MealSlotRequestJSON
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		renderBadRequest(w, r, "invalid request body", err)
+		return
+	}
+
+	mealSlot, err := s.Scheduler.GetMealSlot(id)
+	if err != nil {
+		renderError(w, r, "failed to load meal slot", err)
+		return
+	}
+
+	mapMealSlotRequest(mealSlot, request)
+
+	if err := s.Scheduler.SaveMealSlot(mealSlot); err != nil {
+		renderError(w, r, "failed to update meal slot", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapMealSlotToJSON(*mealSlot))
+}
+
+// DELETE /v1/meal-slots/{id}
+func (s Server) deleteMealSlotCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid meal slot id", err)
+		return
+	}
+
+	if err := s.Scheduler.DeleteMealSlot(id); err != nil {
+		renderError(w, r, "failed to delete meal slot", err)
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+func (s Server) renderServing(w http.ResponseWriter, r *http.Request, id uint) {
+	serving, err := s.Chef.GetServing(id)
+	if err != nil {
+		renderError(w, r, "failed to load serving", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapServingToJSON(*serving))
+}
+
+func mapPlanToJSON(week *store.Week) *PlanJSON {
+	result := PlanJSON{
+		Year:      week.Year,
+		Number:    week.Number,
+		MealSlots: []MealSlotJSON{},
+		Days:      []PlanDayJSON{},
+	}
+
+	for _, mealSlot := range week.MealSlots {
+		result.MealSlots = append(result.MealSlots, mapMealSlotToJSON(mealSlot))
+	}
+
+	for _, day := range week.Days {
+		dayJSON := PlanDayJSON{
+			ID:           day.ID,
+			Title:        day.Title,
+			IsCurrentDay: day.IsCurrentDay,
+			Meals:        []PlanMealJSON{},
+			Unslotted:    mapServingsToJSON(day.Unslotted),
+		}
+
+		for _, meal := range day.Meals {
+			dayJSON.Meals = append(dayJSON.Meals, PlanMealJSON{
+				MealSlotID: meal.MealSlot.ID,
+				Servings:   mapServingsToJSON(meal.Servings),
+			})
+		}
+
+		result.Days = append(result.Days, dayJSON)
+	}
+
+	return &result
+}
+
+func mapServingsToJSON(servings []store.ServingV1) []ServingJSON {
+	result := []ServingJSON{}
+	for _, serving := range servings {
+		result = append(result, mapServingToJSON(serving))
+	}
+	return result
+}
+
+func mapServingToJSON(serving store.ServingV1) ServingJSON {
+	result := ServingJSON{
+		ID:          int(serving.ID),
+		RecipeID:    int(serving.RecipeID),
+		Title:       serving.Recipe.Title,
+		Portions:    serving.Portions,
+		MealSlotID:  serving.MealSlotID,
+		Ingredients: mapIngredientLines(serving.ScaledIngredients),
+	}
+
+	if result.Portions == 0 {
+		result.Portions = serving.Recipe.Portions
+	}
+
+	if serving.PlannedFor.Valid {
+		plannedFor := serving.PlannedFor.Time.Format(time.DateOnly)
+		result.PlannedFor = &plannedFor
+	}
+
+	if serving.CookedAt.Valid {
+		cookedAt := serving.CookedAt.Time
+		result.CookedAt = &cookedAt
+	}
+
+	if serving.Rating > 0 {
+		rating := serving.Rating
+		result.Rating = &rating
+		result.Notes = serving.Notes
+	}
+
+	for _, deduction := range serving.Deductions {
+		result.Deductions = append(result.Deductions, DeductionJSON{
+			IngredientID: int(deduction.IngredientV1ID),
+			Name:         deduction.Ingredient.Name,
+			Unit:         deduction.Ingredient.Unit.Name,
+			Amount:       deduction.Amount,
+			Deducted:     deduction.Deducted,
+			Shortage:     deduction.Shortage,
+		})
+	}
+
+	return result
+}
+
+func mapMealSlotToJSON(mealSlot store.MealSlotV1) MealSlotJSON {
+	result := MealSlotJSON{
+		ID:       int(mealSlot.ID),
+		Name:     mealSlot.Name,
+		Position: mealSlot.Position,
+	}
+
+	if mealSlot.DefaultTime.Valid {
+		defaultTime := mealSlot.DefaultTime.String
+		result.DefaultTime = &defaultTime
+	}
+
+	return result
+}
+
+func mapMealSlotRequest(destination *store.MealSlotV1, source MealSlotRequestJSON) {
+	destination.Name = source.Name
+	destination.Position = source.Position
+	destination.DefaultTime = sql.NullString{}
+
+	if source.DefaultTime != nil && strings.TrimSpace(*source.DefaultTime) != "" {
+		destination.DefaultTime = sql.NullString{String: strings.TrimSpace(*source.DefaultTime), Valid: true}
+	}
+}
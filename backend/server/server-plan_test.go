@@ -0,0 +1,181 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjxby/eat-repeat/backend/scheduler"
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+func (c *fakeChef) PlanWeek(week *store.Week) (*store.Week, error) {
+	week.MealSlots = []store.MealSlotV1{{ID: 1, Name: "Dinner"}}
+	for i := range week.Days {
+		week.Days[i].Meals = []store.Meal{{MealSlot: week.MealSlots[0]}}
+	}
+	mealSlotID := uint(1)
+	week.Days[0].Meals[0].Servings = []store.ServingV1{{ID: 3, MealSlotID: &mealSlotID, Recipe: store.RecipeV1{Title: "Pancakes"}}}
+	return week, nil
+}
+
+func (c *fakeChef) GetServing(id uint) (*store.ServingV1, error) {
+	return &store.ServingV1{ID: id, Recipe: store.RecipeV1{Title: "Pancakes", Portions: 2}}, nil
+}
+
+func (c *fakeChef) AssignServing(id uint, day time.Time, mealSlotID uint) error {
+	return c.plan(fmt.Sprintf("assign %d %s %d", id, day.Format(time.DateOnly), mealSlotID))
+}
+
+func (c *fakeChef) MoveServing(id uint, day time.Time) error {
+	return c.plan(fmt.Sprintf("move %d %s", id, day.Format(time.DateOnly)))
+}
+
+func (c *fakeChef) UnassignServing(id uint) error {
+	return c.plan(fmt.Sprintf("unassign %d", id))
+}
+
+func (c *fakeChef) UncookServing(id uint) error {
+	return c.plan(fmt.Sprintf("uncook %d", id))
+}
+
+// plan records the planning change unless the chef fails it
+func (c *fakeChef) plan(change string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.planned = append(c.planned, change)
+	return nil
+}
+
+func TestServingViews(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		form        url.Values
+		err         error
+		wantStatus  int
+		wantPlanned []string
+	}{
+		{name: "assign", path: "/servings/assign", form: url.Values{"servingID": {"1"}, "day": {"2024-01-02"}, "mealSlotID": {"3"}},
+			wantStatus: http.StatusSeeOther, wantPlanned: []string{"assign 1 2024-01-02 3"}},
+		{name: "assign without meal slot", path: "/servings/assign", form: url.Values{"servingID": {"1"}, "day": {"2024-01-02"}},
+			wantStatus: http.StatusSeeOther, wantPlanned: []string{"assign 1 2024-01-02 0"}},
+		{name: "assign to taken meal slot", path: "/servings/assign", form: url.Values{"servingID": {"1"}, "day": {"2024-01-02"}, "mealSlotID": {"3"}},
+			err: fmt.Errorf("meal slot is taken: %w", store.ErrConflict), wantStatus: http.StatusConflict},
+		{name: "assign to unknown meal slot", path: "/servings/assign", form: url.Values{"servingID": {"1"}, "day": {"2024-01-02"}, "mealSlotID": {"9"}},
+			err: store.ErrNotFound, wantStatus: http.StatusNotFound},
+		{name: "assign of invalid day", path: "/servings/assign", form: url.Values{"servingID": {"1"}, "day": {"tomorrow"}},
+			wantStatus: http.StatusBadRequest},
+		{name: "move", path: "/servings/move", form: url.Values{"servingID": {"2"}, "day": {"2024-01-05"}},
+			wantStatus: http.StatusSeeOther, wantPlanned: []string{"move 2 2024-01-05"}},
+		{name: "move of cooked serving", path: "/servings/move", form: url.Values{"servingID": {"2"}, "day": {"2024-01-05"}},
+			err: fmt.Errorf("serving is already cooked: %w", store.ErrConflict), wantStatus: http.StatusConflict},
+		{name: "move of invalid serving id", path: "/servings/move", form: url.Values{"servingID": {"second"}, "day": {"2024-01-05"}},
+			wantStatus: http.StatusBadRequest},
+		{name: "unassign", path: "/servings/unassign", form: url.Values{"servingID": {"2"}},
+			wantStatus: http.StatusSeeOther, wantPlanned: []string{"unassign 2"}},
+		{name: "unassign of unknown serving", path: "/servings/unassign", form: url.Values{"servingID": {"9"}},
+			err: store.ErrNotFound, wantStatus: http.StatusNotFound},
+		{name: "uncook", path: "/servings/uncook", form: url.Values{"servingID": {"2"}},
+			wantStatus: http.StatusSeeOther, wantPlanned: []string{"uncook 2"}},
+		{name: "uncook of not cooked serving", path: "/servings/uncook", form: url.Values{"servingID": {"2"}},
+			err: fmt.Errorf("serving is not cooked: %w", store.ErrConflict), wantStatus: http.StatusConflict},
+		{name: "uncook of failed store", path: "/servings/uncook", form: url.Values{"servingID": {"2"}},
+			err: fmt.Errorf("database is locked"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chef := &fakeChef{err: tt.err}
+			server := Server{Chef: chef, Scheduler: scheduler.New(nil)}
+
+			request := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.form.Encode()))
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			response := httptest.NewRecorder()
+			server.routes().ServeHTTP(response, request)
+
+			if response.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", response.Code, tt.wantStatus, response.Body)
+			}
+			if !reflect.DeepEqual(chef.planned, tt.wantPlanned) {
+				t.Errorf("planned = %v, want %v", chef.planned, tt.wantPlanned)
+			}
+		})
+	}
+}
+
+func TestPlanServing(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		err         error
+		wantStatus  int
+		wantPlanned []string
+	}{
+		{name: "plan", method: http.MethodPut, path: "/api/v1/servings/1/plan", body: `{"day": "2024-01-02", "mealSlotId": 3}`,
+			wantStatus: http.StatusOK, wantPlanned: []string{"assign 1 2024-01-02 3"}},
+		{name: "plan to taken meal slot", method: http.MethodPut, path: "/api/v1/servings/1/plan", body: `{"day": "2024-01-02", "mealSlotId": 3}`,
+			err: fmt.Errorf("meal slot is taken: %w", store.ErrConflict), wantStatus: http.StatusConflict},
+		{name: "plan of invalid day", method: http.MethodPut, path: "/api/v1/servings/1/plan", body: `{"day": "02.01.2024"}`,
+			wantStatus: http.StatusBadRequest},
+		{name: "unplan", method: http.MethodDelete, path: "/api/v1/servings/1/plan",
+			wantStatus: http.StatusOK, wantPlanned: []string{"unassign 1"}},
+		{name: "unplan of unknown serving", method: http.MethodDelete, path: "/api/v1/servings/9/plan",
+			err: store.ErrNotFound, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chef := &fakeChef{err: tt.err}
+			server := Server{Chef: chef, Scheduler: scheduler.New(nil)}
+
+			response := httptest.NewRecorder()
+			server.routes().ServeHTTP(response, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if response.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", response.Code, tt.wantStatus, response.Body)
+			}
+			if !reflect.DeepEqual(chef.planned, tt.wantPlanned) {
+				t.Errorf("planned = %v, want %v", chef.planned, tt.wantPlanned)
+			}
+		})
+	}
+}
+
+func TestGetPlan(t *testing.T) {
+	server := Server{Chef: &fakeChef{}, Scheduler: scheduler.New(nil)}
+
+	response := httptest.NewRecorder()
+	server.routes().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/plan?week=next", nil))
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", response.Code, http.StatusOK, response.Body)
+	}
+
+	var plan PlanJSON
+	if err := json.Unmarshal(response.Body.Bytes(), &plan); err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Days) != 7 || len(plan.MealSlots) != 1 {
+		t.Fatalf("plan = %d days, %d meal slots, want 7 days and 1 meal slot", len(plan.Days), len(plan.MealSlots))
+	}
+	servings := plan.Days[0].Meals[0].Servings
+	if len(servings) != 1 || servings[0].ID != 3 || plan.Days[0].Meals[0].MealSlotID != 1 {
+		t.Errorf("first day meals = %+v, want serving 3 in meal slot 1", plan.Days[0].Meals)
+	}
+
+	response = httptest.NewRecorder()
+	server.routes().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/plan?week=last", nil))
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("status of unknown week = %d, want %d", response.Code, http.StatusBadRequest)
+	}
+}
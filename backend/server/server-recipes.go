@@ -2,7 +2,10 @@ package server
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/go-chi/render"
@@ -10,33 +13,205 @@ import (
 )
 
 type RecipesResultsJSON struct {
-	Page       int          `json:"page"`
-	PageSize   int          `json:"pageSize"`
-	SearchTerm *string      `json:"searchTerm,omitempty"`
-	Recipes    []RecipeJSON `json:"recipes"`
+	Page       int              `json:"page"`
+	PageSize   int              `json:"pageSize"`
+	SearchTerm *string          `json:"searchTerm,omitempty"`
+	Filter     RecipeFilterJSON `json:"filter"`
+	Total      int64            `json:"total"`
+	Facets     RecipeFacetsJSON `json:"facets"`
+	Recipes    []RecipeJSON     `json:"recipes"`
+}
+
+// RecipeFilterJSON is the filter the recipes are loaded with
+type RecipeFilterJSON struct {
+	Ingredients           []string `json:"ingredients,omitempty"`
+	ExcludedIngredients   []string `json:"excludeIngredients,omitempty"`
+	MaxTotalTimeInMinutes uint     `json:"maxTotalTime,omitempty"`
+	DifficultyID          uint     `json:"difficulty,omitempty"`
+	MinRating             float64  `json:"minRating,omitempty"`
+	Tags                  []string `json:"tags,omitempty"`
+	CookedWithinDays      uint     `json:"cookedWithinDays,omitempty"`
+	Sort                  string   `json:"sort,omitempty"`
+}
+
+// RecipeFacetsJSON counts the recipes of the filter on all pages by values to narrow them down with
+type RecipeFacetsJSON struct {
+	Difficulties []FacetCountJSON `json:"difficulties"`
+	Tags         []FacetCountJSON `json:"tags"`
+	Ingredients  []FacetCountJSON `json:"ingredients"`
+	Ratings      []FacetCountJSON `json:"ratings"`
+}
+
+type FacetCountJSON struct {
+	ID    uint   `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
 }
 
 type RecipeJSON struct {
-	ID                   int      `json:"id"`
-	Title                string   `json:"title"`
-	Description          string   `json:"description,omitempty"`
-	Ingredients          []string `json:"ingredients"`
-	CookingTimeInMinutes *int     `json:"cookingTimeInMinutes,omitempty"`
-	ThumbnailUrl         *string  `json:"thumbnailUrl,omitempty"`
-	PdfUrl               *string  `json:"pdfUrl,omitempty"`
+	ID                   int             `json:"id"`
+	Title                string          `json:"title"`
+	SubTitle             string          `json:"subTitle,omitempty"`
+	Description          string          `json:"description,omitempty"`
+	Ingredients          []string        `json:"ingredients"`
+	CookingTimeInMinutes *int            `json:"cookingTimeInMinutes,omitempty"`
+	Portions             uint            `json:"portions"`
+	Difficulty           *DifficultyJSON `json:"difficulty,omitempty"`
+	Tags                 []string        `json:"tags"`
+	ThumbnailUrl         *string         `json:"thumbnailUrl,omitempty"`
+	PdfUrl               *string         `json:"pdfUrl,omitempty"`
+	Nutrition            *NutritionJSON  `json:"nutrition,omitempty"`
+	Rating               float64         `json:"rating,omitempty"`
+	RatingCount          uint            `json:"ratingCount,omitempty"`
+	// Snippet is a fragment of the recipe texts matching the search term, the matching words are marked by <mark> tags
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// NutritionJSON is the nutrition per serving, values not found in the recipe are omitted
+type NutritionJSON struct {
+	Calories *float64 `json:"calories,omitempty"`
+	Carbs    *float64 `json:"carbs,omitempty"`
+	Protein  *float64 `json:"protein,omitempty"`
+	Fat      *float64 `json:"fat,omitempty"`
+	Fibre    *float64 `json:"fibre,omitempty"`
+	Sugar    *float64 `json:"sugar,omitempty"`
+	Salt     *float64 `json:"salt,omitempty"`
+}
+
+// RecipeDetailsJSON is a recipe with its ingredient lines
+type RecipeDetailsJSON struct {
+	ID                       int                  `json:"id"`
+	Title                    string               `json:"title"`
+	SubTitle                 string               `json:"subTitle,omitempty"`
+	Description              string               `json:"description,omitempty"`
+	Ingredients              []IngredientLineJSON `json:"ingredients"`
+	PreparationTimeInMinutes *int                 `json:"preparationTimeInMinutes,omitempty"`
+	CookingTimeInMinutes     *int                 `json:"cookingTimeInMinutes,omitempty"`
+	Portions                 uint                 `json:"portions"`
+	Difficulty               *DifficultyJSON      `json:"difficulty,omitempty"`
+	Tags                     []string             `json:"tags"`
+	ThumbnailUrl             *string              `json:"thumbnailUrl,omitempty"`
+	PdfUrl                   *string              `json:"pdfUrl,omitempty"`
+	Nutrition                *NutritionJSON       `json:"nutrition,omitempty"`
+	Steps                    []RecipeStepJSON     `json:"steps"`
+	Rating                   float64              `json:"rating,omitempty"`
+	RatingCount              uint                 `json:"ratingCount,omitempty"`
+	SyncFailures             uint                 `json:"syncFailures,omitempty"`
+	SyncError                string               `json:"syncError,omitempty"`
+}
+
+// SearchIndexJSON compares the recipes search index with the recipes, recipes missing of the index aren't found by the search
+type SearchIndexJSON struct {
+	Recipes    int64  `json:"recipes"`
+	Indexed    int64  `json:"indexed"`
+	Missing    []uint `json:"missing"`
+	Stale      []uint `json:"stale"`
+	Error      string `json:"error,omitempty"`
+	Consistent bool   `json:"consistent"`
+}
+
+type DifficultyJSON struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+type IngredientLineJSON struct {
+	IngredientID int     `json:"ingredientId"`
+	Name         string  `json:"name"`
+	Amount       float64 `json:"amount"`
+	Unit         string  `json:"unit"`
+}
+
+// RecipeStepJSON is an instruction step with the ingredients it uses
+type RecipeStepJSON struct {
+	Position       uint                 `json:"position"`
+	Text           string               `json:"text"`
+	TimerInSeconds *int64               `json:"timerInSeconds,omitempty"`
+	Ingredients    []StepIngredientJSON `json:"ingredients"`
+}
+
+type StepIngredientJSON struct {
+	IngredientID int    `json:"ingredientId"`
+	Name         string `json:"name"`
+}
+
+// ImportRecipeRequestJSON is the url of a page with a schema.org recipe
+type ImportRecipeRequestJSON struct {
+	Url string `json:"url"`
 }
 
-// POST /v1/recepies/sync
+type RecipeRequestJSON struct {
+	Title                    string                      `json:"title"`
+	Description              string                      `json:"description"`
+	Ingredients              []IngredientLineRequestJSON `json:"ingredients"`
+	PreparationTimeInMinutes uint                        `json:"preparationTimeInMinutes"`
+	CookingTimeInMinutes     uint                        `json:"cookingTimeInMinutes"`
+	Portions                 uint                        `json:"portions"`
+	// DifficultyID is the recipe difficulty, zero keeps the current one
+	DifficultyID uint     `json:"difficultyId"`
+	Tags         []string `json:"tags"`
+}
+
+type IngredientLineRequestJSON struct {
+	Ingredient string  `json:"ingredient"`
+	Amount     float64 `json:"amount"`
+	Unit       string  `json:"unit,omitempty"`
+}
+
+// POST /v1/recepies/sync?force=true, recipes with unchanged pdf are synced only when forced
 func (s Server) syncRecepiesCtrl(w http.ResponseWriter, r *http.Request) {
+	force := false
+	if value := r.URL.Query().Get("force"); value != "" {
+		var err error
+		force, err = strconv.ParseBool(value)
+		if err != nil {
+			renderBadRequest(w, r, "invalid force parameter", err)
+			return
+		}
+	}
 
-	job, err := s.Worker.RunSyncRecipes()
+	job, err := s.Worker.RunSyncRecipes(force)
 	if err != nil {
 		renderInternalServerError(w, r, "failed to run sync job", err)
 		return
 	}
 
 	render.Status(r, http.StatusOK)
-	render.JSON(w, r, job)
+	render.JSON(w, r, mapJobToJSON(*job))
+}
+
+// POST /v1/recipes/{id}/sync, the recipe pdf is read even when unchanged
+func (s Server) syncRecipeCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid recipe id", err)
+		return
+	}
+
+	job, err := s.Worker.RunSyncRecipe(id)
+	if err != nil {
+		renderError(w, r, "failed to run sync job", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapJobToJSON(*job))
+}
+
+// DELETE /v1/recipes/{id}/sync-failures, the next sync reads the recipe pdf again
+func (s Server) resetRecipeSyncFailuresCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid recipe id", err)
+		return
+	}
+
+	if err := s.Worker.ResetRecipeSyncFailures(id); err != nil {
+		renderError(w, r, "failed to reset recipe sync failures", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // GET /v1/recepies
@@ -55,9 +230,15 @@ func (s Server) getRecepiesCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	searchTerm := strings.TrimSpace(r.URL.Query().Get("searchTerm"))
+	filter, err := parseRecipeFilter(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid recipes filter", err)
+		return
+	}
+	// the facets are only of the API, the web pages don't show them
+	filter.WithFacets = true
 
-	recipes, err := s.Chef.GetRecipes(page, pageSize, searchTerm)
+	recipes, err := s.Chef.GetRecipes(page, pageSize, filter)
 	if err != nil {
 		renderInternalServerError(w, r, "failed to load recepies", err)
 		return
@@ -69,6 +250,281 @@ func (s Server) getRecepiesCtrl(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, recipesResults)
 }
 
+// GET /v1/difficulties
+func (s Server) getDifficultiesCtrl(w http.ResponseWriter, r *http.Request) {
+	difficulties, err := s.Chef.GetRecipeDifficulties()
+	if err != nil {
+		renderInternalServerError(w, r, "failed to load difficulties", err)
+		return
+	}
+
+	result := []DifficultyJSON{}
+	for _, difficulty := range *difficulties {
+		result = append(result, *mapDifficultyToJSON(difficulty))
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, result)
+}
+
+// GET /v1/admin/search-index
+func (s Server) checkSearchIndexCtrl(w http.ResponseWriter, r *http.Request) {
+	status, err := s.Chef.CheckSearchIndex()
+	if err != nil {
+		renderInternalServerError(w, r, "failed to check search index", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapSearchIndexToJSON(*status))
+}
+
+// POST /v1/admin/search-index/rebuild
+func (s Server) rebuildSearchIndexCtrl(w http.ResponseWriter, r *http.Request) {
+	status, err := s.Chef.RebuildSearchIndex()
+	if err != nil {
+		renderInternalServerError(w, r, "failed to rebuild search index", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapSearchIndexToJSON(*status))
+}
+
+// GET /v1/recipes/{id}
+func (s Server) getRecipeCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid recipe id", err)
+		return
+	}
+
+	recipe, err := s.Chef.GetRecipe(id)
+	if err != nil {
+		renderError(w, r, "failed to load recipe", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapRecipeToJSON(s.Settings.StaticContentEndpoint, *recipe))
+}
+
+// POST /v1/recipes
+func (s Server) createRecipeCtrl(w http.ResponseWriter, r *http.Request) {
+	var request RecipeRequestJSON
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		renderBadRequest(w, r, "invalid request body", err)
+		return
+	}
+
+	recipe, err := s.Chef.CreateRecipe(mapRecipeRequest(request))
+	if err != nil {
+		renderError(w, r, "failed to create recipe", err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, mapRecipeToJSON(s.Settings.StaticContentEndpoint, *recipe))
+}
+
+// POST /v1/recipes/import, the recipe is read of the schema.org JSON-LD of the page
+func (s Server) importRecipeCtrl(w http.ResponseWriter, r *http.Request) {
+	var request ImportRecipeRequestJSON
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		renderBadRequest(w, r, "invalid request body", err)
+		return
+	}
+
+	recipe, err := s.Chef.ImportRecipe(r.Context(), request.Url)
+	if err != nil {
+		renderError(w, r, "failed to import recipe", err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, mapRecipeToJSON(s.Settings.StaticContentEndpoint, *recipe))
+}
+
+// PUT /v1/recipes/{id}
+func (s Server) updateRecipeCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid recipe id", err)
+		return
+	}
+
+	var request RecipeRequestJSON
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		renderBadRequest(w, r, "invalid request body", err)
+		return
+	}
+
+	s.renderUpdatedRecipe(w, r, id, request)
+}
+
+// PATCH /v1/recipes/{id}, fields missing in the body are kept, ingredients are replaced when present
+func (s Server) patchRecipeCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid recipe id", err)
+		return
+	}
+
+	recipe, err := s.Chef.GetRecipe(id)
+	if err != nil {
+		renderError(w, r, "failed to load recipe", err)
+		return
+	}
+
+	// the body is decoded over the current recipe, so only fields present in it change,
+	// the ingredients are decoded into an empty list, lines of the body don't keep values of the current lines
+	request := mapRecipeToRequest(*recipe)
+	ingredients := request.Ingredients
+	request.Ingredients = nil
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		renderBadRequest(w, r, "invalid request body", err)
+		return
+	}
+	if request.Ingredients == nil {
+		request.Ingredients = ingredients
+	}
+
+	s.renderUpdatedRecipe(w, r, id, request)
+}
+
+func (s Server) renderUpdatedRecipe(w http.ResponseWriter, r *http.Request, id uint, request RecipeRequestJSON) {
+	recipe, err := s.Chef.UpdateRecipe(id, mapRecipeRequest(request))
+	if err != nil {
+		renderError(w, r, "failed to update recipe", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapRecipeToJSON(s.Settings.StaticContentEndpoint, *recipe))
+}
+
+// DELETE /v1/recipes/{id}
+func (s Server) deleteRecipeCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid recipe id", err)
+		return
+	}
+
+	if err := s.Chef.DeleteRecipe(id); err != nil {
+		renderError(w, r, "failed to delete recipe", err)
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+// parseRecipeFilter parses the optional recipes filter, lists are comma separated or repeated parameters
+func parseRecipeFilter(r *http.Request) (filter store.RecipeFilter, err error) {
+	query := r.URL.Query()
+
+	filter.SearchTerm = strings.TrimSpace(query.Get("searchTerm"))
+	filter.Ingredients = parseListParam(query["ingredients"])
+	filter.ExcludedIngredients = parseListParam(query["excludeIngredients"])
+	filter.Tags = parseListParam(query["tags"])
+
+	numbers := []struct {
+		name  string
+		value *uint
+	}{
+		{name: "maxTotalTime", value: &filter.MaxTotalTimeInMinutes},
+		{name: "difficulty", value: &filter.DifficultyID},
+		{name: "cookedWithinDays", value: &filter.CookedWithinDays},
+	}
+	for _, number := range numbers {
+		value := strings.TrimSpace(query.Get(number.name))
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s parameter %q", number.name, value)
+		}
+		*number.value = uint(parsed)
+	}
+
+	if value := strings.TrimSpace(query.Get("minRating")); value != "" {
+		filter.MinRating, err = strconv.ParseFloat(value, 64)
+		if err != nil || filter.MinRating < 0 || filter.MinRating > 5 {
+			return filter, fmt.Errorf("invalid minRating parameter %q", value)
+		}
+	}
+
+	switch sort := store.RecipeSort(strings.TrimSpace(query.Get("sort"))); sort {
+	case store.RecipeSortDefault, store.RecipeSortRank, store.RecipeSortRating, store.RecipeSortTime,
+		store.RecipeSortLastCooked, store.RecipeSortCreated:
+		filter.Sort = sort
+	default:
+		return filter, fmt.Errorf("invalid sort parameter %q", sort)
+	}
+
+	return filter, nil
+}
+
+// filterQuery encodes the recipes filter as query parameters parseRecipeFilter reads, zero values are left out
+func filterQuery(filter store.RecipeFilter) string {
+	query := url.Values{}
+
+	if filter.SearchTerm != "" {
+		query.Set("searchTerm", filter.SearchTerm)
+	}
+	lists := []struct {
+		name   string
+		values []string
+	}{
+		{name: "ingredients", values: filter.Ingredients},
+		{name: "excludeIngredients", values: filter.ExcludedIngredients},
+		{name: "tags", values: filter.Tags},
+	}
+	for _, list := range lists {
+		for _, value := range list.values {
+			query.Add(list.name, value)
+		}
+	}
+
+	numbers := []struct {
+		name  string
+		value uint
+	}{
+		{name: "maxTotalTime", value: filter.MaxTotalTimeInMinutes},
+		{name: "difficulty", value: filter.DifficultyID},
+		{name: "cookedWithinDays", value: filter.CookedWithinDays},
+	}
+	for _, number := range numbers {
+		if number.value > 0 {
+			query.Set(number.name, strconv.FormatUint(uint64(number.value), 10))
+		}
+	}
+
+	if filter.MinRating > 0 {
+		query.Set("minRating", strconv.FormatFloat(filter.MinRating, 'f', -1, 64))
+	}
+	if filter.Sort != store.RecipeSortDefault {
+		query.Set("sort", string(filter.Sort))
+	}
+
+	return query.Encode()
+}
+
+// parseListParam splits comma separated values of a repeated parameter, empty values are dropped
+func parseListParam(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
+	}
+	return result
+}
+
 func mapToJSON(staticContentEndpoint string, recipes *store.Recipes) *RecipesResultsJSON {
 	var mappedRecipes []RecipeJSON
 	for _, recipe := range recipes.Recipes {
@@ -80,20 +536,82 @@ func mapToJSON(staticContentEndpoint string, recipes *store.Recipes) *RecipesRes
 		mappedRecipes = append(mappedRecipes, RecipeJSON{
 			ID:                   int(recipe.ID),
 			Title:                recipe.Title,
+			SubTitle:             recipe.SubTitle,
 			Description:          recipe.Description,
 			Ingredients:          ingredients,
 			CookingTimeInMinutes: cookingTimeInMinutes,
+			Portions:             recipe.Portions,
+			Difficulty:           mapDifficultyToJSON(recipe.RecipeDifficulty),
+			Tags:                 mapTags(recipe.Tags),
 			ThumbnailUrl:         thumbnailUrl,
 			PdfUrl:               pdfUrl,
+			Nutrition:            mapNutritionToJSON(recipe.Nutrition),
+			Rating:               recipe.Rating,
+			RatingCount:          recipe.RatingCount,
+			Snippet:              recipes.Snippets[recipe.ID],
 		})
 	}
 
+	filter := recipes.Filter
 	return &RecipesResultsJSON{
 		Page:       recipes.Page,
 		PageSize:   recipes.PageSize,
-		SearchTerm: &recipes.SearchTerm,
-		Recipes:    mappedRecipes,
+		SearchTerm: &filter.SearchTerm,
+		Filter: RecipeFilterJSON{
+			Ingredients:           filter.Ingredients,
+			ExcludedIngredients:   filter.ExcludedIngredients,
+			MaxTotalTimeInMinutes: filter.MaxTotalTimeInMinutes,
+			DifficultyID:          filter.DifficultyID,
+			MinRating:             filter.MinRating,
+			Tags:                  filter.Tags,
+			CookedWithinDays:      filter.CookedWithinDays,
+			Sort:                  string(filter.Sort),
+		},
+		Total: recipes.Total,
+		Facets: RecipeFacetsJSON{
+			Difficulties: mapFacetCounts(recipes.Facets.Difficulties),
+			Tags:         mapFacetCounts(recipes.Facets.Tags),
+			Ingredients:  mapFacetCounts(recipes.Facets.Ingredients),
+			Ratings:      mapFacetCounts(recipes.Facets.Ratings),
+		},
+		Recipes: mappedRecipes,
+	}
+}
+
+func mapSearchIndexToJSON(status store.SearchIndexStatus) SearchIndexJSON {
+	return SearchIndexJSON{
+		Recipes:    status.Recipes,
+		Indexed:    status.Indexed,
+		Missing:    status.Missing,
+		Stale:      status.Stale,
+		Error:      status.Error,
+		Consistent: status.Consistent,
+	}
+}
+
+func mapFacetCounts(src []store.FacetCount) []FacetCountJSON {
+	result := []FacetCountJSON{}
+	for _, count := range src {
+		result = append(result, FacetCountJSON{ID: count.ID, Name: count.Name, Count: count.Count})
+	}
+	return result
+}
+
+func mapTags(src []store.TagV1) []string {
+	result := []string{}
+	for _, tag := range src {
+		result = append(result, tag.Name)
 	}
+	return result
+}
+
+// mapDifficultyToJSON maps the recipe difficulty, recipes without difficulty have a zero one
+func mapDifficultyToJSON(src store.RecipeDifficultyV1) *DifficultyJSON {
+	if src.ID == 0 {
+		return nil
+	}
+
+	return &DifficultyJSON{ID: src.ID, Name: src.Name}
 }
 
 func mapIngredients(src []store.RecipeV1IngredientV1) []string {
@@ -112,6 +630,29 @@ func mapCookingTime(src uint) *int {
 	return nil
 }
 
+func mapNutritionToJSON(src *store.RecipeNutritionV1) *NutritionJSON {
+	if src == nil {
+		return nil
+	}
+
+	return &NutritionJSON{
+		Calories: mapOptionalFloat(src.Calories),
+		Carbs:    mapOptionalFloat(src.Carbs),
+		Protein:  mapOptionalFloat(src.Protein),
+		Fat:      mapOptionalFloat(src.Fat),
+		Fibre:    mapOptionalFloat(src.Fibre),
+		Sugar:    mapOptionalFloat(src.Sugar),
+		Salt:     mapOptionalFloat(src.Salt),
+	}
+}
+
+func mapOptionalFloat(src sql.NullFloat64) *float64 {
+	if !src.Valid {
+		return nil
+	}
+	return &src.Float64
+}
+
 func mapOptionalURL(staticContentEndpoint string, src sql.NullString) *string {
 	if src.Valid {
 		url := staticContentEndpoint + src.String
@@ -119,3 +660,138 @@ func mapOptionalURL(staticContentEndpoint string, src sql.NullString) *string {
 	}
 	return nil
 }
+
+// lineUnitName is the unit of a recipe ingredient line, lines without unit are in the ingredient unit
+func lineUnitName(line store.RecipeV1IngredientV1) string {
+	if line.Unit != nil {
+		return line.Unit.Name
+	}
+	return line.Ingredient.Unit.Name
+}
+
+func mapRecipeToJSON(staticContentEndpoint string, recipe store.RecipeV1) RecipeDetailsJSON {
+	return RecipeDetailsJSON{
+		ID:                       int(recipe.ID),
+		Title:                    recipe.Title,
+		SubTitle:                 recipe.SubTitle,
+		Description:              recipe.Description,
+		Ingredients:              mapIngredientLines(recipe.Ingredients),
+		PreparationTimeInMinutes: mapCookingTime(recipe.PreparationTimeInMinutes),
+		CookingTimeInMinutes:     mapCookingTime(recipe.CookingTimeInMinutes),
+		Portions:                 recipe.Portions,
+		Difficulty:               mapDifficultyToJSON(recipe.RecipeDifficulty),
+		Tags:                     mapTags(recipe.Tags),
+		ThumbnailUrl:             mapOptionalURL(staticContentEndpoint, recipe.ThumbnailUrl),
+		PdfUrl:                   mapOptionalURL(staticContentEndpoint, recipe.PdfUrl),
+		Nutrition:                mapNutritionToJSON(recipe.Nutrition),
+		Steps:                    mapSteps(recipe.Steps),
+		Rating:                   recipe.Rating,
+		RatingCount:              recipe.RatingCount,
+		SyncFailures:             recipe.SyncFailures,
+		SyncError:                recipe.SyncError,
+	}
+}
+
+func mapIngredientLines(src []store.RecipeV1IngredientV1) []IngredientLineJSON {
+	result := []IngredientLineJSON{}
+	for _, line := range src {
+		result = append(result, IngredientLineJSON{
+			IngredientID: int(line.IngredientV1ID),
+			Name:         line.Ingredient.Name,
+			Amount:       line.Amount,
+			Unit:         lineUnitName(line),
+		})
+	}
+	return result
+}
+
+func mapSteps(src []store.RecipeStepV1) []RecipeStepJSON {
+	result := []RecipeStepJSON{}
+	for _, step := range src {
+		stepJSON := RecipeStepJSON{
+			Position:    step.Position,
+			Text:        step.Text,
+			Ingredients: []StepIngredientJSON{},
+		}
+		if step.TimerInSeconds.Valid {
+			timer := step.TimerInSeconds.Int64
+			stepJSON.TimerInSeconds = &timer
+		}
+		for _, link := range step.Ingredients {
+			stepJSON.Ingredients = append(stepJSON.Ingredients, StepIngredientJSON{
+				IngredientID: int(link.IngredientV1ID),
+				Name:         link.Ingredient.Name,
+			})
+		}
+		result = append(result, stepJSON)
+	}
+	return result
+}
+
+func mapRecipeToRequest(recipe store.RecipeV1) RecipeRequestJSON {
+	result := RecipeRequestJSON{
+		Title:                    recipe.Title,
+		Description:              recipe.Description,
+		Ingredients:              []IngredientLineRequestJSON{},
+		PreparationTimeInMinutes: recipe.PreparationTimeInMinutes,
+		CookingTimeInMinutes:     recipe.CookingTimeInMinutes,
+		Portions:                 recipe.Portions,
+		DifficultyID:             recipe.RecipeDifficultyID,
+		Tags:                     mapTags(recipe.Tags),
+	}
+
+	for _, line := range recipe.Ingredients {
+		result.Ingredients = append(result.Ingredients, IngredientLineRequestJSON{
+			Ingredient: line.Ingredient.Name,
+			Amount:     line.Amount,
+			Unit:       lineUnitName(line),
+		})
+	}
+
+	return result
+}
+
+// mapRecipeToDraft makes a draft of the recipe to edit it, lines keep their unit
+func mapRecipeToDraft(recipe store.RecipeV1) store.RecipeDraft {
+	result := store.RecipeDraft{
+		Title:                    recipe.Title,
+		Description:              recipe.Description,
+		PreparationTimeInMinutes: recipe.PreparationTimeInMinutes,
+		CookingTimeInMinutes:     recipe.CookingTimeInMinutes,
+		Portions:                 recipe.Portions,
+		DifficultyID:             recipe.RecipeDifficultyID,
+		Tags:                     mapTags(recipe.Tags),
+	}
+
+	for _, line := range recipe.Ingredients {
+		result.Ingredients = append(result.Ingredients, store.RecipeLineDraft{
+			Ingredient: line.Ingredient.Name,
+			Amount:     line.Amount,
+			Unit:       lineUnitName(line),
+		})
+	}
+
+	return result
+}
+
+func mapRecipeRequest(request RecipeRequestJSON) store.RecipeDraft {
+	result := store.RecipeDraft{
+		Title:                    request.Title,
+		Description:              request.Description,
+		PreparationTimeInMinutes: request.PreparationTimeInMinutes,
+		CookingTimeInMinutes:     request.CookingTimeInMinutes,
+		Portions:                 request.Portions,
+		DifficultyID:             request.DifficultyID,
+		Tags:                     request.Tags,
+	}
+
+	for _, line := range request.Ingredients {
+		result.Ingredients = append(result.Ingredients, store.RecipeLineDraft{
+			Ingredient: line.Ingredient,
+			Amount:     line.Amount,
+			Unit:       line.Unit,
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,321 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// fakeChef fails recipe and plan changes with the error, other methods of the embedded interface aren't used
+type fakeChef struct {
+	Chef
+	err     error
+	recipe  *store.RecipeV1
+	updated []store.RecipeDraft
+	deleted []uint
+	planned []string
+	filters []store.RecipeFilter
+}
+
+func (c *fakeChef) GetRecipes(page int, pageSize int, filter store.RecipeFilter) (*store.Recipes, error) {
+	c.filters = append(c.filters, filter)
+	return &store.Recipes{Page: page, PageSize: pageSize, Filter: filter}, nil
+}
+
+func (c *fakeChef) GetRecipe(id uint) (*store.RecipeV1, error) {
+	if c.recipe == nil {
+		return nil, store.ErrNotFound
+	}
+	return c.recipe, nil
+}
+
+func (c *fakeChef) CreateRecipe(draft store.RecipeDraft) (*store.RecipeV1, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &store.RecipeV1{ID: 1, Title: draft.Title}, nil
+}
+
+func (c *fakeChef) UpdateRecipe(id uint, draft store.RecipeDraft) (*store.RecipeV1, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.updated = append(c.updated, draft)
+	return &store.RecipeV1{ID: id, Title: draft.Title}, nil
+}
+
+func (c *fakeChef) DeleteRecipe(id uint) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.deleted = append(c.deleted, id)
+	return nil
+}
+
+func TestRecipeChangesErrors(t *testing.T) {
+	const recipe = `{"title": "Pancakes", "ingredients": [{"name": "Flour", "amount": 200, "unit": "g"}]}`
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		err        error
+		wantStatus int
+	}{
+		{name: "create invalid recipe", method: http.MethodPost, path: "/api/v1/recipes", body: recipe,
+			err: fmt.Errorf("invalid recipe: title is required: %w", store.ErrInvalid), wantStatus: http.StatusUnprocessableEntity},
+		{name: "create recipe of existing title", method: http.MethodPost, path: "/api/v1/recipes", body: recipe,
+			err: store.ErrConflict, wantStatus: http.StatusConflict},
+		{name: "create recipe of malformed body", method: http.MethodPost, path: "/api/v1/recipes", body: `{"title": `,
+			wantStatus: http.StatusBadRequest},
+		{name: "update invalid recipe", method: http.MethodPut, path: "/api/v1/recipes/1", body: recipe,
+			err: fmt.Errorf("incompatible units: %w", store.ErrInvalid), wantStatus: http.StatusUnprocessableEntity},
+		{name: "update unknown recipe", method: http.MethodPut, path: "/api/v1/recipes/7", body: recipe,
+			err: store.ErrNotFound, wantStatus: http.StatusNotFound},
+		{name: "delete recipe of servings", method: http.MethodDelete, path: "/api/v1/recipes/1",
+			err: fmt.Errorf("recipe has servings: %w", store.ErrConflict), wantStatus: http.StatusConflict},
+		{name: "delete unknown recipe", method: http.MethodDelete, path: "/api/v1/recipes/7",
+			err: store.ErrNotFound, wantStatus: http.StatusNotFound},
+		{name: "delete recipe of invalid id", method: http.MethodDelete, path: "/api/v1/recipes/first",
+			wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chef := &fakeChef{err: tt.err}
+			server := Server{Chef: chef}
+
+			response := httptest.NewRecorder()
+			server.routes().ServeHTTP(response, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if response.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", response.Code, tt.wantStatus, response.Body)
+			}
+
+			var body struct {
+				Error   string `json:"error"`
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil || body.Error == "" || body.Message == "" {
+				t.Errorf("body = %s, want error and message", response.Body)
+			}
+			if len(chef.deleted) != 0 {
+				t.Errorf("recipes are deleted: %v", chef.deleted)
+			}
+		})
+	}
+}
+
+func TestDeleteRecipe(t *testing.T) {
+	chef := &fakeChef{}
+	server := Server{Chef: chef}
+
+	response := httptest.NewRecorder()
+	server.routes().ServeHTTP(response, httptest.NewRequest(http.MethodDelete, "/api/v1/recipes/3", nil))
+
+	if response.Code != http.StatusNoContent || response.Body.Len() != 0 {
+		t.Errorf("response = %d %q, want 204 without body", response.Code, response.Body)
+	}
+	if !reflect.DeepEqual(chef.deleted, []uint{3}) {
+		t.Errorf("deleted recipes = %v, want [3]", chef.deleted)
+	}
+}
+
+func TestPatchRecipe(t *testing.T) {
+	grams := store.UnitV1{ID: 1, Name: "g"}
+	recipe := &store.RecipeV1{
+		ID:       1,
+		Title:    "Pancakes",
+		Portions: 2,
+		Ingredients: []store.RecipeV1IngredientV1{
+			{Amount: 200, Ingredient: store.IngredientV1{Name: "Flour"}, Unit: &grams},
+			{Amount: 2, Ingredient: store.IngredientV1{Name: "Egg"}},
+		},
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want store.RecipeDraft
+	}{
+		{
+			name: "title",
+			body: `{"title": "Crepes"}`,
+			want: store.RecipeDraft{Title: "Crepes", Portions: 2, Ingredients: []store.RecipeLineDraft{
+				{Ingredient: "Flour", Amount: 200, Unit: "g"},
+				{Ingredient: "Egg", Amount: 2},
+			}},
+		},
+		{
+			name: "gram line replaced by unitless line",
+			body: `{"ingredients": [{"ingredient": "Egg", "amount": 3}]}`,
+			want: store.RecipeDraft{Title: "Pancakes", Portions: 2, Ingredients: []store.RecipeLineDraft{
+				{Ingredient: "Egg", Amount: 3},
+			}},
+		},
+		{
+			name: "line without amount",
+			body: `{"ingredients": [{"ingredient": "Salt", "unit": "pinch"}]}`,
+			want: store.RecipeDraft{Title: "Pancakes", Portions: 2, Ingredients: []store.RecipeLineDraft{
+				{Ingredient: "Salt", Unit: "pinch"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chef := &fakeChef{recipe: recipe}
+			server := Server{Chef: chef}
+
+			response := httptest.NewRecorder()
+			server.routes().ServeHTTP(response, httptest.NewRequest(http.MethodPatch, "/api/v1/recipes/1", strings.NewReader(tt.body)))
+
+			if response.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", response.Code, http.StatusOK, response.Body)
+			}
+			if len(chef.updated) != 1 {
+				t.Fatalf("updates = %d, want 1", len(chef.updated))
+			}
+			draft := chef.updated[0]
+			if draft.Title != tt.want.Title || draft.Portions != tt.want.Portions || !reflect.DeepEqual(draft.Ingredients, tt.want.Ingredients) {
+				t.Errorf("draft = %+v, want %+v", draft, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRecipesOfDifficulty(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		wantStatus     int
+		wantDifficulty uint
+	}{
+		{name: "difficulty", query: "difficulty=2", wantStatus: http.StatusOK, wantDifficulty: 2},
+		{name: "any difficulty", query: "difficulty=", wantStatus: http.StatusOK},
+		{name: "difficulty of name", query: "difficulty=hard", wantStatus: http.StatusBadRequest},
+		{name: "negative difficulty", query: "difficulty=-1", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chef := &fakeChef{}
+			server := Server{Chef: chef}
+
+			response := httptest.NewRecorder()
+			server.routes().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/recipes?page=1&pageSize=9&"+tt.query, nil))
+
+			if response.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", response.Code, tt.wantStatus, response.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if len(chef.filters) != 0 {
+					t.Errorf("recipes are loaded of invalid filter: %+v", chef.filters)
+				}
+				return
+			}
+
+			if len(chef.filters) != 1 || chef.filters[0].DifficultyID != tt.wantDifficulty {
+				t.Fatalf("filters = %+v, want difficulty %d", chef.filters, tt.wantDifficulty)
+			}
+			var body RecipesResultsJSON
+			if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Filter.DifficultyID != tt.wantDifficulty {
+				t.Errorf("difficulty of response filter = %d, want %d", body.Filter.DifficultyID, tt.wantDifficulty)
+			}
+		})
+	}
+}
+
+func TestGetRecipesFilter(t *testing.T) {
+	server := Server{Chef: &fakeChef{}}
+
+	response := httptest.NewRecorder()
+	server.routes().ServeHTTP(response, httptest.NewRequest(http.MethodGet,
+		"/api/v1/recipes?page=1&pageSize=9&searchTerm=soup&minRating=4&difficulty=2&sort=rating", nil))
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", response.Code, http.StatusOK, response.Body)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"minRating", "difficulty", "difficultyId", "sort"} {
+		if _, ok := body[key]; ok {
+			t.Errorf("response has %s out of the filter: %s", key, response.Body)
+		}
+	}
+
+	want := map[string]any{"minRating": 4.0, "difficulty": 2.0, "sort": "rating"}
+	if !reflect.DeepEqual(body["filter"], want) {
+		t.Errorf("filter = %v, want %v", body["filter"], want)
+	}
+}
+
+func TestFilterQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter store.RecipeFilter
+		want   string
+	}{
+		{name: "empty", filter: store.RecipeFilter{}, want: ""},
+		{name: "search term", filter: store.RecipeFilter{SearchTerm: "tomato soup"}, want: "searchTerm=tomato+soup"},
+		{
+			name: "whole filter",
+			filter: store.RecipeFilter{
+				SearchTerm:            "soup",
+				Ingredients:           []string{"egg", "salt, coarse"},
+				ExcludedIngredients:   []string{"milk"},
+				MaxTotalTimeInMinutes: 30,
+				DifficultyID:          2,
+				MinRating:             3.5,
+				Tags:                  []string{"quick"},
+				CookedWithinDays:      14,
+				Sort:                  store.RecipeSortRating,
+			},
+			want: "cookedWithinDays=14&difficulty=2&excludeIngredients=milk&ingredients=egg&ingredients=salt%2C+coarse" +
+				"&maxTotalTime=30&minRating=3.5&searchTerm=soup&sort=rating&tags=quick",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterQuery(tt.filter); got != tt.want {
+				t.Errorf("filterQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterQueryIsParsedBack(t *testing.T) {
+	filter := store.RecipeFilter{
+		SearchTerm:            "soup",
+		Ingredients:           []string{"egg"},
+		ExcludedIngredients:   []string{"milk", "cream"},
+		MaxTotalTimeInMinutes: 30,
+		DifficultyID:          2,
+		MinRating:             4,
+		Tags:                  []string{"quick"},
+		CookedWithinDays:      14,
+		Sort:                  store.RecipeSortLastCooked,
+	}
+
+	parsed, err := parseRecipeFilter(httptest.NewRequest("GET", "/recipes/more?page=2&pageSize=9&"+filterQuery(filter), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, filter) {
+		t.Errorf("parsed filter = %+v, want %+v", parsed, filter)
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+type ShoppingListJSON struct {
+	From  *string            `json:"from,omitempty"`
+	To    *string            `json:"to,omitempty"`
+	Items []ShoppingItemJSON `json:"items"`
+}
+
+type ShoppingItemJSON struct {
+	IngredientID int     `json:"ingredientId"`
+	Name         string  `json:"name"`
+	Unit         string  `json:"unit"`
+	Required     float64 `json:"required"`
+	InPantry     float64 `json:"inPantry"`
+	ToBuy        float64 `json:"toBuy"`
+	Checked      bool    `json:"checked"`
+}
+
+// GET /v1/shopping-list?from=&to=
+func (s Server) getShoppingListCtrl(w http.ResponseWriter, r *http.Request) {
+	from, to, err := s.parseDateRange(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid date range", err)
+		return
+	}
+
+	list, err := s.Shopper.GetShoppingList(from, to)
+	if err != nil {
+		renderInternalServerError(w, r, "failed to build shopping list", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, mapShoppingListToJSON(list))
+}
+
+// POST /v1/shopping-list/{id}/check
+func (s Server) checkShoppingListItemCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid ingredient id", err)
+		return
+	}
+
+	if err := s.Shopper.CheckItem(id); err != nil {
+		renderError(w, r, "failed to check shopping list item", err)
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+// DELETE /v1/shopping-list/{id}/check
+func (s Server) uncheckShoppingListItemCtrl(w http.ResponseWriter, r *http.Request) {
+	id, err := parseIDParam(r)
+	if err != nil {
+		renderBadRequest(w, r, "invalid ingredient id", err)
+		return
+	}
+
+	if err := s.Shopper.UncheckItem(id); err != nil {
+		renderError(w, r, "failed to uncheck shopping list item", err)
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+// DELETE /v1/shopping-list/checks
+func (s Server) clearShoppingListChecksCtrl(w http.ResponseWriter, r *http.Request) {
+	if err := s.Shopper.ClearChecks(); err != nil {
+		renderInternalServerError(w, r, "failed to clear shopping list checks", err)
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+func mapShoppingListToJSON(list *store.ShoppingList) *ShoppingListJSON {
+	result := ShoppingListJSON{
+		Items: []ShoppingItemJSON{},
+	}
+
+	if list.From.Valid && list.To.Valid {
+		from := list.From.Time.Format(time.DateOnly)
+		to := list.To.Time.Format(time.DateOnly)
+		result.From = &from
+		result.To = &to
+	}
+
+	for _, item := range list.Items {
+		result.Items = append(result.Items, ShoppingItemJSON{
+			IngredientID: int(item.Ingredient.ID),
+			Name:         item.Ingredient.Name,
+			Unit:         item.Ingredient.Unit.Name,
+			Required:     item.Required,
+			InPantry:     item.InPantry,
+			ToBuy:        item.ToBuy,
+			Checked:      item.Checked,
+		})
+	}
+
+	return &result
+}
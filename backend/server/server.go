@@ -2,8 +2,10 @@ package server
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
 	"mime"
 	"net/http"
@@ -27,6 +29,7 @@ type Server struct {
 	Chef          Chef
 	Scheduler     Scheduler
 	Pantry        Pantry
+	Shopper       Shopper
 	Worker        Worker
 	Version       string
 	TemplateCache map[string]*template.Template
@@ -34,32 +37,82 @@ type Server struct {
 }
 
 type Chef interface {
-	GetRecipes(page int, pageSize int, searchTerm string) (recipes *store.Recipes, err error)
+	GetRecipes(page int, pageSize int, filter store.RecipeFilter) (recipes *store.Recipes, err error)
+	GetRecipe(id uint) (recipe *store.RecipeV1, err error)
+	CreateRecipe(draft store.RecipeDraft) (recipe *store.RecipeV1, err error)
+	ImportRecipe(ctx context.Context, pageUrl string) (recipe *store.RecipeV1, err error)
+	UpdateRecipe(id uint, draft store.RecipeDraft) (recipe *store.RecipeV1, err error)
+	DeleteRecipe(id uint) (err error)
+	GetRecipeDifficulties() (difficulties *[]store.RecipeDifficultyV1, err error)
+	CheckSearchIndex() (status *store.SearchIndexStatus, err error)
+	RebuildSearchIndex() (status *store.SearchIndexStatus, err error)
+	SaveRecipeThumbnail(id uint, content io.Reader) (recipe *store.RecipeV1, err error)
+	SaveRecipePdf(id uint, content io.Reader) (recipe *store.RecipeV1, err error)
 	GetServings() (servings *[]store.ServingV1, err error)
 	SaveServing(serving *store.ServingV1) (err error)
+	CreateServing(recipeID uint, portions uint) (serving *store.ServingV1, err error)
 	GetServing(id uint) (serving *store.ServingV1, err error)
+	GetBacklog() (servings *[]store.ServingV1, err error)
+	PlanWeek(week *store.Week) (result *store.Week, err error)
+	GetPlanNutrition(from time.Time, to time.Time) (summary *store.NutritionSummary, err error)
+	AssignServing(id uint, day time.Time, mealSlotID uint) (err error)
+	MoveServing(id uint, day time.Time) (err error)
+	UnassignServing(id uint) (err error)
+	CookServing(id uint) (serving *store.ServingV1, err error)
+	UncookServing(id uint) (err error)
+	RateServing(id uint, rating uint, notes string) (serving *store.ServingV1, err error)
+	CookRatedServing(id uint, rating uint, notes string) (serving *store.ServingV1, err error)
 }
 
 type Pantry interface {
 	GetIngredients() (ingridients *store.Ingredients, err error)
 	GetUnits() (units *[]store.UnitV1, err error)
 	SaveIngredient(ingredient *store.IngredientV1) (err error)
+	GetPantry() (items *[]store.PantryItem, err error)
+	GetPantryItem(ingredientID uint) (item *store.PantryItem, err error)
+	AddToPantry(draft store.PantryDraft) (item *store.PantryItem, err error)
+	UpdatePantryItem(ingredientID uint, draft store.PantryDraft) (item *store.PantryItem, err error)
+	DeletePantryItem(ingredientID uint) (err error)
+	Convert(amount float64, from string, to string) (result float64, err error)
+}
+
+type Shopper interface {
+	GetShoppingList(from sql.NullTime, to sql.NullTime) (list *store.ShoppingList, err error)
+	CheckItem(ingredientID uint) (err error)
+	UncheckItem(ingredientID uint) (err error)
+	ClearChecks() (err error)
 }
 
 type Scheduler interface {
 	GetWeek() (week *store.Week, err error)
 	GetNextWeek() (week *store.Week, err error)
+	ParseDay(id string) (day time.Time, err error)
+	GetMealSlots() (mealSlots *[]store.MealSlotV1, err error)
+	GetMealSlot(id uint) (mealSlot *store.MealSlotV1, err error)
+	SaveMealSlot(mealSlot *store.MealSlotV1) (err error)
+	DeleteMealSlot(id uint) (err error)
 }
 
 type Worker interface {
-	RunSyncRecipes() (job *store.JobV1, err error)
+	RunSyncRecipes(force bool) (job *store.JobV1, err error)
+	RunSyncRecipe(id uint) (job *store.JobV1, err error)
+	GetJobs() (jobs *[]store.JobV1, err error)
+	GetJob(id uint) (job *store.JobV1, err error)
+	CancelJob(id uint) (job *store.JobV1, err error)
+	ResetRecipeSyncFailures(id uint) (err error)
 }
 
 type Settings struct {
-	RunMigration           bool
-	PdfReaderEndpoint      string
-	WorkerTimeoutInSeconds int64
-	StaticContentEndpoint  string
+	RunMigration              bool
+	PdfExtractor              string
+	PdfReaderEndpoint         string
+	WorkerTimeoutInSeconds    int64
+	WorkerConcurrency         int
+	WorkerRateLimitPerSecond  float64
+	PdfReaderTimeoutInSeconds int64
+	PdfReaderMaxRetries       int
+	SyncMaxFailures           uint
+	StaticContentEndpoint     string
 }
 
 // Run the lisener and request's router, activate rest server
@@ -102,6 +155,51 @@ func (s Server) routes() chi.Router {
 		r.Use(Logger(log.Default()))
 		r.Get("/recipes", s.getRecepiesCtrl)
 		r.Post("/recipes/sync", s.syncRecepiesCtrl)
+		r.Post("/recipes", s.createRecipeCtrl)
+		r.Post("/recipes/import", s.importRecipeCtrl)
+		r.Get("/recipes/{id}", s.getRecipeCtrl)
+		r.Put("/recipes/{id}", s.updateRecipeCtrl)
+		r.Patch("/recipes/{id}", s.patchRecipeCtrl)
+		r.Delete("/recipes/{id}", s.deleteRecipeCtrl)
+		r.Post("/recipes/{id}/sync", s.syncRecipeCtrl)
+		r.Delete("/recipes/{id}/sync-failures", s.resetRecipeSyncFailuresCtrl)
+
+		r.Get("/difficulties", s.getDifficultiesCtrl)
+
+		r.Get("/plan", s.getPlanCtrl)
+		r.Get("/plan/nutrition", s.getPlanNutritionCtrl)
+		r.Post("/servings", s.createServingCtrl)
+		r.Put("/servings/{id}/plan", s.planServingCtrl)
+		r.Delete("/servings/{id}/plan", s.unplanServingCtrl)
+		r.Post("/servings/{id}/cook", s.cookServingCtrl)
+		r.Delete("/servings/{id}/cook", s.uncookServingCtrl)
+		r.Post("/servings/{id}/rating", s.rateServingCtrl)
+
+		r.Get("/shopping-list", s.getShoppingListCtrl)
+		r.Delete("/shopping-list/checks", s.clearShoppingListChecksCtrl)
+		r.Post("/shopping-list/{id}/check", s.checkShoppingListItemCtrl)
+		r.Delete("/shopping-list/{id}/check", s.uncheckShoppingListItemCtrl)
+
+		r.Get("/pantry", s.getPantryCtrl)
+		r.Post("/pantry", s.addToPantryCtrl)
+		r.Get("/pantry/{id}", s.getPantryItemCtrl)
+		r.Put("/pantry/{id}", s.updatePantryItemCtrl)
+		r.Delete("/pantry/{id}", s.deletePantryItemCtrl)
+
+		r.Get("/jobs", s.getJobsCtrl)
+		r.Get("/jobs/{id}", s.getJobCtrl)
+		r.Post("/jobs/{id}/cancel", s.cancelJobCtrl)
+
+		r.Get("/units", s.getUnitsCtrl)
+		r.Get("/units/convert", s.convertUnitsCtrl)
+
+		r.Get("/meal-slots", s.getMealSlotsCtrl)
+		r.Post("/meal-slots", s.createMealSlotCtrl)
+		r.Put("/meal-slots/{id}", s.updateMealSlotCtrl)
+		r.Delete("/meal-slots/{id}", s.deleteMealSlotCtrl)
+
+		r.Get("/admin/search-index", s.checkSearchIndexCtrl)
+		r.Post("/admin/search-index/rebuild", s.rebuildSearchIndexCtrl)
 	})
 
 	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
@@ -120,15 +218,31 @@ func (s Server) routes() chi.Router {
 		r.Get("/", s.indexCtrl)
 
 		r.Post("/servings/cooked", s.cookedViewCtrl)
+		r.Post("/servings/uncook", s.uncookViewCtrl)
+		r.Post("/servings/assign", s.assignServingViewCtrl)
+		r.Post("/servings/move", s.moveServingViewCtrl)
+		r.Post("/servings/unassign", s.unassignServingViewCtrl)
 
 		r.Get("/recipes", s.recipesViewCtrl)
 		r.Get("/recipes/more", s.moreRecipesViewCtrl)
 		r.Post("/recipes/select", s.selectRecipeViewCtrl)
+		r.Get("/recipes/view", s.recipeViewCtrl)
+		r.Get("/recipes/add", s.recipeFormViewCtrl)
+		r.Post("/recipes/add", s.createRecipeViewCtrl)
+		r.Get("/recipes/edit", s.editRecipeViewCtrl)
+		r.Post("/recipes/edit", s.updateRecipeViewCtrl)
+		r.Get("/recipes/line", s.recipeLineViewCtrl)
+
+		r.Get("/shopping", s.shoppingListViewCtrl)
+		r.Post("/shopping/check", s.checkShoppingListItemViewCtrl)
+		r.Post("/shopping/clear", s.clearShoppingListChecksViewCtrl)
 
 		r.Get("/pantry", s.pantryViewCtrl)
 		r.Get("/pantry/add", s.ingredientFormViewCtrl)
-		//r.Post("/pantry/add", s.createIngredientViewCtrl) todo move to pentry logic version 0.0.2
+		r.Post("/pantry/add", s.createIngredientViewCtrl)
 		r.Get("/pantry/edit", s.editIngredientViewCtrl)
+		r.Post("/pantry/edit", s.updateIngredientViewCtrl)
+		r.Post("/pantry/delete", s.deleteIngredientViewCtrl)
 	})
 
 	// Serve static JavaScript and CSS files from the embedded content
@@ -182,6 +296,36 @@ func parseQueryParam(param string) (int, error) {
 	return value, nil
 }
 
+// parseDateRange parses optional from and to days, both or none of them should be set
+func (s Server) parseDateRange(r *http.Request) (from sql.NullTime, to sql.NullTime, err error) {
+	fromValue := strings.TrimSpace(r.URL.Query().Get("from"))
+	toValue := strings.TrimSpace(r.URL.Query().Get("to"))
+
+	if fromValue == "" && toValue == "" {
+		return sql.NullTime{}, sql.NullTime{}, nil
+	}
+
+	if fromValue == "" || toValue == "" {
+		return sql.NullTime{}, sql.NullTime{}, fmt.Errorf("both from and to should be set")
+	}
+
+	fromDay, err := s.Scheduler.ParseDay(fromValue)
+	if err != nil {
+		return sql.NullTime{}, sql.NullTime{}, err
+	}
+
+	toDay, err := s.Scheduler.ParseDay(toValue)
+	if err != nil {
+		return sql.NullTime{}, sql.NullTime{}, err
+	}
+
+	if toDay.Before(fromDay) {
+		return sql.NullTime{}, sql.NullTime{}, fmt.Errorf("to should not be before from")
+	}
+
+	return sql.NullTime{Time: fromDay, Valid: true}, sql.NullTime{Time: toDay, Valid: true}, nil
+}
+
 func renderBadRequest(w http.ResponseWriter, r *http.Request, message string, err error) {
 	log.Printf("[ERROR] %s: %v", message, err)
 	render.Status(r, http.StatusBadRequest)
@@ -193,3 +337,31 @@ func renderInternalServerError(w http.ResponseWriter, r *http.Request, message s
 	render.Status(r, http.StatusInternalServerError)
 	render.JSON(w, r, JSON{"error": err.Error(), "message": message})
 }
+
+func parseIDParam(r *http.Request) (uint, error) {
+	value, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(value), nil
+}
+
+// renderError renders an error with the status code matching its store error kind
+func renderError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	var status int
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, store.ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, store.ErrInvalid):
+		status = http.StatusUnprocessableEntity
+	default:
+		renderInternalServerError(w, r, message, err)
+		return
+	}
+
+	log.Printf("[WARN] %s: %v", message, err)
+	render.Status(r, status)
+	render.JSON(w, r, JSON{"error": err.Error(), "message": message})
+}
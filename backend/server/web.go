@@ -3,11 +3,15 @@ package server
 import (
 	"bytes"
 	"database/sql"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -24,30 +28,84 @@ const (
 	recipesTmplName        = "recipes.tmpl.html"
 	moreRecipesTmplName    = "more-recipes.tmpl.html"
 	pantryTmplName         = "pantry.tmpl.html"
+	shoppingListTmplName   = "shopping-list.tmpl.html"
 	ingredientFormTmplName = "ingredient-form.tmpl.html"
+	recipeFormTmplName     = "recipe-form.tmpl.html"
+	recipeTmplName         = "recipe.tmpl.html"
+
+	recipeLineTmpl = "recipe-line"
+
+	// maxRecipeFormSize limits the recipe form with its thumbnail and pdf uploads
+	maxRecipeFormSize = 32 << 20
 )
 
 type servingsView struct {
-	Servings []store.ServingV1
+	Weeks     []store.Week
+	Days      []store.Day
+	MealSlots []store.MealSlotV1
+	Backlog   []store.ServingV1
+	// Nutrition has a summary per week in the same order
+	Nutrition []store.NutritionSummary
 }
 
 type recipesView struct {
 	RecipesCards recipesCardsView
+	Difficulties []store.RecipeDifficultyV1
 }
 
 type recipesCardsView struct {
-	Recipes    []store.RecipeV1
-	Page       int
-	PageSize   int
-	SearchTerm string
+	Recipes  []store.RecipeV1
+	Snippets map[uint]string
+	Page     int
+	PageSize int
+	// Filter is the filter of the recipes, the next page is loaded with it
+	Filter store.RecipeFilter
+}
+
+// recipeView is the recipe page with its ingredients and instruction steps
+type recipeView struct {
+	Recipe store.RecipeV1
+}
+
+// recipeFormView is the recipe editor, zero ID means a new recipe
+type recipeFormView struct {
+	ID    uint
+	Draft store.RecipeDraft
+	// Tags are the draft tags separated by commas
+	Tags         string
+	ThumbnailUrl string
+	PdfUrl       string
+	Error        string
+
+	Difficulties []store.RecipeDifficultyV1
+	Units        []store.UnitV1
+	Ingredients  []store.IngredientV1
+}
+
+// recipeLineView is an ingredient line of the recipe editor
+type recipeLineView struct {
+	Line  store.RecipeLineDraft
+	Units []store.UnitV1
+}
+
+type shoppingListView struct {
+	Items []store.ShoppingItem
+	From  string
+	To    string
 }
 
 type pantryView struct {
-	Ingredients []store.IngredientV1
+	Items []store.PantryItem
 }
 
+// pantryFormView is the ingredient form, zero ID means an ingredient to add to the pantry
 type pantryFormView struct {
-	Units []store.UnitV1
+	ID    uint
+	Draft store.PantryDraft
+	Error string
+
+	Units       []store.UnitV1
+	Ingredients []store.IngredientV1
 }
 
 type templateData struct {
@@ -90,10 +148,49 @@ func (s Server) render(w http.ResponseWriter, status int, page, tmplName string,
 	}
 }
 
-// renders the home page with servings
+// renders the home page with servings planned for the current and the next week
 // GET /
 func (s Server) indexCtrl(w http.ResponseWriter, r *http.Request) {
-	servings, err := s.Chef.GetServings()
+	currentWeek, err := s.Scheduler.GetWeek()
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	nextWeek, err := s.Scheduler.GetNextWeek()
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	var weeks []store.Week
+	var days []store.Day
+	var mealSlots []store.MealSlotV1
+	var nutrition []store.NutritionSummary
+	for _, week := range []*store.Week{currentWeek, nextWeek} {
+		plannedWeek, err := s.Chef.PlanWeek(week)
+		if err != nil {
+			log.Printf("[ERROR] %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		summary, err := s.Chef.GetPlanNutrition(plannedWeek.Days[0].Date, plannedWeek.Days[len(plannedWeek.Days)-1].Date)
+		if err != nil {
+			log.Printf("[ERROR] %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		weeks = append(weeks, *plannedWeek)
+		days = append(days, plannedWeek.Days...)
+		mealSlots = plannedWeek.MealSlots
+		nutrition = append(nutrition, *summary)
+	}
+
+	backlog, err := s.Chef.GetBacklog()
 	if err != nil {
 		log.Printf("[ERROR] %v", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -102,14 +199,18 @@ func (s Server) indexCtrl(w http.ResponseWriter, r *http.Request) {
 
 	data := templateData{
 		View: servingsView{
-			Servings: *servings,
+			Weeks:     weeks,
+			Days:      days,
+			MealSlots: mealSlots,
+			Backlog:   *backlog,
+			Nutrition: nutrition,
 		},
 	}
 
 	s.render(w, http.StatusOK, servingsTmplName, baseTmpl, data)
 }
 
-// mark a serving as cooked
+// mark a serving as cooked and deduct its ingredients from the pantry, an optional rating with notes rates the serving
 // POST /servings/cooked
 func (s Server) cookedViewCtrl(w http.ResponseWriter, r *http.Request) {
 	servingId, err := strconv.ParseUint(r.FormValue("servingID"), 10, 32)
@@ -119,21 +220,126 @@ func (s Server) cookedViewCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	serving, err := s.Chef.GetServing(uint(servingId))
+	var rating uint64
+	if value := r.FormValue("rating"); value != "" {
+		rating, err = strconv.ParseUint(value, 10, 32)
+		if err != nil || rating == 0 {
+			log.Printf("[ERROR] invalid rating %q", value)
+			http.Error(w, "invalid rating parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// the rating and its notes are checked before cooking, so a bad rating doesn't leave the serving cooked without it
+	if rating > 0 {
+		_, err = s.Chef.CookRatedServing(uint(servingId), uint(rating), r.FormValue("notes"))
+	} else {
+		_, err = s.Chef.CookServing(uint(servingId))
+	}
 	if err != nil {
 		log.Printf("[ERROR] %v", err)
+		if errors.Is(err, store.ErrInvalid) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	serving.CookedAt = sql.NullTime{
-		Time:  time.Now().UTC(),
-		Valid: true,
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// undo a serving cooked by mistake and return its ingredients to the pantry
+// POST /servings/uncook
+func (s Server) uncookViewCtrl(w http.ResponseWriter, r *http.Request) {
+	servingId, err := strconv.ParseUint(r.FormValue("servingID"), 10, 32)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "invalid servingID parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Chef.UncookServing(uint(servingId)); err != nil {
+		renderError(w, r, "failed to undo serving cooking", err)
+		return
 	}
 
-	if err := s.Chef.SaveServing(serving); err != nil {
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// plan a serving for a day and an optional meal slot
+// POST /servings/assign
+func (s Server) assignServingViewCtrl(w http.ResponseWriter, r *http.Request) {
+	servingId, err := strconv.ParseUint(r.FormValue("servingID"), 10, 32)
+	if err != nil {
 		log.Printf("[ERROR] %v", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		http.Error(w, "invalid servingID parameter", http.StatusBadRequest)
+		return
+	}
+
+	day, err := s.Scheduler.ParseDay(r.FormValue("day"))
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "invalid day parameter", http.StatusBadRequest)
+		return
+	}
+
+	// meal slot is optional, empty value plans the serving without a slot
+	var mealSlotId uint64
+	if mealSlotValue := r.FormValue("mealSlotID"); mealSlotValue != "" {
+		mealSlotId, err = strconv.ParseUint(mealSlotValue, 10, 32)
+		if err != nil {
+			log.Printf("[ERROR] %v", err)
+			http.Error(w, "invalid mealSlotID parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.Chef.AssignServing(uint(servingId), day, uint(mealSlotId)); err != nil {
+		renderError(w, r, "failed to plan serving", err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// move a planned serving to another day
+// POST /servings/move
+func (s Server) moveServingViewCtrl(w http.ResponseWriter, r *http.Request) {
+	servingId, err := strconv.ParseUint(r.FormValue("servingID"), 10, 32)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "invalid servingID parameter", http.StatusBadRequest)
+		return
+	}
+
+	day, err := s.Scheduler.ParseDay(r.FormValue("day"))
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "invalid day parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Chef.MoveServing(uint(servingId), day); err != nil {
+		renderError(w, r, "failed to move serving", err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// return a planned serving back to the backlog
+// POST /servings/unassign
+func (s Server) unassignServingViewCtrl(w http.ResponseWriter, r *http.Request) {
+	servingId, err := strconv.ParseUint(r.FormValue("servingID"), 10, 32)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "invalid servingID parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Chef.UnassignServing(uint(servingId)); err != nil {
+		renderError(w, r, "failed to unplan serving", err)
 		return
 	}
 
@@ -144,7 +350,14 @@ func (s Server) cookedViewCtrl(w http.ResponseWriter, r *http.Request) {
 // GET /recipes
 func (s Server) recipesViewCtrl(w http.ResponseWriter, r *http.Request) {
 	// it's 9 elements page size due to grid size on HTML, search by default is empty string
-	recipes, err := s.Chef.GetRecipes(1, 9, "")
+	recipes, err := s.Chef.GetRecipes(1, 9, store.RecipeFilter{})
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	difficulties, err := s.Chef.GetRecipeDifficulties()
 	if err != nil {
 		log.Printf("[ERROR] %v", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -154,11 +367,13 @@ func (s Server) recipesViewCtrl(w http.ResponseWriter, r *http.Request) {
 	data := templateData{
 		View: recipesView{
 			RecipesCards: recipesCardsView{
-				Recipes:    recipes.Recipes,
-				Page:       recipes.Page,
-				PageSize:   recipes.PageSize,
-				SearchTerm: recipes.SearchTerm,
+				Recipes:  recipes.Recipes,
+				Snippets: recipes.Snippets,
+				Page:     recipes.Page,
+				PageSize: recipes.PageSize,
+				Filter:   recipes.Filter,
 			},
+			Difficulties: *difficulties,
 		},
 	}
 
@@ -182,9 +397,13 @@ func (s Server) moreRecipesViewCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	searchTerm := r.URL.Query().Get("searchTerm")
+	filter, err := parseRecipeFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	recipes, err := s.Chef.GetRecipes(page, pageSize, searchTerm)
+	recipes, err := s.Chef.GetRecipes(page, pageSize, filter)
 	if err != nil {
 		log.Printf("[ERROR] %v", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -193,10 +412,11 @@ func (s Server) moreRecipesViewCtrl(w http.ResponseWriter, r *http.Request) {
 
 	data := templateData{
 		View: recipesCardsView{
-			Recipes:    recipes.Recipes,
-			Page:       recipes.Page,
-			PageSize:   recipes.PageSize,
-			SearchTerm: recipes.SearchTerm,
+			Recipes:  recipes.Recipes,
+			Snippets: recipes.Snippets,
+			Page:     recipes.Page,
+			PageSize: recipes.PageSize,
+			Filter:   recipes.Filter,
 		},
 	}
 
@@ -213,11 +433,18 @@ func (s Server) selectRecipeViewCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	serving := store.ServingV1{
-		RecipeID: uint(selectedRecipeId),
+	// empty portions means the recipe portions
+	var portions uint64
+	if value := r.FormValue("portions"); value != "" {
+		portions, err = strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			log.Printf("[ERROR] %v", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
 	}
 
-	if err := s.Chef.SaveServing(&serving); err != nil {
+	if _, err := s.Chef.CreateServing(uint(selectedRecipeId), uint(portions)); err != nil {
 		log.Printf("[ERROR] %v", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
@@ -226,13 +453,372 @@ func (s Server) selectRecipeViewCtrl(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/recipes", http.StatusSeeOther)
 }
 
+// renders the recipe form to create a new recipe
+// GET /recipes/add
+func (s Server) recipeFormViewCtrl(w http.ResponseWriter, r *http.Request) {
+	view := recipeFormView{
+		Draft: store.RecipeDraft{
+			// a new recipe starts with an empty ingredient line
+			Ingredients: []store.RecipeLineDraft{{}},
+		},
+	}
+
+	s.renderRecipeForm(w, view)
+}
+
+// renders the recipe page with its ingredients and instruction steps
+// GET /recipes/view?recipeID=
+func (s Server) recipeViewCtrl(w http.ResponseWriter, r *http.Request) {
+	recipeId, err := strconv.ParseUint(r.FormValue("recipeID"), 10, 32)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "invalid recipeID parameter", http.StatusBadRequest)
+		return
+	}
+
+	recipe, err := s.Chef.GetRecipe(uint(recipeId))
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	s.render(w, http.StatusOK, recipeTmplName, recipeTmplName, templateData{View: recipeView{Recipe: *recipe}})
+}
+
+// renders the recipe form with recipe data
+// GET /recipes/edit?recipeID=
+func (s Server) editRecipeViewCtrl(w http.ResponseWriter, r *http.Request) {
+	recipeId, err := strconv.ParseUint(r.FormValue("recipeID"), 10, 32)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "invalid recipeID parameter", http.StatusBadRequest)
+		return
+	}
+
+	recipe, err := s.Chef.GetRecipe(uint(recipeId))
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	view := recipeFormView{
+		ID:    recipe.ID,
+		Draft: mapRecipeToDraft(*recipe),
+	}
+	if recipe.ThumbnailUrl.Valid {
+		view.ThumbnailUrl = recipe.ThumbnailUrl.String
+	}
+	if recipe.PdfUrl.Valid {
+		view.PdfUrl = recipe.PdfUrl.String
+	}
+
+	s.renderRecipeForm(w, view)
+}
+
+// create a new recipe with its uploaded thumbnail and pdf and redirect to the recipes page
+// POST /recipes/add
+func (s Server) createRecipeViewCtrl(w http.ResponseWriter, r *http.Request) {
+	draft, err := parseRecipeForm(r)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recipe, err := s.Chef.CreateRecipe(draft)
+	if err != nil {
+		s.renderRecipeFormError(w, recipeFormView{Draft: draft}, err)
+		return
+	}
+
+	s.saveRecipeFiles(w, r, recipe, draft)
+}
+
+// update a recipe with its uploaded thumbnail and pdf and redirect to the recipes page
+// POST /recipes/edit
+func (s Server) updateRecipeViewCtrl(w http.ResponseWriter, r *http.Request) {
+	draft, err := parseRecipeForm(r)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recipeId, err := strconv.ParseUint(r.FormValue("recipeID"), 10, 32)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "invalid recipeID parameter", http.StatusBadRequest)
+		return
+	}
+
+	recipe, err := s.Chef.UpdateRecipe(uint(recipeId), draft)
+	if err != nil {
+		s.renderRecipeFormError(w, recipeFormView{ID: uint(recipeId), Draft: draft}, err)
+		return
+	}
+
+	s.saveRecipeFiles(w, r, recipe, draft)
+}
+
+// saveRecipeFiles saves the uploaded thumbnail and pdf of a saved recipe, a file which is not uploaded is kept
+func (s Server) saveRecipeFiles(w http.ResponseWriter, r *http.Request, recipe *store.RecipeV1, draft store.RecipeDraft) {
+	uploads := []struct {
+		field string
+		save  func(id uint, content io.Reader) (*store.RecipeV1, error)
+	}{
+		{field: "thumbnail", save: s.Chef.SaveRecipeThumbnail},
+		{field: "pdf", save: s.Chef.SaveRecipePdf},
+	}
+
+	for _, upload := range uploads {
+		file, _, err := r.FormFile(upload.field)
+		if errors.Is(err, http.ErrMissingFile) {
+			continue
+		}
+		if err != nil {
+			log.Printf("[ERROR] %v", err)
+			http.Error(w, fmt.Sprintf("invalid %s file", upload.field), http.StatusBadRequest)
+			return
+		}
+
+		_, err = upload.save(recipe.ID, file)
+		file.Close()
+		if err != nil {
+			// the recipe is saved already, so the form continues as its editor
+			s.renderRecipeFormError(w, recipeFormView{ID: recipe.ID, Draft: draft}, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/recipes", http.StatusSeeOther)
+}
+
+// renders an empty ingredient line of the recipe form
+// GET /recipes/line
+func (s Server) recipeLineViewCtrl(w http.ResponseWriter, r *http.Request) {
+	units, err := s.Pantry.GetUnits()
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	data := recipeLineView{
+		Units: *units,
+	}
+
+	s.render(w, http.StatusOK, recipeFormTmplName, recipeLineTmpl, data)
+}
+
+// renderRecipeFormError re-renders the recipe form with the error of invalid data, other errors fail the request
+func (s Server) renderRecipeFormError(w http.ResponseWriter, view recipeFormView, err error) {
+	if !errors.Is(err, store.ErrInvalid) && !errors.Is(err, store.ErrConflict) && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[WARN] %v", err)
+	view.Error = err.Error()
+
+	s.renderRecipeForm(w, view)
+}
+
+// renderRecipeForm renders the recipe form with difficulties, units and ingredients to choose from
+func (s Server) renderRecipeForm(w http.ResponseWriter, view recipeFormView) {
+	difficulties, err := s.Chef.GetRecipeDifficulties()
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	units, err := s.Pantry.GetUnits()
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	ingredients, err := s.Pantry.GetIngredients()
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	view.Difficulties = *difficulties
+	view.Units = *units
+	view.Ingredients = ingredients.Ingredients
+	view.Tags = strings.Join(view.Draft.Tags, ", ")
+
+	data := templateData{
+		View: view,
+	}
+
+	// the form with an error is rendered with 200, htmx doesn't swap error responses
+	s.render(w, http.StatusOK, recipeFormTmplName, recipeFormTmplName, data)
+}
+
+// parseRecipeForm parses the recipe form, ingredient lines are sent as parallel ingredient, amount and unit values
+func parseRecipeForm(r *http.Request) (draft store.RecipeDraft, err error) {
+	if err := r.ParseMultipartForm(maxRecipeFormSize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return draft, fmt.Errorf("invalid recipe form: %w", err)
+	}
+
+	draft = store.RecipeDraft{
+		Title:       r.FormValue("title"),
+		Description: r.FormValue("description"),
+		Tags:        strings.Split(r.FormValue("tags"), ","),
+	}
+
+	numbers := []struct {
+		field string
+		value *uint
+	}{
+		{field: "preparationTimeInMinutes", value: &draft.PreparationTimeInMinutes},
+		{field: "cookingTimeInMinutes", value: &draft.CookingTimeInMinutes},
+		{field: "portions", value: &draft.Portions},
+		{field: "difficultyID", value: &draft.DifficultyID},
+	}
+	for _, number := range numbers {
+		value := strings.TrimSpace(r.FormValue(number.field))
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return draft, fmt.Errorf("invalid %s parameter", number.field)
+		}
+		*number.value = uint(parsed)
+	}
+
+	names := r.Form["ingredient"]
+	amounts := r.Form["amount"]
+	units := r.Form["unit"]
+	if len(amounts) != len(names) || len(units) != len(names) {
+		return draft, fmt.Errorf("invalid ingredient lines")
+	}
+
+	for i, name := range names {
+		amount := strings.TrimSpace(amounts[i])
+
+		// an empty line added to the editor is ignored
+		if strings.TrimSpace(name) == "" && amount == "" {
+			continue
+		}
+
+		line := store.RecipeLineDraft{
+			Ingredient: name,
+			Unit:       units[i],
+		}
+		if amount != "" {
+			line.Amount, err = strconv.ParseFloat(amount, 64)
+			if err != nil {
+				return draft, fmt.Errorf("invalid amount of %s", name)
+			}
+		}
+
+		draft.Ingredients = append(draft.Ingredients, line)
+	}
+
+	return draft, nil
+}
+
+// renders the shopping list page, optionally for servings planned between from and to
+// GET /shopping?from=&to=
+func (s Server) shoppingListViewCtrl(w http.ResponseWriter, r *http.Request) {
+	from, to, err := s.parseDateRange(r)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "invalid date range", http.StatusBadRequest)
+		return
+	}
+
+	list, err := s.Shopper.GetShoppingList(from, to)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	view := shoppingListView{
+		Items: list.Items,
+	}
+	if list.From.Valid && list.To.Valid {
+		view.From = list.From.Time.Format(time.DateOnly)
+		view.To = list.To.Time.Format(time.DateOnly)
+	}
+
+	data := templateData{
+		View: view,
+	}
+
+	s.render(w, http.StatusOK, shoppingListTmplName, shoppingListTmplName, data)
+}
+
+// check or uncheck a shopping list item and re-render the shopping list
+// POST /shopping/check
+func (s Server) checkShoppingListItemViewCtrl(w http.ResponseWriter, r *http.Request) {
+	ingredientId, err := strconv.ParseUint(r.FormValue("ingredientID"), 10, 32)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "invalid ingredientID parameter", http.StatusBadRequest)
+		return
+	}
+
+	if r.FormValue("checked") == "true" {
+		err = s.Shopper.CheckItem(uint(ingredientId))
+	} else {
+		err = s.Shopper.UncheckItem(uint(ingredientId))
+	}
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, shoppingListLocation(r), http.StatusSeeOther)
+}
+
+// uncheck all shopping list items
+// POST /shopping/clear
+func (s Server) clearShoppingListChecksViewCtrl(w http.ResponseWriter, r *http.Request) {
+	if err := s.Shopper.ClearChecks(); err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, shoppingListLocation(r), http.StatusSeeOther)
+}
+
+// shoppingListLocation keeps the date range of the shopping list page after a form post
+func shoppingListLocation(r *http.Request) string {
+	from := r.FormValue("from")
+	to := r.FormValue("to")
+	if from == "" || to == "" {
+		return "/shopping"
+	}
+
+	return "/shopping?" + url.Values{"from": {from}, "to": {to}}.Encode()
+}
+
 // renders the show pantry page
 // GET /pantry
 func (s Server) pantryViewCtrl(w http.ResponseWriter, r *http.Request) {
-	ingridients, err := s.Pantry.GetIngredients()
-
-	log.Printf("[DEBUG] ingridients: %v", ingridients)
-
+	items, err := s.Pantry.GetPantry()
 	if err != nil {
 		log.Printf("[ERROR] %v", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -241,7 +827,7 @@ func (s Server) pantryViewCtrl(w http.ResponseWriter, r *http.Request) {
 
 	data := templateData{
 		View: pantryView{
-			Ingredients: ingridients.Ingredients,
+			Items: *items,
 		},
 	}
 
@@ -251,6 +837,121 @@ func (s Server) pantryViewCtrl(w http.ResponseWriter, r *http.Request) {
 // renders the ingridient form
 // GET /pantry/add
 func (s Server) ingredientFormViewCtrl(w http.ResponseWriter, r *http.Request) {
+	s.renderIngredientForm(w, pantryFormView{})
+}
+
+// renders ingredient form with ingredient data
+// GET /pantry/edit?ingredientID=
+func (s Server) editIngredientViewCtrl(w http.ResponseWriter, r *http.Request) {
+	ingredientId, err := strconv.ParseUint(r.FormValue("ingredientID"), 10, 32)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "invalid ingredientID parameter", http.StatusBadRequest)
+		return
+	}
+
+	item, err := s.Pantry.GetPantryItem(uint(ingredientId))
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	view := pantryFormView{
+		ID: item.Ingredient.ID,
+		Draft: store.PantryDraft{
+			Ingredient: item.Ingredient.Name,
+			Amount:     item.Amount,
+			Unit:       item.Ingredient.Unit.Name,
+			Density:    item.Ingredient.Density,
+		},
+	}
+
+	s.renderIngredientForm(w, view)
+}
+
+// add an ingredient stock to the pantry and redirect to the pantry page
+// POST /pantry/add
+func (s Server) createIngredientViewCtrl(w http.ResponseWriter, r *http.Request) {
+	draft, err := parseIngredientForm(r)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.Pantry.AddToPantry(draft); err != nil {
+		s.renderIngredientFormError(w, pantryFormView{Draft: draft}, err)
+		return
+	}
+
+	http.Redirect(w, r, "/pantry", http.StatusSeeOther)
+}
+
+// update an ingredient and its pantry stock and redirect to the pantry page
+// POST /pantry/edit
+func (s Server) updateIngredientViewCtrl(w http.ResponseWriter, r *http.Request) {
+	ingredientId, err := strconv.ParseUint(r.FormValue("ingredientID"), 10, 32)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "invalid ingredientID parameter", http.StatusBadRequest)
+		return
+	}
+
+	draft, err := parseIngredientForm(r)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.Pantry.UpdatePantryItem(uint(ingredientId), draft); err != nil {
+		s.renderIngredientFormError(w, pantryFormView{ID: uint(ingredientId), Draft: draft}, err)
+		return
+	}
+
+	http.Redirect(w, r, "/pantry", http.StatusSeeOther)
+}
+
+// remove an ingredient stock from the pantry
+// POST /pantry/delete
+func (s Server) deleteIngredientViewCtrl(w http.ResponseWriter, r *http.Request) {
+	ingredientId, err := strconv.ParseUint(r.FormValue("ingredientID"), 10, 32)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "invalid ingredientID parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.Pantry.DeletePantryItem(uint(ingredientId)); err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/pantry", http.StatusSeeOther)
+}
+
+// renderIngredientFormError re-renders the ingredient form with the error of invalid data, other errors fail the request
+func (s Server) renderIngredientFormError(w http.ResponseWriter, view pantryFormView, err error) {
+	if !errors.Is(err, store.ErrInvalid) && !errors.Is(err, store.ErrConflict) && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[WARN] %v", err)
+	view.Error = err.Error()
+
+	s.renderIngredientForm(w, view)
+}
+
+// renderIngredientForm renders the ingredient form with units and known ingredients to choose from
+func (s Server) renderIngredientForm(w http.ResponseWriter, view pantryFormView) {
 	units, err := s.Pantry.GetUnits()
 	if err != nil {
 		log.Printf("[ERROR] %v", err)
@@ -258,52 +959,46 @@ func (s Server) ingredientFormViewCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ingredients, err := s.Pantry.GetIngredients()
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	view.Units = *units
+	view.Ingredients = ingredients.Ingredients
+
 	data := templateData{
-		View: pantryFormView{
-			Units: *units,
-		},
+		View: view,
 	}
 
+	// the form with an error is rendered with 200, htmx doesn't swap error responses
 	s.render(w, http.StatusOK, ingredientFormTmplName, ingredientFormTmplName, data)
 }
 
-// TODO version 0.0.2
-// create a new ingredient and redirect to the pantry page
-// POST /pantry
-// func (s Server) createIngredientViewCtrl(w http.ResponseWriter, r *http.Request) {
-// 	unitId, err := strconv.ParseUint(r.FormValue("unitID"), 10, 32)
-// 	if err != nil {
-// 		log.Printf("[ERROR] %v", err)
-// 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-// 		return
-// 	}
-
-// 	amount, err := strconv.ParseFloat(r.FormValue("amount"), 64)
-// 	if err != nil {
-// 		log.Printf("[ERROR] %v", err)
-// 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-// 		return
-// 	}
-
-// 	ingredient := store.IngredientV1{
-// 		Name:   r.FormValue("name"),
-// 		Amount: amount,
-// 		UnitID: uint(unitId),
-// 	}
-
-// 	if err := s.Pantry.SaveIngredient(&ingredient); err != nil {
-// 		log.Printf("[ERROR] %v", err)
-// 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-// 		return
-// 	}
-
-// 	http.Redirect(w, r, "/pantry", http.StatusSeeOther)
-// }
+func parseIngredientForm(r *http.Request) (draft store.PantryDraft, err error) {
+	draft = store.PantryDraft{
+		Ingredient: r.FormValue("name"),
+		Unit:       r.FormValue("unit"),
+	}
 
-// renders ingredient form with ingredient data
-// GET /pantry/edit/{id}
-func (s Server) editIngredientViewCtrl(w http.ResponseWriter, r *http.Request) {
-	// TODO version 0.0.2
+	if amount := strings.TrimSpace(r.FormValue("amount")); amount != "" {
+		draft.Amount, err = strconv.ParseFloat(amount, 64)
+		if err != nil {
+			return draft, fmt.Errorf("invalid amount parameter")
+		}
+	}
+
+	if density := strings.TrimSpace(r.FormValue("density")); density != "" {
+		value, err := strconv.ParseFloat(density, 64)
+		if err != nil {
+			return draft, fmt.Errorf("invalid density parameter")
+		}
+		draft.Density = sql.NullFloat64{Float64: value, Valid: true}
+	}
+
+	return draft, nil
 }
 
 func NewTemplateCache() (map[string]*template.Template, error) {
@@ -323,7 +1018,7 @@ func NewTemplateCache() (map[string]*template.Template, error) {
 			page,
 		}
 
-		ts, err := template.New(name).Funcs(template.FuncMap{"until": until, "subtract": subtract, "add": add, "toLowerStr": toLowerStr}).ParseFS(frontend.Templates, patterns...)
+		ts, err := template.New(name).Funcs(template.FuncMap{"until": until, "subtract": subtract, "add": add, "toLowerStr": toLowerStr, "dict": dict, "isSameDay": isSameDay, "formatAmount": formatAmount, "lineUnit": lineUnitName, "formatTimer": formatTimer, "highlight": highlight, "filterQuery": filterQuery}).ParseFS(frontend.Templates, patterns...)
 		if err != nil {
 			return nil, err
 		}
@@ -353,3 +1048,55 @@ func add(first int, second int) int {
 func toLowerStr(input string) string {
 	return strings.ToLower(input)
 }
+
+// dict is a helper function for templates to pass several values to a nested template
+func dict(values ...any) (map[string]any, error) {
+	if len(values)%2 != 0 {
+		return nil, fmt.Errorf("dict expects even number of arguments, got %d", len(values))
+	}
+
+	result := make(map[string]any, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		key, ok := values[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v is not a string", values[i])
+		}
+		result[key] = values[i+1]
+	}
+
+	return result, nil
+}
+
+func isSameDay(first time.Time, second time.Time) bool {
+	return first.UTC().Format(time.DateOnly) == second.UTC().Format(time.DateOnly)
+}
+
+// formatAmount prints an amount rounded to two decimals without trailing zeros
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(math.Round(amount*100)/100, 'f', -1, 64)
+}
+
+// formatTimer prints a step timer like "1 h 20 min" or "45 s"
+func formatTimer(seconds int64) string {
+	duration := time.Duration(seconds) * time.Second
+
+	parts := []string{}
+	if hours := int64(duration.Hours()); hours > 0 {
+		parts = append(parts, fmt.Sprintf("%d h", hours))
+	}
+	if minutes := int64(duration.Minutes()) % 60; minutes > 0 {
+		parts = append(parts, fmt.Sprintf("%d min", minutes))
+	}
+	if secs := seconds % 60; secs > 0 || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("%d s", secs))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// highlight renders a search snippet, the text is escaped but the <mark> tags around matching words are kept
+func highlight(snippet string) template.HTML {
+	escaped := template.HTMLEscapeString(snippet)
+	escaped = strings.NewReplacer("&lt;mark&gt;", "<mark>", "&lt;/mark&gt;", "</mark>").Replace(escaped)
+	return template.HTML(escaped)
+}
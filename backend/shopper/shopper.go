@@ -0,0 +1,162 @@
+package shopper
+
+import (
+	"database/sql"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rjxby/eat-repeat/backend/pantry"
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// ShoppingProc builds shopping lists from planned servings and the pantry
+type ShoppingProc struct {
+	engine Engine
+}
+
+// New makes ShoppingProc
+func New(engine Engine) *ShoppingProc {
+	return &ShoppingProc{
+		engine: engine,
+	}
+}
+
+// Engine defines interface to load servings and pantry, save and load shopping list checks
+type Engine interface {
+	LoadServings() (result *[]store.ServingV1, err error)
+	LoadPlannedServings(from time.Time, to time.Time) (result *[]store.ServingV1, err error)
+	LoadPantry() (result *[]store.PantryV1, err error)
+	GetUnits() (result *[]store.UnitV1, err error)
+	LoadShoppingChecks() (result *[]store.ShoppingCheckV1, err error)
+	SaveShoppingCheck(check *store.ShoppingCheckV1) (err error)
+	DeleteShoppingCheck(ingredientID uint) (err error)
+	ClearShoppingChecks() (err error)
+}
+
+// GetShoppingList aggregates ingredients of all servings to cook, or only the ones planned
+// between from and to (both inclusive) when the range is valid, and subtracts the pantry stock
+func (p ShoppingProc) GetShoppingList(from sql.NullTime, to sql.NullTime) (list *store.ShoppingList, err error) {
+	var servings *[]store.ServingV1
+	if from.Valid && to.Valid {
+		servings, err = p.engine.LoadPlannedServings(from.Time, to.Time)
+	} else {
+		servings, err = p.engine.LoadServings()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pantryStock, err := p.engine.LoadPantry()
+	if err != nil {
+		return nil, err
+	}
+
+	checks, err := p.engine.LoadShoppingChecks()
+	if err != nil {
+		return nil, err
+	}
+
+	units, err := p.engine.GetUnits()
+	if err != nil {
+		return nil, err
+	}
+
+	list = &store.ShoppingList{
+		From:  from,
+		To:    to,
+		Items: buildShoppingItems(pantry.NewCatalogue(*units), *servings, *pantryStock, *checks),
+	}
+
+	log.Printf("[INFO] shopping list is built: %d items", len(list.Items))
+
+	return list, nil
+}
+
+// CheckItem marks an ingredient of the shopping list as bought
+func (p ShoppingProc) CheckItem(ingredientID uint) (err error) {
+	check := store.ShoppingCheckV1{
+		IngredientV1ID: ingredientID,
+		CheckedAt:      time.Now().UTC(),
+	}
+
+	if err := p.engine.SaveShoppingCheck(&check); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] shopping list item %d is checked", ingredientID)
+
+	return nil
+}
+
+// UncheckItem returns an ingredient back to the shopping list
+func (p ShoppingProc) UncheckItem(ingredientID uint) (err error) {
+	if err := p.engine.DeleteShoppingCheck(ingredientID); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] shopping list item %d is unchecked", ingredientID)
+
+	return nil
+}
+
+// ClearChecks unchecks all items, e.g. before the next shopping trip
+func (p ShoppingProc) ClearChecks() (err error) {
+	if err := p.engine.ClearShoppingChecks(); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] shopping list checks are cleared")
+
+	return nil
+}
+
+// buildShoppingItems sums recipe lines scaled to the serving portions in the ingredient unit,
+// the pantry stock is kept in it as well
+func buildShoppingItems(catalogue *pantry.Catalogue, servings []store.ServingV1, pantryStock []store.PantryV1, checks []store.ShoppingCheckV1) []store.ShoppingItem {
+	itemsByIngredient := make(map[uint]*store.ShoppingItem)
+
+	for _, serving := range servings {
+		if serving.CookedAt.Valid {
+			continue
+		}
+
+		for _, line := range catalogue.LineAmounts(pantry.ScaleServing(serving)) {
+			item, ok := itemsByIngredient[line.IngredientV1ID]
+			if !ok {
+				item = &store.ShoppingItem{Ingredient: line.Ingredient}
+				itemsByIngredient[line.IngredientV1ID] = item
+			}
+
+			item.Required += line.Amount
+		}
+	}
+
+	for _, stock := range pantryStock {
+		if item, ok := itemsByIngredient[stock.IngredientV1ID]; ok {
+			item.InPantry += stock.Amount
+		}
+	}
+
+	for _, check := range checks {
+		if item, ok := itemsByIngredient[check.IngredientV1ID]; ok {
+			item.Checked = true
+		}
+	}
+
+	items := []store.ShoppingItem{}
+	for _, item := range itemsByIngredient {
+		item.ToBuy = item.Required - item.InPantry
+		if item.ToBuy <= 0 {
+			continue
+		}
+		items = append(items, *item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return strings.ToLower(items[i].Ingredient.Name) < strings.ToLower(items[j].Ingredient.Name)
+	})
+
+	return items
+}
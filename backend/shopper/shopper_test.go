@@ -0,0 +1,149 @@
+package shopper
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// shoppingEngine keeps servings, the pantry and checks in memory, planned servings are the ones of the range
+type shoppingEngine struct {
+	Engine
+
+	servings []store.ServingV1
+	planned  []store.ServingV1
+	pantry   []store.PantryV1
+	checks   []store.ShoppingCheckV1
+}
+
+func (e *shoppingEngine) LoadServings() (*[]store.ServingV1, error) {
+	return &e.servings, nil
+}
+
+func (e *shoppingEngine) LoadPlannedServings(from time.Time, to time.Time) (*[]store.ServingV1, error) {
+	return &e.planned, nil
+}
+
+func (e *shoppingEngine) LoadPantry() (*[]store.PantryV1, error) {
+	return &e.pantry, nil
+}
+
+func (e *shoppingEngine) LoadShoppingChecks() (*[]store.ShoppingCheckV1, error) {
+	return &e.checks, nil
+}
+
+func (e *shoppingEngine) GetUnits() (*[]store.UnitV1, error) {
+	units := store.DefaultUnits()
+	return &units, nil
+}
+
+func unit(name string) *store.UnitV1 {
+	for _, unit := range store.DefaultUnits() {
+		if unit.Name == name {
+			return &unit
+		}
+	}
+	panic("unknown unit " + name)
+}
+
+func TestGetShoppingList(t *testing.T) {
+	flour := store.IngredientV1{ID: 1, Name: "Flour", Unit: *unit("g")}
+	egg := store.IngredientV1{ID: 2, Name: "egg", Unit: *unit("pcs")}
+	milk := store.IngredientV1{ID: 3, Name: "Milk", Unit: *unit("ml")}
+
+	line := func(ingredient store.IngredientV1, amount float64, unitName string) store.RecipeV1IngredientV1 {
+		line := store.RecipeV1IngredientV1{IngredientV1ID: ingredient.ID, Ingredient: ingredient, Amount: amount}
+		if unitName != "" {
+			line.Unit = unit(unitName)
+		}
+		return line
+	}
+
+	pancakes := store.RecipeV1{ID: 1, Title: "Pancakes", Portions: 2, Ingredients: []store.RecipeV1IngredientV1{
+		line(flour, 200, ""),
+		line(egg, 2, ""),
+		line(milk, 0.5, "l"),
+	}}
+	crepes := store.RecipeV1{ID: 2, Title: "Crepes", Portions: 2, Ingredients: []store.RecipeV1IngredientV1{
+		line(flour, 0.25, "kg"),
+		line(egg, 1, "dozen"),
+		line(milk, 300, ""),
+		// flour has no density, cups of it don't convert to grams and the line is left out
+		line(flour, 2, "cup"),
+	}}
+
+	servings := []store.ServingV1{
+		// twice the recipe portions
+		{ID: 1, RecipeID: 1, Recipe: pancakes, Portions: 4},
+		// no portions are the recipe portions
+		{ID: 2, RecipeID: 2, Recipe: crepes},
+		// cooked servings are left out
+		{ID: 3, RecipeID: 1, Recipe: pancakes, Portions: 10, CookedAt: sql.NullTime{Time: time.Now(), Valid: true}},
+	}
+
+	type item struct {
+		name     string
+		required float64
+		inPantry float64
+		toBuy    float64
+		checked  bool
+	}
+
+	tests := []struct {
+		name  string
+		from  sql.NullTime
+		to    sql.NullTime
+		items []item
+	}{
+		{
+			name: "all servings to cook",
+			items: []item{
+				// 4 + 12 pieces, the dozen is converted to pieces
+				{name: "egg", required: 16, toBuy: 16, checked: true},
+				// 400 g + 0.25 kg less the pantry stock
+				{name: "Flour", required: 650, inPantry: 300, toBuy: 350},
+				// 1 l + 300 ml are in the pantry, milk isn't on the list
+			},
+		},
+		{
+			name:  "servings of the range",
+			from:  sql.NullTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+			to:    sql.NullTime{Time: time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC), Valid: true},
+			items: []item{{name: "egg", required: 12, toBuy: 12, checked: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &shoppingEngine{
+				servings: servings,
+				planned:  servings[1:2],
+				pantry: []store.PantryV1{
+					{IngredientV1ID: 1, Amount: 300},
+					{IngredientV1ID: 3, Amount: 2000},
+				},
+				checks: []store.ShoppingCheckV1{{IngredientV1ID: 2}},
+			}
+
+			list, err := New(engine).GetShoppingList(tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(list.Items) != len(tt.items) {
+				t.Fatalf("expected %d items, got %+v", len(tt.items), list.Items)
+			}
+			for i, want := range tt.items {
+				got := list.Items[i]
+				if got.Ingredient.Name != want.name || math.Abs(got.Required-want.required) > 1e-9 ||
+					math.Abs(got.InPantry-want.inPantry) > 1e-9 || math.Abs(got.ToBuy-want.toBuy) > 1e-9 || got.Checked != want.checked {
+					t.Errorf("item %d: expected %+v, got %s required %v, in pantry %v, to buy %v, checked %t",
+						i, want, got.Ingredient.Name, got.Required, got.InPantry, got.ToBuy, got.Checked)
+				}
+			}
+		})
+	}
+}
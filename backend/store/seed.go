@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var pdfStore = "data/recipes/"
@@ -43,6 +44,25 @@ func Seed(db *gorm.DB) error {
 		groupedRecords[title] = append(groupedRecords[title], record)
 	}
 
+	// seed the unit catalogue before units from the csv file, so aliases resolve to catalogue units
+	err = seedUnitCatalogue(db)
+	if err != nil {
+		log.Fatalf("[ERROR] seeding unit catalogue data: %v\n", err)
+		return err
+	}
+
+	difficulties, err := seedRecipeDifficulties(db)
+	if err != nil {
+		log.Fatalf("[ERROR] seeding recipe difficulties data: %v\n", err)
+		return err
+	}
+
+	var existingAliases []UnitAliasV1
+	if result := db.Find(&existingAliases); result.Error != nil {
+		log.Fatalf("[ERROR] getting unit aliases data: %v\n", result.Error)
+		return result.Error
+	}
+
 	// get existing recipes
 	var existingRecipes []RecipeV1
 	if result := db.Find(&existingRecipes); result.Error != nil {
@@ -68,6 +88,21 @@ func Seed(db *gorm.DB) error {
 	ingridientsToSeed := []IngredientV1{}
 	recipesToSeed := []RecipeV1{}
 
+	// recipes seeded before difficulties existed get the difficulty of the csv file
+	for _, existingRecipe := range existingRecipes {
+		records, ok := groupedRecords[existingRecipe.Title]
+		if !ok || existingRecipe.RecipeDifficultyID != 0 {
+			continue
+		}
+
+		if difficultyID := recipeDifficultyID(difficulties, records); difficultyID != 0 {
+			if result := db.Model(&RecipeV1{}).Where("id = ?", existingRecipe.ID).Update("recipe_difficulty_id", difficultyID); result.Error != nil {
+				log.Fatalf("[ERROR] seeding recipe difficulty data: %v\n", result.Error)
+				return result.Error
+			}
+		}
+	}
+
 	// seed data from csv file if not exists
 	for title, records := range groupedRecords {
 		if containsRecipe(existingRecipes, title) {
@@ -75,7 +110,7 @@ func Seed(db *gorm.DB) error {
 		}
 
 		for _, record := range records {
-			unit := UnitV1{Name: record[2]}
+			unit := UnitV1{Name: canonicalUnitName(db, existingAliases, record[2])}
 			if !containsUnit(existingUnits, unit.Name) && !containsUnit(unitsToSeed, unit.Name) {
 				unitsToSeed = append(unitsToSeed, unit)
 			}
@@ -89,7 +124,13 @@ func Seed(db *gorm.DB) error {
 		recipePdfUrl := buildRecipePdfUrl(title)
 		recipeThumbnailUrl := buildRecipeThumbnailUrl(title)
 
-		recipesToSeed = append(recipesToSeed, RecipeV1{Title: title, Description: title, PdfUrl: recipePdfUrl, ThumbnailUrl: recipeThumbnailUrl})
+		recipesToSeed = append(recipesToSeed, RecipeV1{
+			Title:              title,
+			Description:        title,
+			PdfUrl:             recipePdfUrl,
+			ThumbnailUrl:       recipeThumbnailUrl,
+			RecipeDifficultyID: recipeDifficultyID(difficulties, records),
+		})
 	}
 
 	err = seedUnits(db, unitsToSeed)
@@ -184,9 +225,161 @@ func Seed(db *gorm.DB) error {
 		return err
 	}
 
+	err = seedMealSlots(db)
+	if err != nil {
+		log.Fatalf("[ERROR] seeding meal slots data: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// seedMealSlots adds default meal slots, only when none are configured yet
+func seedMealSlots(db *gorm.DB) error {
+	var count int64
+	if result := db.Model(&MealSlotV1{}).Count(&count); result.Error != nil {
+		return result.Error
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	mealSlots := []MealSlotV1{
+		{Name: "Breakfast", Position: 1, DefaultTime: sql.NullString{String: "08:00", Valid: true}},
+		{Name: "Lunch", Position: 2, DefaultTime: sql.NullString{String: "12:30", Valid: true}},
+		{Name: "Snack", Position: 3, DefaultTime: sql.NullString{String: "16:00", Valid: true}},
+		{Name: "Dinner", Position: 4, DefaultTime: sql.NullString{String: "19:00", Valid: true}},
+	}
+
+	for _, mealSlot := range mealSlots {
+		if result := db.Create(&mealSlot); result.Error != nil {
+			return result.Error
+		}
+	}
+
+	return nil
+}
+
+// DefaultDifficulties is the recipe difficulty scale from the easiest one
+func DefaultDifficulties() []RecipeDifficultyV1 {
+	return []RecipeDifficultyV1{
+		{Name: "Easy"},
+		{Name: "Medium"},
+		{Name: "Hard"},
+	}
+}
+
+// seedRecipeDifficulties adds missing difficulties of the scale and returns all of them
+func seedRecipeDifficulties(db *gorm.DB) ([]RecipeDifficultyV1, error) {
+	for _, difficulty := range DefaultDifficulties() {
+		if result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&difficulty); result.Error != nil {
+			return nil, result.Error
+		}
+	}
+
+	var difficulties []RecipeDifficultyV1
+	if result := db.Order("id").Find(&difficulties); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return difficulties, nil
+}
+
+// recipeDifficultyID finds the difficulty named in the optional fifth column of recipe records,
+// zero means the records name no known difficulty
+func recipeDifficultyID(difficulties []RecipeDifficultyV1, records [][]string) uint {
+	for _, record := range records {
+		if len(record) < 5 || strings.TrimSpace(record[4]) == "" {
+			continue
+		}
+
+		for _, difficulty := range difficulties {
+			if strings.EqualFold(difficulty.Name, strings.TrimSpace(record[4])) {
+				return difficulty.ID
+			}
+		}
+
+		log.Printf("[WARN] unknown difficulty %q of recipe %s", record[4], record[0])
+		return 0
+	}
+
+	return 0
+}
+
+// DefaultUnits is the unit catalogue, factors convert to gram, millilitre and piece
+func DefaultUnits() []UnitV1 {
+	return []UnitV1{
+		{Name: "g", Dimension: UnitDimensionMass, Factor: 1, Aliases: unitAliases("gram", "grams", "gr", "gramme", "grammes")},
+		{Name: "kg", Dimension: UnitDimensionMass, Factor: 1000, Aliases: unitAliases("kilogram", "kilograms", "kilo", "kilos", "kgs")},
+		{Name: "mg", Dimension: UnitDimensionMass, Factor: 0.001, Aliases: unitAliases("milligram", "milligrams")},
+		{Name: "oz", Dimension: UnitDimensionMass, Factor: 28.349523125, Aliases: unitAliases("ounce", "ounces")},
+		{Name: "lb", Dimension: UnitDimensionMass, Factor: 453.59237, Aliases: unitAliases("pound", "pounds", "lbs")},
+		{Name: "ml", Dimension: UnitDimensionVolume, Factor: 1, Aliases: unitAliases("millilitre", "millilitres", "milliliter", "milliliters")},
+		{Name: "cl", Dimension: UnitDimensionVolume, Factor: 10, Aliases: unitAliases("centilitre", "centilitres", "centiliter", "centiliters")},
+		{Name: "dl", Dimension: UnitDimensionVolume, Factor: 100, Aliases: unitAliases("decilitre", "decilitres", "deciliter", "deciliters")},
+		{Name: "l", Dimension: UnitDimensionVolume, Factor: 1000, Aliases: unitAliases("litre", "litres", "liter", "liters", "ltr")},
+		{Name: "tsp", Dimension: UnitDimensionVolume, Factor: 4.92892159375, Aliases: unitAliases("t", "teaspoon", "teaspoons", "tsps")},
+		{Name: "tbsp", Dimension: UnitDimensionVolume, Factor: 14.78676478125, Aliases: unitAliases("T", "tablespoon", "tablespoons", "tbs", "tbl", "tbsps")},
+		{Name: "cup", Dimension: UnitDimensionVolume, Factor: 236.5882365, Aliases: unitAliases("cups", "c")},
+		{Name: "fl oz", Dimension: UnitDimensionVolume, Factor: 29.5735295625, Aliases: unitAliases("fluid ounce", "fluid ounces", "floz", "fl. oz")},
+		{Name: "pcs", Dimension: UnitDimensionCount, Factor: 1, Aliases: unitAliases("pc", "piece", "pieces", "x", "whole")},
+		{Name: "dozen", Dimension: UnitDimensionCount, Factor: 12, Aliases: unitAliases("dz", "doz")},
+	}
+}
+
+func unitAliases(names ...string) []UnitAliasV1 {
+	aliases := []UnitAliasV1{}
+	for _, name := range names {
+		aliases = append(aliases, UnitAliasV1{Name: name})
+	}
+	return aliases
+}
+
+// seedUnitCatalogue adds missing catalogue units and aliases and sets dimensions of the existing ones
+func seedUnitCatalogue(db *gorm.DB) error {
+	for _, catalogueUnit := range DefaultUnits() {
+		var unit UnitV1
+		result := db.Where("name = ?", catalogueUnit.Name).Limit(1).Find(&unit)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			unit = UnitV1{Name: catalogueUnit.Name}
+		}
+		unit.Dimension = catalogueUnit.Dimension
+		unit.Factor = catalogueUnit.Factor
+
+		if result := db.Omit(clause.Associations).Save(&unit); result.Error != nil {
+			return result.Error
+		}
+
+		for _, alias := range catalogueUnit.Aliases {
+			alias.UnitV1ID = unit.ID
+			if result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&alias); result.Error != nil {
+				return result.Error
+			}
+		}
+	}
+
 	return nil
 }
 
+// canonicalUnitName resolves an alias to the unit name, e.g. "grams" to "g"
+func canonicalUnitName(db *gorm.DB, aliases []UnitAliasV1, name string) string {
+	for _, alias := range aliases {
+		if alias.Name == name {
+			var unit UnitV1
+			if result := db.Where("id = ?", alias.UnitV1ID).Limit(1).Find(&unit); result.Error == nil && result.RowsAffected > 0 {
+				return unit.Name
+			}
+		}
+	}
+
+	return name
+}
+
 func seedUnits(db *gorm.DB, units []UnitV1) error {
 	for _, unit := range units {
 		if result := db.Create(&unit); result.Error != nil {
@@ -1,10 +1,20 @@
 package store
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
+	"github.com/mattn/go-sqlite3"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -20,7 +30,8 @@ func NewDatabase() (*Database, error) {
 	result := Database{}
 
 	db, err := gorm.Open(sqlite.Open(databaseName), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger:         logger.Default.LogMode(logger.Info),
+		TranslateError: true,
 	})
 	if err != nil {
 		return nil, err
@@ -31,21 +42,54 @@ func NewDatabase() (*Database, error) {
 	return &result, nil
 }
 
+// translateError converts gorm errors to the store error kinds
+func translateError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return fmt.Errorf("%w: %v", ErrConflict, err)
+	}
+
+	return err
+}
+
 func (s *Database) Migrate() error {
 	log.Printf("[INFO] migrating database")
 
+	// the migration may recreate tables the search view and triggers refer to, they are made again after it
+	if err := s.dropSearchTriggers(); err != nil {
+		return err
+	}
+
 	if err := s.db.AutoMigrate(
 		&JobV1{},
+		&JobItemV1{},
 		&UnitV1{},
+		&UnitAliasV1{},
 		&IngredientV1{},
 		&PantryV1{},
+		&PantryDeductionV1{},
 		&RecipeV1{},
 		&RecipeDifficultyV1{},
+		&TagV1{},
+		&RecipeNutritionV1{},
+		&RecipeStepV1{},
+		&RecipeStepIngredientV1{},
 		&RecipeV1IngredientV1{},
-		&ServingV1{}); err != nil {
+		&MealSlotV1{},
+		&ServingV1{},
+		&ShoppingCheckV1{}); err != nil {
 		return err
 	}
 
+	// meal slots used to be free text on servings before they got their own table
+	if s.db.Migrator().HasColumn(&ServingV1{}, "meal_slot") {
+		if err := s.migrateServingMealSlots(); err != nil {
+			return err
+		}
+	}
+
 	if err := s.addFullTextSearch(); err != nil {
 		return err
 	}
@@ -58,82 +102,862 @@ func (s *Database) Migrate() error {
 	return nil
 }
 
+// migrateServingMealSlots moves the meal slot texts of servings to the meal slot table and drops the text column,
+// a text matches the meal slot of the same name in any case, meal slots are created of texts without one
+func (s *Database) migrateServingMealSlots() (err error) {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// the default slots are seeded first, the seed skips them once there are any meal slots
+		if err := seedMealSlots(tx); err != nil {
+			return err
+		}
+
+		var names []string
+		if err := tx.Raw("SELECT DISTINCT trim(meal_slot) FROM serving_v1 WHERE trim(meal_slot) <> '' ORDER BY 1").
+			Scan(&names).Error; err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			var mealSlot MealSlotV1
+			result := tx.Where("lower(name) = lower(?)", name).Limit(1).Find(&mealSlot)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				var position uint
+				if err := tx.Model(&MealSlotV1{}).Select("COALESCE(MAX(position), 0)").Scan(&position).Error; err != nil {
+					return err
+				}
+				mealSlot = MealSlotV1{Name: name, Position: position + 1}
+				if err := tx.Create(&mealSlot).Error; err != nil {
+					return err
+				}
+			}
+
+			if err := tx.Exec("UPDATE serving_v1 SET meal_slot_id = ? WHERE trim(meal_slot) = ? AND meal_slot_id IS NULL",
+				mealSlot.ID, name).Error; err != nil {
+				return err
+			}
+		}
+
+		log.Printf("[INFO] moved %d meal slots of servings to meal slots", len(names))
+		return tx.Migrator().DropColumn(&ServingV1{}, "meal_slot")
+	})
+}
+
+const (
+	// recipeSearchSchema is the full text search (fts) table of recipes, a table of an older schema is rebuilt by the migration,
+	// its content is external, the index keeps no copy of the recipe texts and reads them of the recipe_v1_search view by rowid,
+	// prefixes of two and three letters are indexed to search words as they are typed
+	recipeSearchSchema = `CREATE VIRTUAL TABLE recipe_v1_fts USING fts5(title, description, ingredients, tags, instructions, ` +
+		`content='recipe_v1_search', content_rowid='id', prefix='2 3')`
+
+	// recipeSearchColumns are the columns of the recipe_v1_search view indexed by recipe_v1_fts
+	recipeSearchColumns = "title, description, ingredients, tags, instructions"
+
+	// recipeSearchRank orders recipes by the bm25 rank of the search, a word found in the title weighs the most
+	recipeSearchRank = "bm25(recipe_v1_fts, 10.0, 2.0, 4.0, 5.0, 1.0)"
+)
+
+// recipeSearchTriggers keep the search index up to date with the recipe texts, a trigger pair is made of each of them,
+// the before trigger removes recipes of the ids of the index with their current text and the after trigger indexes their new text,
+// ids is an expression or a query of ids of recipes the changed row belongs to
+var recipeSearchTriggers = []struct {
+	name  string
+	event string
+	table string
+	ids   string
+}{
+	{name: "recipe_v1_i", event: "INSERT", table: "recipe_v1", ids: "new.id"},
+	{name: "recipe_v1_d", event: "DELETE", table: "recipe_v1", ids: "old.id"},
+	{name: "recipe_v1_u", event: "UPDATE OF title, description", table: "recipe_v1", ids: "old.id"},
+	{name: "recipe_v1_ingredient_v1_i", event: "INSERT", table: "recipe_v1_ingredient_v1", ids: "new.recipe_v1_id"},
+	{name: "recipe_v1_ingredient_v1_d", event: "DELETE", table: "recipe_v1_ingredient_v1", ids: "old.recipe_v1_id"},
+	{name: "recipe_v1_ingredient_v1_u", event: "UPDATE OF recipe_v1_id, ingredient_v1_id", table: "recipe_v1_ingredient_v1",
+		ids: "old.recipe_v1_id, new.recipe_v1_id"},
+	{name: "recipe_v1_tags_i", event: "INSERT", table: "recipe_v1_tags", ids: "new.recipe_v1_id"},
+	{name: "recipe_v1_tags_d", event: "DELETE", table: "recipe_v1_tags", ids: "old.recipe_v1_id"},
+	{name: "recipe_step_v1_i", event: "INSERT", table: "recipe_step_v1", ids: "new.recipe_v1_id"},
+	{name: "recipe_step_v1_d", event: "DELETE", table: "recipe_step_v1", ids: "old.recipe_v1_id"},
+	{name: "recipe_step_v1_u", event: "UPDATE OF recipe_v1_id, text", table: "recipe_step_v1",
+		ids: "old.recipe_v1_id, new.recipe_v1_id"},
+	{name: "ingredient_v1_u", event: "UPDATE OF name", table: "ingredient_v1",
+		ids: "SELECT recipe_v1_id FROM recipe_v1_ingredient_v1 WHERE ingredient_v1_id = new.id"},
+}
+
+// dropSearchTriggers drops the search view and triggers updating the search index, triggers of older versions of the index too
+func (s *Database) dropSearchTriggers() (err error) {
+	var triggers []string
+	if err := s.db.Raw("SELECT name FROM sqlite_master WHERE type = 'trigger' AND sql LIKE '%recipe_v1_fts%'").Scan(&triggers).Error; err != nil {
+		return err
+	}
+	for _, trigger := range triggers {
+		if err := s.db.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %q", trigger)).Error; err != nil {
+			return err
+		}
+	}
+
+	return s.db.Exec("DROP VIEW IF EXISTS recipe_v1_search").Error
+}
+
 func (s *Database) addFullTextSearch() (err error) {
-	// enable full text search (fts) for recipes (table name is 'recipe_v1' by convention)
-	// create fts table and triggers to sync the data between fts table and main table
-	s.db.Exec(`
-		CREATE VIRTUAL TABLE IF NOT EXISTS recipe_v1_fts USING fts5(title);
-
-		CREATE TRIGGER IF NOT EXISTS recipe_v1_ai AFTER INSERT ON recipe_v1
-		BEGIN
-			INSERT INTO recipe_v1_fts (rowid, title)
-			VALUES (new.id, new.title);
-		END;
-
-		CREATE TRIGGER IF NOT EXISTS recipe_v1_ad AFTER DELETE ON recipe_v1
-		BEGIN
-			DELETE FROM recipe_v1_fts WHERE title = old.title;
-		END;
-
-		CREATE TRIGGER IF NOT EXISTS recipe_v1_au AFTER UPDATE ON recipe_v1
-		BEGIN
-			DELETE FROM recipe_v1_fts WHERE title = old.title;
-			INSERT INTO recipe_v1_fts (rowid, title)
-			VALUES (new.id, new.title);
-		END;
-	`)
+	// the text of a recipe indexed by the fts table, ingredient names, tags and steps are of their own tables
+	if err := s.db.Exec(`
+		CREATE VIEW recipe_v1_search AS
+		SELECT recipe_v1.id, recipe_v1.title, recipe_v1.description,
+			(SELECT group_concat(ingredient_v1.name, ' ') FROM recipe_v1_ingredient_v1
+				JOIN ingredient_v1 ON ingredient_v1.id = recipe_v1_ingredient_v1.ingredient_v1_id
+				WHERE recipe_v1_ingredient_v1.recipe_v1_id = recipe_v1.id) AS ingredients,
+			(SELECT group_concat(tag_v1.name, ' ') FROM recipe_v1_tags
+				JOIN tag_v1 ON tag_v1.id = recipe_v1_tags.tag_v1_id
+				WHERE recipe_v1_tags.recipe_v1_id = recipe_v1.id) AS tags,
+			(SELECT group_concat(recipe_step_v1.text, ' ') FROM recipe_step_v1
+				WHERE recipe_step_v1.recipe_v1_id = recipe_v1.id) AS instructions
+		FROM recipe_v1;
+	`).Error; err != nil {
+		return err
+	}
+
+	var schema string
+	if err := s.db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'recipe_v1_fts'").Scan(&schema).Error; err != nil {
+		return err
+	}
+
+	// a new index is filled before the triggers are made, the before triggers remove recipes of the index
+	// by their text and removing a recipe which was never indexed corrupts it
+	if schema != recipeSearchSchema {
+		log.Printf("[INFO] create recipes search index")
+		if err := s.db.Exec("DROP TABLE IF EXISTS recipe_v1_fts").Error; err != nil {
+			return err
+		}
+		if err := s.db.Exec(recipeSearchSchema).Error; err != nil {
+			return err
+		}
+		if err := s.RebuildSearchIndex(); err != nil {
+			return err
+		}
+	}
+
+	for _, trigger := range recipeSearchTriggers {
+		if err := s.db.Exec(fmt.Sprintf(`
+			CREATE TRIGGER %[1]s_before BEFORE %[2]s ON %[3]s
+			BEGIN
+				INSERT INTO recipe_v1_fts (recipe_v1_fts, rowid, %[5]s)
+				SELECT 'delete', id, %[5]s FROM recipe_v1_search WHERE id IN (%[4]s);
+			END;
+
+			CREATE TRIGGER %[1]s_after AFTER %[2]s ON %[3]s
+			BEGIN
+				INSERT INTO recipe_v1_fts (rowid, %[5]s)
+				SELECT id, %[5]s FROM recipe_v1_search WHERE id IN (%[4]s);
+			END;
+		`, trigger.name, trigger.event, trigger.table, trigger.ids, recipeSearchColumns)).Error; err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func (s *Database) SaveRecipe(recipe *RecipeV1) (savedRecipe *RecipeV1, err error) {
-	s.db.Save(recipe)
+// RebuildSearchIndex indexes all recipes again, it fixes an index out of sync with the recipe texts
+func (s *Database) RebuildSearchIndex() (err error) {
+	if err := s.db.Exec("INSERT INTO recipe_v1_fts (recipe_v1_fts) VALUES ('rebuild')").Error; err != nil {
+		return err
+	}
+
+	if err := s.db.Exec("INSERT INTO recipe_v1_fts (recipe_v1_fts) VALUES ('optimize')").Error; err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] recipes search index rebuilt")
+	return nil
+}
+
+// CheckSearchIndex compares the search index with the recipes, recipes missing of the index aren't found by the search
+func (s *Database) CheckSearchIndex() (status *SearchIndexStatus, err error) {
+	status = &SearchIndexStatus{Missing: []uint{}, Stale: []uint{}}
+
+	if err := s.db.Model(&RecipeV1{}).Count(&status.Recipes).Error; err != nil {
+		return nil, err
+	}
+
+	// the docsize table of the index has a row per indexed recipe
+	if err := s.db.Table("recipe_v1_fts_docsize").Count(&status.Indexed).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Raw("SELECT id FROM recipe_v1 WHERE id NOT IN (SELECT id FROM recipe_v1_fts_docsize) ORDER BY id").
+		Scan(&status.Missing).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Raw("SELECT id FROM recipe_v1_fts_docsize WHERE id NOT IN (SELECT id FROM recipe_v1) ORDER BY id").
+		Scan(&status.Stale).Error; err != nil {
+		return nil, err
+	}
+
+	// the integrity check compares the index with the recipe texts, a mismatch is reported as a corrupt table
+	err = s.db.Exec("INSERT INTO recipe_v1_fts (recipe_v1_fts, rank) VALUES ('integrity-check', 1)").Error
+	var sqliteErr sqlite3.Error
+	switch {
+	case errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrCorrupt:
+		status.Error = err.Error()
+	case err != nil:
+		return nil, err
+	}
+
+	status.Consistent = status.Error == "" && len(status.Missing) == 0 && len(status.Stale) == 0
+	return status, nil
+}
+
+// SaveSyncedRecipe updates the recipe columns read from its pdf, other columns like the rating or the difficulty
+// may change while the pdf is read, so they are kept as they are
+func (s *Database) SaveSyncedRecipe(recipe *RecipeV1) (savedRecipe *RecipeV1, err error) {
+	result := s.db.Model(recipe).
+		Select("title", "sub_title", "description", "preparation_time_in_minutes", "cooking_time_in_minutes",
+			"pdf_hash", "pdf_modified_at", "sync_failures", "sync_error", "updated_at").
+		Updates(recipe)
+	if result.Error != nil {
+		return nil, translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+
 	return recipe, nil
 }
 
+// SaveRecipeNutrition creates or replaces the nutrition of a recipe
+func (s *Database) SaveRecipeNutrition(nutrition *RecipeNutritionV1) (err error) {
+	err = s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "recipe_v1_id"}},
+		UpdateAll: true,
+	}).Create(nutrition).Error
+
+	return translateError(err)
+}
+
+// DeleteRecipeNutrition deletes the nutrition of a recipe, a recipe without nutrition is left as it is
+func (s *Database) DeleteRecipeNutrition(recipeID uint) (err error) {
+	err = s.db.Where("recipe_v1_id = ?", recipeID).Delete(&RecipeNutritionV1{}).Error
+
+	return translateError(err)
+}
+
+// LoadSyncRecipes loads all recipes without their associations for the sync
+func (s *Database) LoadSyncRecipes() (result *[]RecipeV1, err error) {
+	var recipes []RecipeV1
+	if err := s.db.Order("id").Find(&recipes).Error; err != nil {
+		return nil, err
+	}
+
+	return &recipes, nil
+}
+
+// RecordRecipeSyncFailure counts a failed sync of the recipe and keeps its error
+func (s *Database) RecordRecipeSyncFailure(id uint, syncError string) (err error) {
+	result := s.db.Model(&RecipeV1{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"sync_failures": gorm.Expr("sync_failures + 1"),
+		"sync_error":    syncError,
+	})
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ResetRecipeSyncFailures clears failed syncs of the recipe, so the next sync reads it again
+func (s *Database) ResetRecipeSyncFailures(id uint) (err error) {
+	result := s.db.Model(&RecipeV1{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"sync_failures": 0,
+		"sync_error":    "",
+	})
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
 func (s *Database) SaveSyncJob(job *JobV1) (savedJob *JobV1, err error) {
-	s.db.Save(job)
+	if err := s.db.Omit(clause.Associations).Save(job).Error; err != nil {
+		return nil, err
+	}
+
 	return job, nil
 }
 
-func (s *Database) LoadRecipes(page int, pageSize int, searchTerm string) (result *Recipes, err error) {
+func (s *Database) SaveJobItem(item *JobItemV1) (err error) {
+	return s.db.Create(item).Error
+}
+
+// LoadJobs loads jobs without their items, the latest first
+func (s *Database) LoadJobs() (result *[]JobV1, err error) {
+	var jobs []JobV1
+	if err := s.db.Order("id DESC").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+
+	return &jobs, nil
+}
+
+func (s *Database) GetJob(id uint) (result *JobV1, err error) {
+	var job JobV1
+	if err := s.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("id = ?", id).First(&job).Error; err != nil {
+		return nil, translateError(err)
+	}
+
+	return &job, nil
+}
+
+const (
+	// recipeTotalTime is the preparation and cooking time of a recipe, zero when unknown
+	recipeTotalTime = "(COALESCE(recipe_v1.preparation_time_in_minutes, 0) + COALESCE(recipe_v1.cooking_time_in_minutes, 0))"
+	// recipeLastCooked is the time the recipe was cooked last, null when never cooked
+	recipeLastCooked = "(SELECT MAX(serving_v1.cooked_at) FROM serving_v1 WHERE serving_v1.recipe_id = recipe_v1.id)"
+	// searchSnippetWords is the max number of words of a search snippet
+	searchSnippetWords = 16
+
+	// maxIngredientFacets limits the ingredients facet to the most used ingredients
+	maxIngredientFacets = 20
+	// ratingFacets counts recipes rated at least 1 to 5 stars
+	ratingFacets = 5
+)
+
+// LoadRecipes loads a page of recipes narrowed and ordered by the filter, the total count and the facets are of all pages,
+// the facets are loaded only when the filter asks for them
+func (s *Database) LoadRecipes(page int, pageSize int, filter RecipeFilter) (result *Recipes, err error) {
 	var recipes []RecipeV1
 	offset := (page - 1) * pageSize
+	now := time.Now().UTC()
 
-	// Use a join between RecipeV1 and recipe_v1_fts using the id column
-	// Perform a full-text search on the title column of recipe_v1_fts if searchTerm is provided
-	query := s.db.Table("recipe_v1_fts").
+	query := filterRecipes(s.db.Table("recipe_v1").
 		Select("recipe_v1.*").
-		Joins("JOIN recipe_v1 ON recipe_v1_fts.rowid = recipe_v1.id").
+		Preload("RecipeDifficulty").
+		Preload("Tags").
+		Preload("Nutrition").
 		Preload("Ingredients.Ingredient").
-		Preload("Ingredients.Ingredient.Unit")
+		Preload("Ingredients.Ingredient.Unit").
+		Preload("Ingredients.Unit"), filter, now)
 
-	// Conditionally add the WHERE clause only if searchTerm is provided
-	if searchTerm != "" {
-		query = query.Where("recipe_v1_fts.title MATCH ? ORDER BY recipe_v1_fts.rank", searchTerm)
+	switch {
+	case filter.Sort == RecipeSortRating:
+		query = query.Order("recipe_v1.rating DESC").Order("recipe_v1.rating_count DESC")
+	case filter.Sort == RecipeSortTime:
+		query = query.Order(recipeTotalTime + " = 0").Order(recipeTotalTime)
+	case filter.Sort == RecipeSortLastCooked:
+		query = query.Order(recipeLastCooked + " IS NULL").Order(recipeLastCooked + " DESC")
+	case filter.Sort == RecipeSortCreated:
+		query = query.Order("recipe_v1.created_at DESC")
+	case searchMatch(filter.SearchTerm) != "":
+		query = query.Order(recipeSearchRank)
 	}
 
-	query.Offset(offset).Limit(pageSize).Find(&recipes)
+	if err := query.Order("recipe_v1.id").Offset(offset).Limit(pageSize).Find(&recipes).Error; err != nil {
+		return nil, err
+	}
 
-	result = &Recipes{Recipes: recipes, Page: page, PageSize: pageSize, SearchTerm: searchTerm}
+	snippets, err := s.loadSearchSnippets(recipes, filter.SearchTerm)
+	if err != nil {
+		return nil, err
+	}
+
+	// ids of all recipes of the filter, a new query is made for each use
+	ids := func() *gorm.DB {
+		return filterRecipes(s.db.Table("recipe_v1").Select("recipe_v1.id"), filter, now)
+	}
+
+	var total int64
+	if err := ids().Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	result = &Recipes{
+		Recipes:  recipes,
+		Page:     page,
+		PageSize: pageSize,
+		Filter:   filter,
+		Total:    total,
+		Snippets: snippets,
+	}
+
+	if filter.WithFacets {
+		facets, err := loadRecipeFacets(s.db, ids)
+		if err != nil {
+			return nil, err
+		}
+		result.Facets = *facets
+	}
 
 	return result, nil
 }
 
+// filterRecipes narrows a query of recipe_v1 by the filter
+func filterRecipes(query *gorm.DB, filter RecipeFilter, now time.Time) *gorm.DB {
+	// Use a join between RecipeV1 and recipe_v1_fts using the id column only if searchTerm is provided,
+	// recipes missing of the index are still listed when there is no search
+	if match := searchMatch(filter.SearchTerm); match != "" {
+		query = query.Joins("JOIN recipe_v1_fts ON recipe_v1_fts.rowid = recipe_v1.id").
+			Where("recipe_v1_fts MATCH ?", match)
+	}
+
+	const hasIngredient = `EXISTS (SELECT 1 FROM recipe_v1_ingredient_v1
+		JOIN ingredient_v1 ON ingredient_v1.id = recipe_v1_ingredient_v1.ingredient_v1_id
+		WHERE recipe_v1_ingredient_v1.recipe_v1_id = recipe_v1.id AND lower(ingredient_v1.name) = lower(?))`
+	for _, ingredient := range filter.Ingredients {
+		query = query.Where(hasIngredient, strings.TrimSpace(ingredient))
+	}
+	for _, ingredient := range filter.ExcludedIngredients {
+		query = query.Where("NOT "+hasIngredient, strings.TrimSpace(ingredient))
+	}
+
+	if filter.MaxTotalTimeInMinutes > 0 {
+		query = query.Where(recipeTotalTime+" BETWEEN 1 AND ?", filter.MaxTotalTimeInMinutes)
+	}
+
+	if filter.DifficultyID != 0 {
+		query = query.Where("recipe_v1.recipe_difficulty_id = ?", filter.DifficultyID)
+	}
+
+	if filter.MinRating > 0 {
+		query = query.Where("recipe_v1.rating_count > 0 AND recipe_v1.rating >= ?", filter.MinRating)
+	}
+
+	for _, tag := range filter.Tags {
+		query = query.Where(`EXISTS (SELECT 1 FROM recipe_v1_tags JOIN tag_v1 ON tag_v1.id = recipe_v1_tags.tag_v1_id
+			WHERE recipe_v1_tags.recipe_v1_id = recipe_v1.id AND tag_v1.name = ?)`, strings.ToLower(tag))
+	}
+
+	if filter.CookedWithinDays > 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM serving_v1 WHERE serving_v1.recipe_id = recipe_v1.id AND serving_v1.cooked_at >= ?)",
+			now.AddDate(0, 0, -int(filter.CookedWithinDays)))
+	}
+
+	return query
+}
+
+// searchMatch makes the fts query of a search term, recipes match when they have all words of the term,
+// the words are quoted to search them as they are and the last one is a prefix to find words being typed
+func searchMatch(term string) string {
+	words := strings.FieldsFunc(term, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, word := range words {
+		words[i] = `"` + word + `"`
+	}
+	if len(words) > 0 {
+		words[len(words)-1] += "*"
+	}
+
+	return strings.Join(words, " ")
+}
+
+// loadSearchSnippets loads fragments of the recipes texts matching the search term by recipe id,
+// the matching words are marked by <mark> tags
+func (s *Database) loadSearchSnippets(recipes []RecipeV1, term string) (map[uint]string, error) {
+	snippets := map[uint]string{}
+
+	match := searchMatch(term)
+	if match == "" || len(recipes) == 0 {
+		return snippets, nil
+	}
+
+	ids := make([]uint, 0, len(recipes))
+	for _, recipe := range recipes {
+		ids = append(ids, recipe.ID)
+	}
+
+	var rows []struct {
+		ID      uint
+		Snippet string
+	}
+	if err := s.db.Table("recipe_v1_fts").
+		Select("rowid AS id, snippet(recipe_v1_fts, -1, '<mark>', '</mark>', '…', ?) AS snippet", searchSnippetWords).
+		Where("recipe_v1_fts MATCH ? AND rowid IN ?", match, ids).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		snippets[row.ID] = row.Snippet
+	}
+	return snippets, nil
+}
+
+// loadRecipeFacets counts recipes of the ids query by difficulty, tag, ingredient and rating
+func loadRecipeFacets(db *gorm.DB, ids func() *gorm.DB) (*RecipeFacets, error) {
+	facets := RecipeFacets{}
+
+	if err := db.Table("recipe_difficulty_v1").
+		Select("recipe_difficulty_v1.id, recipe_difficulty_v1.name, COUNT(recipe_v1.id) AS count").
+		Joins("JOIN recipe_v1 ON recipe_v1.recipe_difficulty_id = recipe_difficulty_v1.id").
+		Where("recipe_v1.id IN (?)", ids()).
+		Group("recipe_difficulty_v1.id").
+		Order("recipe_difficulty_v1.id").
+		Scan(&facets.Difficulties).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Table("tag_v1").
+		Select("tag_v1.id, tag_v1.name, COUNT(recipe_v1_tags.recipe_v1_id) AS count").
+		Joins("JOIN recipe_v1_tags ON recipe_v1_tags.tag_v1_id = tag_v1.id").
+		Where("recipe_v1_tags.recipe_v1_id IN (?)", ids()).
+		Group("tag_v1.id").
+		Order("count DESC").Order("tag_v1.name").
+		Scan(&facets.Tags).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Table("ingredient_v1").
+		Select("ingredient_v1.id, ingredient_v1.name, COUNT(DISTINCT recipe_v1_ingredient_v1.recipe_v1_id) AS count").
+		Joins("JOIN recipe_v1_ingredient_v1 ON recipe_v1_ingredient_v1.ingredient_v1_id = ingredient_v1.id").
+		Where("recipe_v1_ingredient_v1.recipe_v1_id IN (?)", ids()).
+		Group("ingredient_v1.id").
+		Order("count DESC").Order("ingredient_v1.name").
+		Limit(maxIngredientFacets).
+		Scan(&facets.Ingredients).Error; err != nil {
+		return nil, err
+	}
+
+	// the recipes rated at least 1 to 5 stars are counted by a single query
+	counts := make([]int64, ratingFacets)
+	columns := make([]string, ratingFacets)
+	dest := make([]interface{}, ratingFacets)
+	for i := range counts {
+		columns[i] = fmt.Sprintf("COUNT(CASE WHEN rating >= %d THEN 1 END)", i+1)
+		dest[i] = &counts[i]
+	}
+	if err := db.Model(&RecipeV1{}).
+		Select(strings.Join(columns, ", ")).
+		Where("id IN (?)", ids()).
+		Where("rating_count > 0").
+		Row().Scan(dest...); err != nil {
+		return nil, err
+	}
+	for i, count := range counts {
+		facets.Ratings = append(facets.Ratings, FacetCount{Name: strconv.Itoa(i + 1), Count: count})
+	}
+
+	return &facets, nil
+}
+
 func (s *Database) GetRecipe(id uint) (result *RecipeV1, err error) {
 	var recipe RecipeV1
-	s.db.Where("id = ?", id).First(&recipe)
+	if err := s.db.Preload("RecipeDifficulty").
+		Preload("Tags").
+		Preload("Nutrition").
+		Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Preload("Steps.Ingredients.Ingredient").
+		Preload("Ingredients.Ingredient.Unit").
+		Preload("Ingredients.Unit").
+		Where("id = ?", id).First(&recipe).Error; err != nil {
+		return nil, translateError(err)
+	}
 
 	return &recipe, nil
 }
 
+// CreateRecipe creates a recipe with its ingredient lines and tags, new ingredients of the lines and new tags are created as well
+func (s *Database) CreateRecipe(recipe *RecipeV1) (err error) {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(recipe).Error; err != nil {
+			return err
+		}
+
+		if err := saveRecipeTags(tx, recipe); err != nil {
+			return err
+		}
+
+		return saveRecipeIngredients(tx, recipe)
+	})
+
+	return translateError(err)
+}
+
+// UpdateRecipe updates the edited recipe fields and replaces its ingredient lines and tags,
+// rating, files, pdf hash and sync failures written meanwhile are kept
+func (s *Database) UpdateRecipe(recipe *RecipeV1) (err error) {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&RecipeV1{ID: recipe.ID}).
+			Select("Title", "Description", "PreparationTimeInMinutes", "CookingTimeInMinutes", "Portions", "RecipeDifficultyID", "UpdatedAt").
+			Updates(recipe)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		if err := saveRecipeTags(tx, recipe); err != nil {
+			return err
+		}
+
+		if err := tx.Where("recipe_v1_id = ?", recipe.ID).Delete(&RecipeV1IngredientV1{}).Error; err != nil {
+			return err
+		}
+
+		return saveRecipeIngredients(tx, recipe)
+	})
+
+	return translateError(err)
+}
+
+// ReplaceRecipeIngredients replaces ingredient lines of a recipe, new ingredients and units of the lines are created
+func (s *Database) ReplaceRecipeIngredients(recipeID uint, lines []RecipeV1IngredientV1) (err error) {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&RecipeV1{}).Where("id = ?", recipeID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+
+		if err := tx.Where("recipe_v1_id = ?", recipeID).Delete(&RecipeV1IngredientV1{}).Error; err != nil {
+			return err
+		}
+
+		return saveRecipeIngredients(tx, &RecipeV1{ID: recipeID, Ingredients: lines})
+	})
+
+	return translateError(err)
+}
+
+// DeleteRecipe deletes a recipe with its ingredient lines, steps and tags, recipes with servings can't be deleted
+func (s *Database) DeleteRecipe(id uint) (err error) {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var servings int64
+		if err := tx.Model(&ServingV1{}).Where("recipe_id = ?", id).Count(&servings).Error; err != nil {
+			return err
+		}
+		if servings > 0 {
+			return fmt.Errorf("recipe %d has %d servings: %w", id, servings, ErrConflict)
+		}
+
+		if err := tx.Where("recipe_v1_id = ?", id).Delete(&RecipeV1IngredientV1{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("recipe_v1_id = ?", id).Delete(&RecipeNutritionV1{}).Error; err != nil {
+			return err
+		}
+
+		if err := deleteRecipeSteps(tx, id); err != nil {
+			return err
+		}
+
+		if err := tx.Exec("DELETE FROM recipe_v1_tags WHERE recipe_v1_id = ?", id).Error; err != nil {
+			return err
+		}
+
+		result := tx.Delete(&RecipeV1{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return nil
+	})
+
+	return translateError(err)
+}
+
+// UpdateRecipeFiles updates the thumbnail and pdf of a recipe
+func (s *Database) UpdateRecipeFiles(recipe *RecipeV1) (err error) {
+	result := s.db.Model(&RecipeV1{ID: recipe.ID}).Select("ThumbnailUrl", "PdfUrl", "UpdatedAt").Updates(recipe)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Database) LoadRecipeDifficulties() (result *[]RecipeDifficultyV1, err error) {
+	var difficulties []RecipeDifficultyV1
+	if err := s.db.Order("id").Find(&difficulties).Error; err != nil {
+		return nil, err
+	}
+
+	return &difficulties, nil
+}
+
+func (s *Database) GetRecipeDifficulty(id uint) (result *RecipeDifficultyV1, err error) {
+	var difficulty RecipeDifficultyV1
+	if err := s.db.Where("id = ?", id).First(&difficulty).Error; err != nil {
+		return nil, translateError(err)
+	}
+
+	return &difficulty, nil
+}
+
+// saveRecipeIngredients creates ingredient lines of the recipe, lines with a new ingredient create it first
+func saveRecipeIngredients(tx *gorm.DB, recipe *RecipeV1) error {
+	// a new ingredient may be used by several lines, it's created once
+	created := make(map[string]uint)
+
+	for i := range recipe.Ingredients {
+		line := &recipe.Ingredients[i]
+
+		if line.IngredientV1ID == 0 {
+			if id, ok := created[line.Ingredient.Name]; ok {
+				line.Ingredient.ID = id
+			} else {
+				if err := saveIngredientUnit(tx, &line.Ingredient); err != nil {
+					return err
+				}
+				if err := tx.Omit(clause.Associations).Create(&line.Ingredient).Error; err != nil {
+					return err
+				}
+			}
+			created[line.Ingredient.Name] = line.Ingredient.ID
+			line.IngredientV1ID = line.Ingredient.ID
+		}
+
+		line.ID = 0
+		line.RecipeV1ID = recipe.ID
+		if err := tx.Omit(clause.Associations).Create(line).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveRecipeTags replaces tags of the recipe, tags are found by name and created when missing
+func saveRecipeTags(tx *gorm.DB, recipe *RecipeV1) error {
+	if err := tx.Exec("DELETE FROM recipe_v1_tags WHERE recipe_v1_id = ?", recipe.ID).Error; err != nil {
+		return err
+	}
+
+	for i := range recipe.Tags {
+		tag := &recipe.Tags[i]
+
+		result := tx.Where("name = ?", tag.Name).Limit(1).Find(tag)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			if err := tx.Create(tag).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Exec("INSERT INTO recipe_v1_tags (recipe_v1_id, tag_v1_id) VALUES (?, ?) ON CONFLICT DO NOTHING", recipe.ID, tag.ID).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReplaceRecipeSteps replaces instruction steps of a recipe, steps are numbered in the order they are given
+func (s *Database) ReplaceRecipeSteps(recipeID uint, steps []RecipeStepV1) (err error) {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&RecipeV1{}).Where("id = ?", recipeID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+
+		if err := deleteRecipeSteps(tx, recipeID); err != nil {
+			return err
+		}
+
+		for i := range steps {
+			step := &steps[i]
+			step.ID = 0
+			step.RecipeV1ID = recipeID
+			step.Position = uint(i + 1)
+			if err := tx.Omit(clause.Associations).Create(step).Error; err != nil {
+				return err
+			}
+
+			for j := range step.Ingredients {
+				link := &step.Ingredients[j]
+				link.RecipeStepV1ID = step.ID
+				if err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(link).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return translateError(err)
+}
+
+func deleteRecipeSteps(tx *gorm.DB, recipeID uint) error {
+	steps := tx.Model(&RecipeStepV1{}).Select("id").Where("recipe_v1_id = ?", recipeID)
+	if err := tx.Where("recipe_step_v1_id IN (?)", steps).Delete(&RecipeStepIngredientV1{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Where("recipe_v1_id = ?", recipeID).Delete(&RecipeStepV1{}).Error
+}
+
+// saveIngredientUnit finds the unit of a new ingredient by name when it has no id, a missing unit is created
+func saveIngredientUnit(tx *gorm.DB, ingredient *IngredientV1) error {
+	if ingredient.UnitID != 0 {
+		return nil
+	}
+	if ingredient.Unit.ID != 0 {
+		ingredient.UnitID = ingredient.Unit.ID
+		return nil
+	}
+	if ingredient.Unit.Name == "" {
+		return fmt.Errorf("unit of ingredient %s is required: %w", ingredient.Name, ErrInvalid)
+	}
+
+	result := tx.Where("name = ?", ingredient.Unit.Name).Limit(1).Find(&ingredient.Unit)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := tx.Omit(clause.Associations).Create(&ingredient.Unit).Error; err != nil {
+			return err
+		}
+	}
+
+	ingredient.UnitID = ingredient.Unit.ID
+	return nil
+}
+
 func (s *Database) LoadServings() (result *[]ServingV1, err error) {
 	var servings []ServingV1
-	s.db.Where("cooked_at IS NULL").Preload("Recipe").Preload("Recipe.RecipeDifficulty").Preload("Recipe.Ingredients").Preload("Recipe.Ingredients.Ingredient").Preload("Recipe.Ingredients.Ingredient.Unit").Find(&servings)
+	if err := s.db.Where("cooked_at IS NULL").Scopes(preloadServingRecipe).Find(&servings).Error; err != nil {
+		return nil, err
+	}
 
 	return &servings, nil
 }
 
+// preloadServingRecipe loads the serving recipe with its ingredient lines
+func preloadServingRecipe(db *gorm.DB) *gorm.DB {
+	return db.Preload("Recipe").
+		Preload("Recipe.RecipeDifficulty").
+		Preload("Recipe.Nutrition").
+		Preload("Recipe.Ingredients.Ingredient.Unit").
+		Preload("Recipe.Ingredients.Unit")
+}
+
 func (s *Database) GetIngredients() (result *Ingredients, err error) {
 	var ingredients []IngredientV1
 	s.db.Preload("Unit").Find(&ingredients)
@@ -145,24 +969,374 @@ func (s *Database) GetIngredients() (result *Ingredients, err error) {
 
 func (s *Database) GetUnits() (result *[]UnitV1, err error) {
 	var units []UnitV1
-	s.db.Find(&units)
+	if err := s.db.Preload("Aliases").Find(&units).Error; err != nil {
+		return nil, err
+	}
 
 	return &units, nil
 }
 
+func (s *Database) GetIngredient(id uint) (result *IngredientV1, err error) {
+	var ingredient IngredientV1
+	if err := s.db.Preload("Unit").Where("id = ?", id).First(&ingredient).Error; err != nil {
+		return nil, translateError(err)
+	}
+
+	return &ingredient, nil
+}
+
 func (s *Database) SaveIngredient(ingredient *IngredientV1) (err error) {
-	s.db.Save(ingredient)
-	return nil
+	return translateError(s.db.Omit(clause.Associations).Save(ingredient).Error)
 }
 
 func (s *Database) SaveServing(serving *ServingV1) (err error) {
-	s.db.Save(serving)
-	return nil
+	return s.db.Omit(clause.Associations).Save(serving).Error
 }
 
 func (s *Database) GetServing(id uint) (result *ServingV1, err error) {
 	var serving ServingV1
-	s.db.Preload("Recipe").Preload("Recipe.RecipeDifficulty").Preload("Recipe.Ingredients").Preload("Recipe.Ingredients.Unit").Where("id = ?", id).First(&serving)
+	if err := s.db.Scopes(preloadServingRecipe).Preload("Deductions.Ingredient.Unit").Where("id = ?", id).First(&serving).Error; err != nil {
+		return nil, translateError(err)
+	}
 
 	return &serving, nil
 }
+
+// LoadPlannedServings loads servings planned for the days between from and to (both inclusive)
+func (s *Database) LoadPlannedServings(from time.Time, to time.Time) (result *[]ServingV1, err error) {
+	var servings []ServingV1
+	if err := s.db.Where("planned_for >= ? AND planned_for < ?", from, to.AddDate(0, 0, 1)).
+		Order("planned_for, id").
+		Preload("MealSlot").Preload("Deductions.Ingredient.Unit").Scopes(preloadServingRecipe).
+		Find(&servings).Error; err != nil {
+		return nil, err
+	}
+
+	return &servings, nil
+}
+
+// LoadUnplannedServings loads not cooked servings which are not planned for any day yet
+func (s *Database) LoadUnplannedServings() (result *[]ServingV1, err error) {
+	var servings []ServingV1
+	if err := s.db.Where("cooked_at IS NULL AND planned_for IS NULL").
+		Scopes(preloadServingRecipe).
+		Find(&servings).Error; err != nil {
+		return nil, err
+	}
+
+	return &servings, nil
+}
+
+func (s *Database) LoadMealSlots() (result *[]MealSlotV1, err error) {
+	var mealSlots []MealSlotV1
+	if err := s.db.Order("position, id").Find(&mealSlots).Error; err != nil {
+		return nil, err
+	}
+
+	return &mealSlots, nil
+}
+
+func (s *Database) GetMealSlot(id uint) (result *MealSlotV1, err error) {
+	var mealSlot MealSlotV1
+	if err := s.db.Where("id = ?", id).First(&mealSlot).Error; err != nil {
+		return nil, translateError(err)
+	}
+
+	return &mealSlot, nil
+}
+
+func (s *Database) SaveMealSlot(mealSlot *MealSlotV1) (err error) {
+	return translateError(s.db.Save(mealSlot).Error)
+}
+
+// DeleteMealSlot removes the meal slot, servings planned for it are kept without a slot
+func (s *Database) DeleteMealSlot(id uint) (err error) {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ServingV1{}).Where("meal_slot_id = ?", id).Update("meal_slot_id", nil).Error; err != nil {
+			return err
+		}
+
+		result := tx.Delete(&MealSlotV1{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return nil
+	})
+}
+
+func (s *Database) LoadPantry() (result *[]PantryV1, err error) {
+	var pantry []PantryV1
+	if err := s.db.Preload("Ingredient").Preload("Ingredient.Unit").Find(&pantry).Error; err != nil {
+		return nil, err
+	}
+
+	return &pantry, nil
+}
+
+func (s *Database) GetPantryStock(ingredientID uint) (result *PantryV1, err error) {
+	var stock PantryV1
+	if err := s.db.Where("ingredient_v1_id = ?", ingredientID).First(&stock).Error; err != nil {
+		return nil, translateError(err)
+	}
+
+	return &stock, nil
+}
+
+// AddPantryStock adds the amount to the ingredient stock in one transaction, a new ingredient is created first
+func (s *Database) AddPantryStock(ingredient *IngredientV1, amount float64) (err error) {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if ingredient.ID == 0 {
+			if err := tx.Omit(clause.Associations).Create(ingredient).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Model(ingredient).Select("Density").Updates(ingredient).Error; err != nil {
+			return err
+		}
+
+		var stock PantryV1
+		if err := tx.Where("ingredient_v1_id = ?", ingredient.ID).Limit(1).Find(&stock).Error; err != nil {
+			return err
+		}
+
+		stock.IngredientV1ID = ingredient.ID
+		stock.Amount += amount
+
+		return tx.Omit(clause.Associations).Save(&stock).Error
+	})
+
+	return translateError(err)
+}
+
+// UpdatePantryStock updates the ingredient and sets its stock in one transaction
+func (s *Database) UpdatePantryStock(ingredient *IngredientV1, amount float64) (err error) {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(ingredient).Omit(clause.Associations).Select("Name", "Density", "UpdatedAt").Updates(ingredient)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		stock := PantryV1{IngredientV1ID: ingredient.ID, Amount: amount}
+		return tx.Omit(clause.Associations).Save(&stock).Error
+	})
+
+	return translateError(err)
+}
+
+// DeletePantryStock removes the ingredient from the pantry, the ingredient itself is kept for recipes
+func (s *Database) DeletePantryStock(ingredientID uint) (err error) {
+	result := s.db.Where("ingredient_v1_id = ?", ingredientID).Delete(&PantryV1{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Database) LoadShoppingChecks() (result *[]ShoppingCheckV1, err error) {
+	var checks []ShoppingCheckV1
+	if err := s.db.Find(&checks).Error; err != nil {
+		return nil, err
+	}
+
+	return &checks, nil
+}
+
+func (s *Database) SaveShoppingCheck(check *ShoppingCheckV1) (err error) {
+	return translateError(s.db.Save(check).Error)
+}
+
+func (s *Database) DeleteShoppingCheck(ingredientID uint) (err error) {
+	return s.db.Where("ingredient_v1_id = ?", ingredientID).Delete(&ShoppingCheckV1{}).Error
+}
+
+func (s *Database) ClearShoppingChecks() (err error) {
+	return s.db.Where("1 = 1").Delete(&ShoppingCheckV1{}).Error
+}
+
+// CookServing marks the serving cooked and takes the deductions from the pantry in one transaction,
+// stock never goes below zero, the missing part is recorded as the deduction shortage
+func (s *Database) CookServing(id uint, cookedAt time.Time, deductions []PantryDeductionV1) (err error) {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return cookServing(tx, id, cookedAt, deductions)
+	})
+}
+
+// RateServing rates the cooked serving and keeps the average rating of its recipe up to date in one transaction,
+// rating the serving again replaces its previous rating in the average
+func (s *Database) RateServing(id uint, rating uint, notes string) (err error) {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return rateServing(tx, id, rating, notes)
+	})
+}
+
+// CookRatedServing cooks the serving and rates it in one transaction, so a failed rating leaves the serving
+// not cooked and the pantry stock as it was
+func (s *Database) CookRatedServing(id uint, cookedAt time.Time, deductions []PantryDeductionV1, rating uint, notes string) (err error) {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := cookServing(tx, id, cookedAt, deductions); err != nil {
+			return err
+		}
+
+		return rateServing(tx, id, rating, notes)
+	})
+}
+
+// cookServing marks the serving cooked and takes the deductions from the pantry within the transaction
+func cookServing(tx *gorm.DB, id uint, cookedAt time.Time, deductions []PantryDeductionV1) error {
+	var serving ServingV1
+	if err := tx.Where("id = ?", id).First(&serving).Error; err != nil {
+		return translateError(err)
+	}
+
+	if serving.CookedAt.Valid {
+		return fmt.Errorf("serving %d is already cooked: %w", id, ErrConflict)
+	}
+
+	for _, deduction := range deductions {
+		var stock PantryV1
+		result := tx.Where("ingredient_v1_id = ?", deduction.IngredientV1ID).Limit(1).Find(&stock)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		deduction.ID = 0
+		deduction.ServingV1ID = id
+		deduction.Deducted = math.Min(math.Max(stock.Amount, 0), deduction.Amount)
+		deduction.Shortage = deduction.Amount - deduction.Deducted
+		deduction.CreatedAt = cookedAt
+
+		if result.RowsAffected > 0 && deduction.Deducted > 0 {
+			if err := tx.Model(&PantryV1{}).Where("ingredient_v1_id = ?", deduction.IngredientV1ID).
+				Update("amount", stock.Amount-deduction.Deducted).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Omit(clause.Associations).Create(&deduction).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(&ServingV1{}).Where("id = ?", id).Updates(map[string]any{
+		"cooked_at":  sql.NullTime{Time: cookedAt, Valid: true},
+		"updated_at": sql.NullTime{Time: cookedAt, Valid: true},
+	}).Error
+}
+
+// rateServing rates the cooked serving and its recipe within the transaction
+func rateServing(tx *gorm.DB, id uint, rating uint, notes string) error {
+	var serving ServingV1
+	if err := tx.Where("id = ?", id).First(&serving).Error; err != nil {
+		return translateError(err)
+	}
+
+	if !serving.CookedAt.Valid {
+		return fmt.Errorf("serving %d is not cooked: %w", id, ErrConflict)
+	}
+
+	if err := rateRecipe(tx, serving.RecipeID, serving.Rating, rating); err != nil {
+		return err
+	}
+
+	return tx.Model(&ServingV1{}).Where("id = ?", id).Updates(map[string]any{
+		"rating":     rating,
+		"notes":      notes,
+		"updated_at": sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	}).Error
+}
+
+// rateRecipe replaces a serving rating in the recipe average, zero previous rating adds a new one
+// and zero rating removes the previous one
+func rateRecipe(tx *gorm.DB, recipeID uint, previous uint, rating uint) error {
+	var recipe RecipeV1
+	if err := tx.Select("id", "rating", "rating_count").Where("id = ?", recipeID).First(&recipe).Error; err != nil {
+		return translateError(err)
+	}
+
+	total := recipe.Rating*float64(recipe.RatingCount) - float64(previous) + float64(rating)
+	count := recipe.RatingCount
+	if previous == 0 && rating > 0 {
+		count++
+	}
+	if previous > 0 && rating == 0 {
+		count--
+	}
+
+	average := 0.0
+	if count > 0 {
+		average = total / float64(count)
+	}
+
+	return tx.Model(&RecipeV1{}).Where("id = ?", recipeID).UpdateColumns(map[string]any{
+		"rating":       average,
+		"rating_count": count,
+	}).Error
+}
+
+// UncookServing returns the deducted stock to the pantry and marks the serving not cooked in one transaction,
+// the serving rating is taken out of its recipe rating
+func (s *Database) UncookServing(id uint) (err error) {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var serving ServingV1
+		if err := tx.Preload("Deductions").Where("id = ?", id).First(&serving).Error; err != nil {
+			return translateError(err)
+		}
+
+		if !serving.CookedAt.Valid {
+			return fmt.Errorf("serving %d is not cooked: %w", id, ErrConflict)
+		}
+
+		for _, deduction := range serving.Deductions {
+			if deduction.Deducted <= 0 {
+				continue
+			}
+
+			var stock PantryV1
+			result := tx.Where("ingredient_v1_id = ?", deduction.IngredientV1ID).Limit(1).Find(&stock)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			if result.RowsAffected == 0 {
+				stock = PantryV1{IngredientV1ID: deduction.IngredientV1ID, Amount: deduction.Deducted}
+				if err := tx.Omit(clause.Associations).Create(&stock).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := tx.Model(&PantryV1{}).Where("ingredient_v1_id = ?", deduction.IngredientV1ID).
+				Update("amount", stock.Amount+deduction.Deducted).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("serving_v1_id = ?", id).Delete(&PantryDeductionV1{}).Error; err != nil {
+			return err
+		}
+
+		// the rating is of the cooking being undone
+		if serving.Rating > 0 {
+			if err := rateRecipe(tx, serving.RecipeID, serving.Rating, 0); err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&ServingV1{}).Where("id = ?", id).Updates(map[string]any{
+			"cooked_at":  sql.NullTime{},
+			"rating":     0,
+			"notes":      "",
+			"updated_at": sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		}).Error
+	})
+}
@@ -0,0 +1,648 @@
+//go:build fts5
+
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// newTestDatabase migrates a database in a temporary directory, the migration seeds it of a csv file with a recipe
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	return newTestDatabaseOf(t, "title,amount,unit,ingredient,difficulty\nPancakes,200,g,Flour,medium\nPancakes,2,pcs,Egg,medium\n")
+}
+
+// newTestDatabaseOf migrates a database in a temporary directory seeded of the csv
+func newTestDatabaseOf(t *testing.T, csv string) *Database {
+	t.Helper()
+
+	dir := t.TempDir()
+	seedDir := filepath.Join(dir, "backend", "store", "seed-data")
+	if err := os.MkdirAll(seedDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(seedDir, "data.csv"), []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(workDir) })
+
+	name := databaseName
+	databaseName = filepath.Join(dir, "eatrepeat.sqlite")
+	t.Cleanup(func() { databaseName = name })
+
+	database, err := NewDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	return database
+}
+
+func TestSaveSyncedRecipeKeepsOtherColumns(t *testing.T) {
+	database := newTestDatabase(t)
+
+	// the recipe as it's read when the sync starts
+	synced, err := database.GetRecipe(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the recipe is rated while its pdf is read
+	if err := database.db.Model(&RecipeV1{}).Where("id = ?", 1).
+		Updates(map[string]interface{}{"rating": 4.5, "rating_count": 2, "recipe_difficulty_id": 3}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	synced.Description = "extracted"
+	synced.PdfHash = "hash"
+	if _, err := database.SaveSyncedRecipe(synced); err != nil {
+		t.Fatal(err)
+	}
+
+	recipe, err := database.GetRecipe(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipe.Description != "extracted" || recipe.PdfHash != "hash" {
+		t.Errorf("synced columns = %q, %q, want extracted, hash", recipe.Description, recipe.PdfHash)
+	}
+	if recipe.Rating != 4.5 || recipe.RatingCount != 2 || recipe.RecipeDifficultyID != 3 {
+		t.Errorf("rating = %v (%d), difficulty = %d, want 4.5 (2), 3", recipe.Rating, recipe.RatingCount, recipe.RecipeDifficultyID)
+	}
+
+	if _, err := database.SaveSyncedRecipe(&RecipeV1{ID: 100, Title: "Missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("save of unknown recipe error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestUpdateRecipeKeepsOtherColumns(t *testing.T) {
+	database := newTestDatabase(t)
+
+	// the recipe as it's read when the edit starts
+	edited, err := database.GetRecipe(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the recipe is rated and synced while it's edited
+	if err := database.db.Model(&RecipeV1{}).Where("id = ?", 1).
+		Updates(map[string]interface{}{"rating": 4.5, "rating_count": 2, "pdf_hash": "hash", "sync_failures": 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	edited.Title = "Crepes"
+	edited.Portions = 4
+	if err := database.UpdateRecipe(edited); err != nil {
+		t.Fatal(err)
+	}
+
+	recipe, err := database.GetRecipe(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipe.Title != "Crepes" || recipe.Portions != 4 {
+		t.Errorf("edited columns = %q, %d, want Crepes, 4", recipe.Title, recipe.Portions)
+	}
+	if recipe.Rating != 4.5 || recipe.RatingCount != 2 || recipe.PdfHash != "hash" || recipe.SyncFailures != 1 {
+		t.Errorf("rating = %v (%d), pdf hash = %q, sync failures = %d, want 4.5 (2), hash, 1",
+			recipe.Rating, recipe.RatingCount, recipe.PdfHash, recipe.SyncFailures)
+	}
+	if len(recipe.Ingredients) != len(edited.Ingredients) {
+		t.Errorf("ingredient lines = %d, want %d", len(recipe.Ingredients), len(edited.Ingredients))
+	}
+
+	if err := database.UpdateRecipe(&RecipeV1{ID: 100, Title: "Missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("update of unknown recipe error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestSeedRecipeDifficulties(t *testing.T) {
+	database := newTestDatabaseOf(t, "title,amount,unit,ingredient,difficulty\n"+
+		"Salad,1,pcs,Lettuce,easy\n"+
+		"Risotto,200,g,Rice,Medium\n"+
+		"Souffle,3,pcs,Egg, HARD \n"+
+		"Stew,500,g,Beef,tricky\n"+
+		"Toast,2,pcs,Bread\n"+
+		"Omelette,2,pcs,Egg,\n"+
+		"Omelette,1,g,Salt,easy\n")
+
+	difficulties := map[string]string{}
+	var recipes []RecipeV1
+	if err := database.db.Preload("RecipeDifficulty").Find(&recipes).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, recipe := range recipes {
+		difficulties[recipe.Title] = recipe.RecipeDifficulty.Name
+	}
+
+	want := map[string]string{
+		"Salad":    "Easy",
+		"Risotto":  "Medium",
+		"Souffle":  "Hard",
+		"Stew":     "",
+		"Toast":    "",
+		"Omelette": "Easy",
+	}
+	if !reflect.DeepEqual(difficulties, want) {
+		t.Errorf("difficulties of recipes = %v, want %v", difficulties, want)
+	}
+
+	// recipes seeded before difficulties existed get them of the csv file, a set difficulty is kept
+	if err := database.db.Model(&RecipeV1{}).Where("title IN ?", []string{"Salad", "Risotto"}).
+		Update("recipe_difficulty_id", 0).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.db.Model(&RecipeV1{}).Where("title = ?", "Souffle").Update("recipe_difficulty_id", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	recipes = nil
+	if err := database.db.Preload("RecipeDifficulty").Where("title IN ?", []string{"Salad", "Risotto", "Souffle"}).
+		Order("title").Find(&recipes).Error; err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, recipe := range recipes {
+		got = append(got, recipe.Title+" "+recipe.RecipeDifficulty.Name)
+	}
+	if fmt.Sprint(got) != "[Risotto Medium Salad Easy Souffle Easy]" {
+		t.Errorf("difficulties of migrated recipes = %v, want [Risotto Medium Salad Easy Souffle Easy]", got)
+	}
+}
+
+func TestLoadRecipesOfDifficulty(t *testing.T) {
+	database := newTestDatabaseOf(t, "title,amount,unit,ingredient,difficulty\n"+
+		"Salad,1,pcs,Lettuce,easy\n"+
+		"Toast,2,pcs,Bread,easy\n"+
+		"Risotto,200,g,Rice,medium\n"+
+		"Stew,500,g,Beef\n")
+
+	tests := []struct {
+		name         string
+		difficultyID uint
+		want         []string
+	}{
+		{name: "any difficulty", want: []string{"Risotto", "Salad", "Stew", "Toast"}},
+		{name: "easy", difficultyID: 1, want: []string{"Salad", "Toast"}},
+		{name: "medium", difficultyID: 2, want: []string{"Risotto"}},
+		{name: "hard", difficultyID: 3, want: []string{}},
+		{name: "unknown difficulty", difficultyID: 9, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipes, err := database.LoadRecipes(1, 10, RecipeFilter{DifficultyID: tt.difficultyID})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			titles := []string{}
+			for _, recipe := range recipes.Recipes {
+				titles = append(titles, recipe.Title)
+			}
+			sort.Strings(titles)
+			if !reflect.DeepEqual(titles, tt.want) || recipes.Total != int64(len(tt.want)) {
+				t.Errorf("recipes = %v (total %d), want %v", titles, recipes.Total, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRecipesMatchesWholeIngredientName(t *testing.T) {
+	database := newTestDatabase(t)
+
+	moussaka := &RecipeV1{
+		Title:              "Moussaka",
+		RecipeDifficultyID: 1,
+		Ingredients: []RecipeV1IngredientV1{
+			{Amount: 2, Ingredient: IngredientV1{Name: "Eggplant", Unit: UnitV1{Name: "pcs"}}},
+		},
+	}
+	if err := database.CreateRecipe(moussaka); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter RecipeFilter
+		want   []string
+	}{
+		{name: "ingredient", filter: RecipeFilter{Ingredients: []string{"egg"}}, want: []string{"Pancakes"}},
+		{name: "ingredient in other case", filter: RecipeFilter{Ingredients: []string{"EGGPLANT"}}, want: []string{"Moussaka"}},
+		{name: "part of ingredient name", filter: RecipeFilter{Ingredients: []string{"egg%"}}, want: []string{}},
+		{name: "excluded ingredient", filter: RecipeFilter{ExcludedIngredients: []string{"Egg"}}, want: []string{"Moussaka"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipes, err := database.LoadRecipes(1, 10, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			titles := []string{}
+			for _, recipe := range recipes.Recipes {
+				titles = append(titles, recipe.Title)
+			}
+			if strings.Join(titles, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("recipes = %v, want %v", titles, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRecipesFacets(t *testing.T) {
+	database := newTestDatabase(t)
+
+	if err := database.db.Model(&RecipeV1{}).Where("id = ?", 1).
+		Updates(map[string]interface{}{"rating": 3.5, "rating_count": 2}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	recipes, err := database.LoadRecipes(1, 10, RecipeFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipes.Total != 1 || len(recipes.Facets.Ratings) != 0 || len(recipes.Facets.Ingredients) != 0 {
+		t.Errorf("recipes without facets = total %d, facets %+v, want total 1 and no facets", recipes.Total, recipes.Facets)
+	}
+
+	recipes, err = database.LoadRecipes(1, 10, RecipeFilter{WithFacets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ratings := []int64{}
+	for _, rating := range recipes.Facets.Ratings {
+		ratings = append(ratings, rating.Count)
+	}
+	if fmt.Sprint(ratings) != "[1 1 1 0 0]" {
+		t.Errorf("rating facets = %v, want [1 1 1 0 0]", ratings)
+	}
+	if len(recipes.Facets.Ingredients) != 2 || len(recipes.Facets.Difficulties) != 1 {
+		t.Errorf("facets = %+v, want 2 ingredients and 1 difficulty", recipes.Facets)
+	}
+}
+
+func TestCheckAndRebuildSearchIndex(t *testing.T) {
+	database := newTestDatabase(t)
+
+	status, err := database.CheckSearchIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Consistent || status.Recipes != 1 || status.Indexed != 1 {
+		t.Fatalf("status of migrated index = %+v, want a consistent index of 1 recipe", status)
+	}
+
+	// the recipe is removed of the index and a deleted recipe is left in it
+	if err := database.db.Exec(`INSERT INTO recipe_v1_fts (recipe_v1_fts, rowid, ` + recipeSearchColumns + `)
+		SELECT 'delete', id, ` + recipeSearchColumns + ` FROM recipe_v1_search WHERE id = 1`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.db.Exec(`INSERT INTO recipe_v1_fts (rowid, title) VALUES (100, 'Deleted')`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = database.CheckSearchIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Consistent || fmt.Sprint(status.Missing) != "[1]" || fmt.Sprint(status.Stale) != "[100]" || status.Error == "" {
+		t.Errorf("status of broken index = %+v, want missing [1], stale [100] and an integrity error", status)
+	}
+
+	if err := database.RebuildSearchIndex(); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = database.CheckSearchIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Consistent || status.Indexed != 1 {
+		t.Errorf("status of rebuilt index = %+v, want a consistent index of 1 recipe", status)
+	}
+}
+
+func TestMigrateIndexesRecipesOfDatabaseWithoutIndex(t *testing.T) {
+	database := newTestDatabase(t)
+
+	// a database of an older version without the index
+	if err := database.dropSearchTriggers(); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.db.Exec("DROP TABLE recipe_v1_fts").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the recipe is indexed before the triggers are made, so the update trigger can remove its text
+	if err := database.db.Model(&RecipeV1{}).Where("id = ?", 1).Update("title", "Crepes").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := database.CheckSearchIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Consistent || status.Indexed != 1 {
+		t.Errorf("status of migrated index = %+v, want a consistent index of 1 recipe", status)
+	}
+
+	recipes, err := database.LoadRecipes(1, 10, RecipeFilter{SearchTerm: "crepes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipes.Recipes) != 1 {
+		t.Errorf("found %d recipes of the updated title, want 1", len(recipes.Recipes))
+	}
+}
+
+func TestCookAndUncookServing(t *testing.T) {
+	database := newTestDatabase(t)
+
+	var flour, egg IngredientV1
+	if err := database.db.Where("name = ?", "Flour").First(&flour).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.db.Where("name = ?", "Egg").First(&egg).Error; err != nil {
+		t.Fatal(err)
+	}
+	milk := IngredientV1{Name: "Milk", UnitID: flour.UnitID}
+	if err := database.db.Omit(clause.Associations).Create(&milk).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.AddPantryStock(&flour, 300); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AddPantryStock(&egg, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	serving := ServingV1{RecipeID: 1, Portions: 2, CreatedAt: time.Now()}
+	if err := database.SaveServing(&serving); err != nil {
+		t.Fatal(err)
+	}
+
+	stock := func() map[uint]float64 {
+		pantry, err := database.LoadPantry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := make(map[uint]float64)
+		for _, item := range *pantry {
+			result[item.IngredientV1ID] = item.Amount
+		}
+		return result
+	}
+
+	deductions := []PantryDeductionV1{
+		{IngredientV1ID: flour.ID, Amount: 200},
+		// one egg is in the pantry, the missing one is a shortage
+		{IngredientV1ID: egg.ID, Amount: 2},
+		// milk isn't in the pantry at all
+		{IngredientV1ID: milk.ID, Amount: 100},
+	}
+	if err := database.CookServing(serving.ID, time.Now().UTC(), deductions); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := stock(), map[uint]float64{flour.ID: 100, egg.ID: 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stock of cooked serving = %v, want %v", got, want)
+	}
+
+	var recorded []PantryDeductionV1
+	if err := database.db.Where("serving_v1_id = ?", serving.ID).Order("id").Find(&recorded).Error; err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, deduction := range recorded {
+		got = append(got, fmt.Sprintf("%d %v/%v/%v", deduction.IngredientV1ID, deduction.Amount, deduction.Deducted, deduction.Shortage))
+	}
+	want := []string{
+		fmt.Sprintf("%d 200/200/0", flour.ID),
+		fmt.Sprintf("%d 2/1/1", egg.ID),
+		fmt.Sprintf("%d 100/0/100", milk.ID),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("deductions = %v, want %v", got, want)
+	}
+
+	if err := database.CookServing(serving.ID, time.Now().UTC(), deductions); !errors.Is(err, ErrConflict) {
+		t.Errorf("cook of cooked serving error = %v, want %v", err, ErrConflict)
+	}
+	if got, want := stock(), map[uint]float64{flour.ID: 100, egg.ID: 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stock of serving cooked again = %v, want %v", got, want)
+	}
+
+	// stock used meanwhile is kept, only the recorded deductions are returned
+	if err := database.UpdatePantryStock(&flour, 50); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.UncookServing(serving.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := stock(), map[uint]float64{flour.ID: 250, egg.ID: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stock of uncooked serving = %v, want %v", got, want)
+	}
+
+	uncooked, err := database.GetServing(serving.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uncooked.CookedAt.Valid || len(uncooked.Deductions) != 0 {
+		t.Errorf("uncooked serving = cooked %v, deductions %v, want not cooked without deductions", uncooked.CookedAt, uncooked.Deductions)
+	}
+
+	if err := database.UncookServing(serving.ID); !errors.Is(err, ErrConflict) {
+		t.Errorf("uncook of not cooked serving error = %v, want %v", err, ErrConflict)
+	}
+	if err := database.CookServing(100, time.Now().UTC(), nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("cook of unknown serving error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestCookRatedServing(t *testing.T) {
+	database := newTestDatabase(t)
+
+	var flour IngredientV1
+	if err := database.db.Where("name = ?", "Flour").First(&flour).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AddPantryStock(&flour, 300); err != nil {
+		t.Fatal(err)
+	}
+
+	serving := ServingV1{RecipeID: 1, Portions: 2, CreatedAt: time.Now()}
+	if err := database.SaveServing(&serving); err != nil {
+		t.Fatal(err)
+	}
+	// the recipe of the serving is gone, so rating it fails after the serving is cooked
+	orphan := ServingV1{RecipeID: 100, Portions: 2, CreatedAt: time.Now()}
+	if err := database.db.Omit(clause.Associations).Create(&orphan).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	deductions := []PantryDeductionV1{{IngredientV1ID: flour.ID, Amount: 200}}
+	flourStock := func() float64 {
+		var stock PantryV1
+		if err := database.db.Where("ingredient_v1_id = ?", flour.ID).First(&stock).Error; err != nil {
+			t.Fatal(err)
+		}
+		return stock.Amount
+	}
+
+	if err := database.CookRatedServing(orphan.ID, time.Now().UTC(), deductions, 4, "crispy"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("cook of serving without recipe error = %v, want %v", err, ErrNotFound)
+	}
+
+	failed, err := database.GetServing(orphan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed.CookedAt.Valid || failed.Rating != 0 || len(failed.Deductions) != 0 {
+		t.Errorf("serving of failed rating = cooked %v, rating %d, deductions %v, want not cooked", failed.CookedAt, failed.Rating, failed.Deductions)
+	}
+	if got := flourStock(); got != 300 {
+		t.Errorf("flour stock of failed rating = %v, want 300", got)
+	}
+
+	if err := database.CookRatedServing(serving.ID, time.Now().UTC(), deductions, 4, "crispy"); err != nil {
+		t.Fatal(err)
+	}
+
+	cooked, err := database.GetServing(serving.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cooked.CookedAt.Valid || cooked.Rating != 4 || cooked.Notes != "crispy" {
+		t.Errorf("serving = cooked %v, rating %d, notes %q, want cooked with rating 4 and notes crispy", cooked.CookedAt, cooked.Rating, cooked.Notes)
+	}
+	if got := flourStock(); got != 100 {
+		t.Errorf("flour stock = %v, want 100", got)
+	}
+
+	var recipe RecipeV1
+	if err := database.db.Where("id = ?", 1).First(&recipe).Error; err != nil {
+		t.Fatal(err)
+	}
+	if recipe.Rating != 4 || recipe.RatingCount != 1 {
+		t.Errorf("recipe rating = %v of %d, want 4 of 1", recipe.Rating, recipe.RatingCount)
+	}
+
+	if err := database.CookRatedServing(serving.ID, time.Now().UTC(), deductions, 5, ""); !errors.Is(err, ErrConflict) {
+		t.Errorf("cook of cooked serving error = %v, want %v", err, ErrConflict)
+	}
+}
+
+func TestMigrateMovesServingMealSlots(t *testing.T) {
+	type serving struct {
+		text       string
+		mealSlotID uint
+	}
+
+	tests := []struct {
+		name     string
+		servings []serving
+		want     string
+	}{
+		{
+			name:     "texts of default meal slots",
+			servings: []serving{{text: "dinner"}, {text: " BREAKFAST"}, {text: "Snack"}},
+			want:     "[Dinner 4 Breakfast 1 Snack 3]",
+		},
+		{
+			name:     "texts without meal slot",
+			servings: []serving{{text: " Brunch "}, {text: "brunch"}, {text: "Late supper"}},
+			want:     "[Brunch 5 Brunch 5 Late supper 6]",
+		},
+		{
+			name:     "servings without text",
+			servings: []serving{{text: ""}, {text: "  "}},
+			want:     "[ ]",
+		},
+		{
+			name:     "servings of meal slot",
+			servings: []serving{{text: "dinner", mealSlotID: 2}},
+			want:     "[Lunch 2]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+
+			// servings of an older version keep their meal slot as text, the column is added as gorm added it
+			if err := database.db.Exec("ALTER TABLE serving_v1 ADD COLUMN `meal_slot` varchar(255)").Error; err != nil {
+				t.Fatal(err)
+			}
+			for _, serving := range tt.servings {
+				var mealSlotID any
+				if serving.mealSlotID != 0 {
+					mealSlotID = serving.mealSlotID
+				}
+				if err := database.db.Exec("INSERT INTO serving_v1 (recipe_id, portions, meal_slot, meal_slot_id, created_at) VALUES (1, 2, ?, ?, ?)",
+					serving.text, mealSlotID, time.Now()).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := database.Migrate(); err != nil {
+				t.Fatal(err)
+			}
+
+			if database.db.Migrator().HasColumn(&ServingV1{}, "meal_slot") {
+				t.Error("meal_slot column is kept")
+			}
+
+			var servings []ServingV1
+			if err := database.db.Preload("MealSlot").Order("id").Find(&servings).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			for _, serving := range servings {
+				if serving.MealSlot == nil {
+					got = append(got, "")
+					continue
+				}
+				got = append(got, fmt.Sprintf("%s %d", serving.MealSlot.Name, serving.MealSlot.Position))
+			}
+			if fmt.Sprint(got) != tt.want {
+				t.Errorf("meal slots of servings = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,14 +2,96 @@ package store
 
 import (
 	"database/sql"
+	"errors"
 	"time"
+	"unicode/utf8"
+)
+
+// Error messages, processors wrap them to tell the kind of failure
+var (
+	ErrNotFound = errors.New("record not found")
+	ErrConflict = errors.New("conflict")
+	ErrInvalid  = errors.New("invalid data")
 )
 
 type Recipes struct {
-	Recipes    []RecipeV1
-	Page       int
-	PageSize   int
+	Recipes  []RecipeV1
+	Page     int
+	PageSize int
+	Filter   RecipeFilter
+	// Total counts recipes of the filter on all pages
+	Total  int64
+	Facets RecipeFacets
+	// Snippets are fragments of the recipe texts matching the search term by recipe id, the matching words are marked by <mark> tags
+	Snippets map[uint]string
+}
+
+// SearchIndexStatus compares the recipes search index with the recipes
+type SearchIndexStatus struct {
+	Recipes int64
+	Indexed int64
+	// Missing are ids of recipes not in the index, Stale are ids of deleted recipes still in the index
+	Missing []uint
+	Stale   []uint
+	// Error is the integrity check failure of an index not matching the recipe texts
+	Error      string
+	Consistent bool
+}
+
+// RecipeFilter narrows and orders loaded recipes, zero values don't narrow them
+type RecipeFilter struct {
 	SearchTerm string
+	// Ingredients keeps recipes with all of the ingredients, ExcludedIngredients drops recipes with any of them,
+	// an ingredient matches by its whole name in any case, e.g. "egg" matches "Egg" but not "Eggplant"
+	Ingredients         []string
+	ExcludedIngredients []string
+	// MaxTotalTimeInMinutes keeps recipes with known preparation and cooking time at most as long
+	MaxTotalTimeInMinutes uint
+	// DifficultyID keeps recipes of the difficulty
+	DifficultyID uint
+	// MinRating keeps recipes rated at least as high, unrated recipes are dropped by any minimum
+	MinRating float64
+	// Tags keeps recipes with all of the tags
+	Tags []string
+	// CookedWithinDays keeps recipes with a serving cooked in the last days
+	CookedWithinDays uint
+	Sort             RecipeSort
+	// WithFacets loads the facets of the recipes, they're left empty otherwise as they take a query each
+	WithFacets bool
+}
+
+type RecipeSort string
+
+const (
+	// RecipeSortDefault orders by search relevance when searching and by creation otherwise
+	RecipeSortDefault RecipeSort = ""
+	// RecipeSortRank orders by search relevance
+	RecipeSortRank RecipeSort = "rank"
+	// RecipeSortRating orders the best rated recipes first
+	RecipeSortRating RecipeSort = "rating"
+	// RecipeSortTime orders the quickest recipes first, recipes of unknown time are the last
+	RecipeSortTime RecipeSort = "time"
+	// RecipeSortLastCooked orders the recipes cooked most recently first, never cooked ones are the last
+	RecipeSortLastCooked RecipeSort = "lastCooked"
+	// RecipeSortCreated orders the newest recipes first
+	RecipeSortCreated RecipeSort = "created"
+)
+
+// RecipeFacets count recipes of a filter by the values they could be narrowed down with further
+type RecipeFacets struct {
+	Difficulties []FacetCount
+	Tags         []FacetCount
+	// Ingredients are the most used ingredients of the recipes
+	Ingredients []FacetCount
+	// Ratings count recipes rated at least 1, 2, 3, 4 and 5
+	Ratings []FacetCount
+}
+
+// FacetCount is the number of recipes with a value, ID is set for values stored with an id
+type FacetCount struct {
+	ID    uint
+	Name  string
+	Count int64
 }
 
 // TODO: add pagination
@@ -18,15 +100,123 @@ type Ingredients struct {
 }
 
 type Week struct {
-	Days   []Day
-	Number int
-	Year   int
+	Days      []Day
+	Number    int
+	Year      int
+	MealSlots []MealSlotV1
 }
 
 type Day struct {
 	ID           string
 	IsCurrentDay bool
 	Title        string
+	Date         time.Time
+
+	// Meals has a cell per meal slot of the week in the same order
+	Meals []Meal
+	// Unslotted keeps servings planned for the day without a meal slot
+	Unslotted []ServingV1
+}
+
+// Meal is a (day, meal slot) cell of the week grid
+type Meal struct {
+	MealSlot MealSlotV1
+	Servings []ServingV1
+}
+
+// ShoppingList is a list of ingredients required by servings to cook which are missing in the pantry
+type ShoppingList struct {
+	From  sql.NullTime
+	To    sql.NullTime
+	Items []ShoppingItem
+}
+
+// NutritionSummary sums nutrition of servings planned between From and To, a planned serving
+// counts as a single portion, so the sums are what one person eats
+type NutritionSummary struct {
+	From  time.Time
+	To    time.Time
+	Days  []DayNutrition
+	Weeks []WeekNutrition
+
+	Total Nutrition
+	// DailyAverage is averaged over the days with planned servings
+	DailyAverage Nutrition
+	// MissingServings are planned servings of recipes without nutrition, they are not in the sums
+	MissingServings uint
+}
+
+type DayNutrition struct {
+	Date     time.Time
+	Servings uint
+	Total    Nutrition
+}
+
+type WeekNutrition struct {
+	Year   int
+	Number int
+	// Days counts the days of the week with planned servings
+	Days         uint
+	Total        Nutrition
+	DailyAverage Nutrition
+}
+
+// Nutrition sums nutrition values, a value missing in a recipe counts as zero
+type Nutrition struct {
+	Calories float64
+	Carbs    float64
+	Protein  float64
+	Fat      float64
+	Fibre    float64
+	Sugar    float64
+	Salt     float64
+}
+
+type ShoppingItem struct {
+	Ingredient IngredientV1
+	Required   float64
+	InPantry   float64
+	ToBuy      float64
+	Checked    bool
+}
+
+// RecipeDraft is a recipe to create or update, ingredients and units of its lines are referenced by name
+type RecipeDraft struct {
+	Title                    string
+	Description              string
+	PreparationTimeInMinutes uint
+	CookingTimeInMinutes     uint
+	Portions                 uint
+	// DifficultyID is the recipe difficulty, zero keeps the current one
+	DifficultyID uint
+	// Tags replace the recipe tags
+	Tags        []string
+	Ingredients []RecipeLineDraft
+}
+
+// RecipeLineDraft is an ingredient line of a recipe draft, empty unit means the ingredient unit
+type RecipeLineDraft struct {
+	Ingredient string
+	Amount     float64
+	Unit       string
+}
+
+// PantryItem is an ingredient with its stock in the pantry, the amount is in the ingredient unit
+type PantryItem struct {
+	Ingredient IngredientV1
+	Amount     float64
+	// InStock tells the ingredient has a stock entry in the pantry
+	InStock bool
+}
+
+// PantryDraft is a pantry stock to add or update, the ingredient and the unit are referenced by name,
+// empty unit means the ingredient unit
+type PantryDraft struct {
+	Ingredient string
+	Amount     float64
+	Unit       string
+	// Density in grams per millilitre of the ingredient, stock added without a density keeps the ingredient density
+	Density sql.NullFloat64
 }
 
 type JobStatus string
@@ -36,23 +226,85 @@ const (
 	JobStatusInProgress JobStatus = "in_progress"
 	JobStatusCompleted  JobStatus = "completed"
 	JobStatusFailed     JobStatus = "failed"
+	JobStatusCancelled  JobStatus = "cancelled"
 )
 
 type JobV1 struct {
 	ID     uint      `gorm:"primaryKey;autoIncrement"`
 	Status JobStatus `gorm:"not null"`
 
+	StartedAt  sql.NullTime
+	FinishedAt sql.NullTime
+
+	// Processed, Failed and Skipped count recipes of the job by their item status
+	Processed uint `gorm:"not null;default:0"`
+	Failed    uint `gorm:"not null;default:0"`
+	Skipped   uint `gorm:"not null;default:0"`
+
+	Items []JobItemV1 `gorm:"foreignKey:JobV1ID"`
+
 	CreatedAt time.Time
 	UpdatedAt sql.NullTime
 }
 
+type JobItemStatus string
+
+const (
+	JobItemStatusProcessed JobItemStatus = "processed"
+	JobItemStatusFailed    JobItemStatus = "failed"
+	JobItemStatusSkipped   JobItemStatus = "skipped"
+)
+
+// JobItemV1 is the outcome of a job for a recipe, Error tells why the recipe failed or was skipped
+type JobItemV1 struct {
+	ID uint `gorm:"primaryKey;autoIncrement"`
+
+	JobV1ID uint `gorm:"index;not null"`
+
+	RecipeID    uint
+	RecipeTitle string        `gorm:"type:varchar(255)"`
+	Status      JobItemStatus `gorm:"type:varchar(16);not null"`
+	Error       string        `gorm:"type:varchar(4000)"`
+
+	CreatedAt time.Time
+}
+
 type ServingV1 struct {
 	ID uint `gorm:"primaryKey;autoIncrement"`
 
 	RecipeID uint
 	Recipe   RecipeV1 `gorm:"foreignKey:RecipeID"`
 
+	// Portions is the number of people the serving is cooked for, zero means the recipe portions
+	Portions uint `gorm:"not null;default:0"`
+	// ScaledIngredients are the recipe ingredient lines scaled to the serving portions, they are not stored
+	ScaledIngredients []RecipeV1IngredientV1 `gorm:"-"`
+
+	// PlannedFor is the day (midnight UTC) the serving is scheduled for, unplanned servings stay in the backlog
+	PlannedFor sql.NullTime `gorm:"index"`
+	MealSlotID *uint
+	MealSlot   *MealSlotV1 `gorm:"foreignKey:MealSlotID"`
+
 	CookedAt sql.NullTime
+	// Rating is the 1-5 rating given to the cooked serving, zero means not rated
+	Rating uint   `gorm:"not null;default:0"`
+	Notes  string `gorm:"type:varchar(4000)"`
+	// Deductions are taken from the pantry when the serving is cooked
+	Deductions []PantryDeductionV1 `gorm:"foreignKey:ServingV1ID"`
+
+	CreatedAt time.Time
+	UpdatedAt sql.NullTime
+}
+
+type MealSlotV1 struct {
+	ID uint `gorm:"primaryKey;autoIncrement"`
+
+	Name     string `gorm:"type:varchar(255);unique;not null"`
+	Position uint   `gorm:"not null;default:0"`
+	// DefaultTime is the time of day the meal is usually served at (15:04)
+	DefaultTime sql.NullString `gorm:"type:varchar(5)"`
+
+	Servings []ServingV1 `gorm:"foreignKey:MealSlotID"`
 
 	CreatedAt time.Time
 	UpdatedAt sql.NullTime
@@ -62,25 +314,95 @@ type RecipeV1 struct {
 	ID uint `gorm:"primaryKey;autoIncrement"`
 
 	Title                    string                 `gorm:"type:varchar(255);unique;not null"`
+	SubTitle                 string                 `gorm:"type:varchar(255)"`
 	Description              string                 `gorm:"type:varchar(4000)"`
 	Ingredients              []RecipeV1IngredientV1 `gorm:"foreignKey:RecipeV1ID"`
 	PreparationTimeInMinutes uint
 	CookingTimeInMinutes     uint
-	ThumbnailUrl             sql.NullString
-	PdfUrl                   sql.NullString
+	// Portions is the number of people the ingredient amounts are for
+	Portions     uint `gorm:"not null;default:2"`
+	ThumbnailUrl sql.NullString
+	PdfUrl       sql.NullString
+	// PdfHash and PdfModifiedAt are of the pdf last read by the sync, an unchanged pdf is not read again
+	PdfHash       string `gorm:"type:varchar(64)"`
+	PdfModifiedAt sql.NullTime
 
 	RecipeDifficultyID uint
 	RecipeDifficulty   RecipeDifficultyV1 `gorm:"foreignKey:RecipeDifficultyID"`
 
+	// Rating is the average rating of the recipe servings, RatingCount is the number of rated servings
 	Rating      float64 `gorm:"default:0.0"`
 	RatingCount uint    `gorm:"default:0"`
 
+	Tags []TagV1 `gorm:"many2many:recipe_v1_tags"`
+
+	Nutrition *RecipeNutritionV1 `gorm:"foreignKey:RecipeV1ID"`
+	Steps     []RecipeStepV1     `gorm:"foreignKey:RecipeV1ID"`
+
+	// SyncFailures counts syncs failed in a row, the recipe is skipped by the sync when there are too many
+	SyncFailures uint   `gorm:"not null;default:0"`
+	SyncError    string `gorm:"type:varchar(4000)"`
+
 	Servings []ServingV1 `gorm:"foreignKey:RecipeID"`
 
 	CreatedAt time.Time
 	UpdatedAt sql.NullTime
 }
 
+// MaxDescriptionLength is the size of the recipe description column
+const MaxDescriptionLength = 4000
+
+// TruncateText cuts the text to the max length in runes, so a multibyte character is never split
+func TruncateText(text string, maxLength int) string {
+	if utf8.RuneCountInString(text) <= maxLength {
+		return text
+	}
+	return string([]rune(text)[:maxLength])
+}
+
+// RecipeNutritionV1 is the nutrition of a recipe per serving, values not found in the recipe are not set
+type RecipeNutritionV1 struct {
+	RecipeV1ID uint `gorm:"primaryKey;autoIncrement:false"`
+
+	Calories sql.NullFloat64
+	Carbs    sql.NullFloat64
+	Protein  sql.NullFloat64
+	Fat      sql.NullFloat64
+	Fibre    sql.NullFloat64
+	Sugar    sql.NullFloat64
+	Salt     sql.NullFloat64
+}
+
+// RecipeStepV1 is an instruction step of a recipe, steps are cooked in the order of their position
+type RecipeStepV1 struct {
+	ID uint `gorm:"primaryKey;autoIncrement"`
+
+	RecipeV1ID uint   `gorm:"not null;index"`
+	Position   uint   `gorm:"not null"`
+	Text       string `gorm:"type:varchar(4000);not null"`
+	// TimerInSeconds is set for steps taking some time, e.g. "simmer for 15 minutes"
+	TimerInSeconds sql.NullInt64
+
+	// Ingredients are ingredients of the recipe used in the step
+	Ingredients []RecipeStepIngredientV1 `gorm:"foreignKey:RecipeStepV1ID"`
+}
+
+// RecipeStepIngredientV1 links an ingredient to the recipe step it's used in
+type RecipeStepIngredientV1 struct {
+	RecipeStepV1ID uint         `gorm:"primaryKey;autoIncrement:false"`
+	IngredientV1ID uint         `gorm:"primaryKey;autoIncrement:false"`
+	Ingredient     IngredientV1 `gorm:"foreignKey:IngredientV1ID"`
+}
+
+// TagV1 is a label of recipes like "vegetarian" or "quick", tag names are lower case
+type TagV1 struct {
+	ID uint `gorm:"primaryKey;autoIncrement"`
+
+	Name string `gorm:"type:varchar(255);unique;not null"`
+
+	CreatedAt time.Time
+}
+
 type RecipeDifficultyV1 struct {
 	ID uint `gorm:"primaryKey;autoIncrement"`
 
@@ -100,28 +422,75 @@ type IngredientV1 struct {
 	UnitID uint   `gorm:"not null"`
 	Unit   UnitV1 `gorm:"foreignKey:UnitID"`
 
+	// Density in grams per millilitre overrides volume to mass conversion of the ingredient
+	Density sql.NullFloat64
+
 	CreatedAt time.Time
 	UpdatedAt sql.NullTime
 }
 
+type UnitDimension string
+
+const (
+	UnitDimensionUnknown UnitDimension = ""
+	UnitDimensionMass    UnitDimension = "mass"
+	UnitDimensionVolume  UnitDimension = "volume"
+	UnitDimensionCount   UnitDimension = "count"
+)
+
 type UnitV1 struct {
 	ID uint `gorm:"primaryKey;autoIncrement"`
 
 	Name string `gorm:"type:varchar(255);unique;not null"`
 
+	// Dimension tells which units are comparable, Factor is the amount of the dimension base unit
+	// (gram, millilitre, piece) in one unit, units of unknown dimension convert only to themselves
+	Dimension UnitDimension `gorm:"type:varchar(16);not null;default:''"`
+	Factor    float64       `gorm:"not null;default:1"`
+
+	Aliases     []UnitAliasV1  `gorm:"foreignKey:UnitV1ID"`
 	Ingredients []IngredientV1 `gorm:"foreignKey:UnitID"`
 
 	CreatedAt time.Time
 	UpdatedAt sql.NullTime
 }
 
+// UnitAliasV1 is an alternative name of a unit, e.g. "gram" for "g"
+type UnitAliasV1 struct {
+	ID uint `gorm:"primaryKey;autoIncrement"`
+
+	Name string `gorm:"type:varchar(255);unique;not null"`
+
+	UnitV1ID uint `gorm:"index;not null"`
+
+	CreatedAt time.Time
+}
+
 type PantryV1 struct {
-	IngredientV1ID uint
+	IngredientV1ID uint         `gorm:"primaryKey;autoIncrement:false"`
 	Ingredient     IngredientV1 `gorm:"foreignKey:IngredientV1ID"`
 
 	Amount float64
 }
 
+// PantryDeductionV1 records stock taken from the pantry by a cooked serving, so cooking can be undone
+type PantryDeductionV1 struct {
+	ID uint `gorm:"primaryKey;autoIncrement"`
+
+	ServingV1ID uint `gorm:"index;not null"`
+
+	IngredientV1ID uint
+	Ingredient     IngredientV1 `gorm:"foreignKey:IngredientV1ID"`
+
+	// Amount is required by the recipe, Deducted is actually taken from the pantry
+	// and Shortage flags the part missing in the pantry instead of storing negative stock
+	Amount   float64
+	Deducted float64
+	Shortage float64
+
+	CreatedAt time.Time
+}
+
 type RecipeV1IngredientV1 struct {
 	ID uint `gorm:"primaryKey;autoIncrement"`
 
@@ -132,4 +501,15 @@ type RecipeV1IngredientV1 struct {
 	Ingredient     IngredientV1 `gorm:"foreignKey:IngredientV1ID"`
 
 	Amount float64
+	// UnitID is the unit of the amount, empty means the ingredient unit
+	UnitID *uint
+	Unit   *UnitV1 `gorm:"foreignKey:UnitID"`
+}
+
+// ShoppingCheckV1 keeps an ingredient checked off on the shopping list
+type ShoppingCheckV1 struct {
+	IngredientV1ID uint         `gorm:"primaryKey;autoIncrement:false"`
+	Ingredient     IngredientV1 `gorm:"foreignKey:IngredientV1ID"`
+
+	CheckedAt time.Time
 }
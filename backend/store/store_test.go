@@ -0,0 +1,26 @@
+package store
+
+import "testing"
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		maxLength int
+		want      string
+	}{
+		{name: "shorter", text: "soup", maxLength: 10, want: "soup"},
+		{name: "exact", text: "soup", maxLength: 4, want: "soup"},
+		{name: "longer", text: "tomato soup", maxLength: 6, want: "tomato"},
+		{name: "multibyte", text: "crème brûlée", maxLength: 4, want: "crèm"},
+		{name: "empty", text: "", maxLength: 4, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TruncateText(tt.text, tt.maxLength); got != tt.want {
+				t.Errorf("TruncateText(%q, %d) = %q, want %q", tt.text, tt.maxLength, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package worker
+
+import "context"
+
+// Extractor backends
+const (
+	// ExtractorHTTP sends recipe pdf files to the pdf reader service
+	ExtractorHTTP = "http"
+	// ExtractorLocal reads the text of recipe pdf files without any external service
+	ExtractorLocal = "local"
+)
+
+// Extractor reads recipe details from a recipe pdf
+type Extractor interface {
+	Extract(ctx context.Context, pdfPath string) (*RecipeJSON, error)
+}
+
+// newExtractor makes the extractor backend of the settings, the pdf reader service is the default
+func newExtractor(settings Settings) Extractor {
+	if settings.Extractor == ExtractorLocal {
+		return newLocalExtractor()
+	}
+
+	return newPdfReaderClient(settings)
+}
@@ -0,0 +1,106 @@
+package worker
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/rjxby/eat-repeat/backend/pantry"
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// replaceIngredients matches ingredient lines of the synced recipe to the ingredients by name and replaces
+// the recipe lines with them, unknown ingredients are created in the unit of their line
+func replaceIngredients(p *WorkerProc, catalogue *pantry.Catalogue, recipe *store.RecipeV1) error {
+	ingredients, err := p.engine.GetIngredients()
+	if err != nil {
+		return err
+	}
+
+	ingredientsByName := make(map[string]store.IngredientV1)
+	for _, ingredient := range ingredients.Ingredients {
+		ingredientsByName[strings.ToLower(ingredient.Name)] = ingredient
+	}
+
+	lines := []store.RecipeV1IngredientV1{}
+	for _, line := range recipe.Ingredients {
+		ingredient, ok := ingredientsByName[strings.ToLower(line.Ingredient.Name)]
+		if !ok {
+			unit := lineUnit(catalogue, line)
+			ingredient = store.IngredientV1{Name: line.Ingredient.Name, UnitID: unit.ID, Unit: unit, CreatedAt: time.Now().UTC()}
+			ingredientsByName[strings.ToLower(ingredient.Name)] = ingredient
+		}
+
+		line.IngredientV1ID = ingredient.ID
+		line.Ingredient = ingredient
+
+		// a line without unit counts pieces, e.g. "2 tomatoes" of tomatoes kept in grams
+		unitless := line.Unit == nil
+		if unitless && ingredient.Unit.Name != pantry.CountUnit {
+			unit := lineUnit(catalogue, line)
+			line.Unit = &unit
+		}
+
+		if line.Unit != nil && line.Unit.Name != ingredient.Unit.Name {
+			// the pantry keeps the ingredient in its unit, so the line must convert to it
+			if _, err := catalogue.ConvertToIngredientUnit(1, line.Unit.Name, ingredient); err != nil {
+				if unitless {
+					log.Printf("[WARN] skip ingredient line of recipe (ID: %d) %v %s without unit, %s is kept in %s: %v",
+						recipe.ID, line.Amount, ingredient.Name, ingredient.Name, ingredient.Unit.Name, err)
+					continue
+				}
+				log.Printf("[WARN] skip ingredient line of recipe (ID: %d) %v %s %s: %v",
+					recipe.ID, line.Amount, line.Unit.Name, ingredient.Name, err)
+				continue
+			}
+			line.UnitID = &line.Unit.ID
+		} else {
+			line.Unit = nil
+			line.UnitID = nil
+		}
+
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		if len(recipe.Ingredients) > 0 {
+			log.Printf("[WARN] no ingredient line of recipe (ID: %d) is kept, its ingredient lines are not replaced", recipe.ID)
+		}
+		return nil
+	}
+
+	return p.engine.ReplaceRecipeIngredients(recipe.ID, lines)
+}
+
+// replaceSteps replaces steps of the synced recipe, the steps are linked to the ingredients of the recipe they mention
+func replaceSteps(p *WorkerProc, recipe *store.RecipeV1) error {
+	saved, err := p.engine.GetRecipe(recipe.ID)
+	if err != nil {
+		return err
+	}
+
+	ingredients := []store.IngredientV1{}
+	for _, line := range saved.Ingredients {
+		ingredients = append(ingredients, line.Ingredient)
+	}
+
+	steps := []store.RecipeStepV1{}
+	for _, step := range recipe.Steps {
+		steps = append(steps, pantry.ParseStep(step.Text, ingredients))
+	}
+
+	return p.engine.ReplaceRecipeSteps(recipe.ID, steps)
+}
+
+// lineUnit is the unit a new ingredient of the line is measured in, the count unit is created when it's missing
+func lineUnit(catalogue *pantry.Catalogue, line store.RecipeV1IngredientV1) store.UnitV1 {
+	if line.Unit != nil {
+		return *line.Unit
+	}
+
+	if unit, ok := catalogue.Lookup(pantry.CountUnit); ok {
+		return unit
+	}
+
+	return store.UnitV1{Name: pantry.CountUnit, Dimension: store.UnitDimensionCount, Factor: 1}
+}
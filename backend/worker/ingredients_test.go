@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rjxby/eat-repeat/backend/pantry"
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+func TestReplaceIngredients(t *testing.T) {
+	engine := newFakeEngine(nil)
+	units, _ := engine.GetUnits()
+	catalogue := pantry.NewCatalogue(*units)
+	unit := func(name string) *store.UnitV1 {
+		found, ok := catalogue.Lookup(name)
+		if !ok {
+			t.Fatalf("unit %s is not in the catalogue", name)
+		}
+		return &found
+	}
+	line := func(amount float64, unit *store.UnitV1, name string) store.RecipeV1IngredientV1 {
+		return store.RecipeV1IngredientV1{Amount: amount, Unit: unit, Ingredient: store.IngredientV1{Name: name}}
+	}
+
+	g, pcs := unit("g"), unit("pcs")
+	engine.ingredients = []store.IngredientV1{{ID: 1, Name: "flour", UnitID: g.ID, Unit: *g},
+		{ID: 2, Name: "eggs", UnitID: pcs.ID, Unit: *pcs}, {ID: 3, Name: "tomatoes", UnitID: g.ID, Unit: *g}}
+
+	tests := []struct {
+		name  string
+		lines []store.RecipeV1IngredientV1
+		// kept are the ingredients of the replaced lines, nil when the lines are not replaced
+		kept []string
+		// warnings are the parts of the logged warnings of skipped lines
+		warnings []string
+	}{
+		{
+			name:  "lines that convert to the ingredient unit",
+			lines: []store.RecipeV1IngredientV1{line(0.5, unit("kg"), "Flour"), line(2, nil, "eggs"), line(200, g, "flour")},
+			kept:  []string{"flour", "eggs", "flour"},
+		},
+		{
+			name:  "unknown ingredients are created",
+			lines: []store.RecipeV1IngredientV1{line(1, unit("cup"), "milk"), line(2, nil, "lemons")},
+			kept:  []string{"milk", "lemons"},
+		},
+		{
+			name:     "unitless line of ingredient kept in another unit",
+			lines:    []store.RecipeV1IngredientV1{line(200, g, "flour"), line(2, nil, "tomatoes")},
+			kept:     []string{"flour"},
+			warnings: []string{"2 tomatoes without unit, tomatoes is kept in g"},
+		},
+		{
+			name:     "line that doesn't convert to the ingredient unit",
+			lines:    []store.RecipeV1IngredientV1{line(1, unit("cup"), "flour"), line(2, nil, "eggs")},
+			kept:     []string{"eggs"},
+			warnings: []string{"1 cup flour"},
+		},
+		{
+			name:     "no line is kept",
+			lines:    []store.RecipeV1IngredientV1{line(3, nil, "tomatoes")},
+			warnings: []string{"3 tomatoes without unit", "no ingredient line of recipe (ID: 1) is kept"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delete(engine.lines, 1)
+
+			var logged bytes.Buffer
+			log.SetOutput(&logged)
+			defer log.SetOutput(os.Stderr)
+
+			if err := replaceIngredients(&WorkerProc{engine: engine}, catalogue, &store.RecipeV1{ID: 1, Ingredients: tt.lines}); err != nil {
+				t.Fatal(err)
+			}
+
+			lines, replaced := engine.lines[1]
+			if replaced != (tt.kept != nil) {
+				t.Fatalf("lines replaced = %v, want %v", replaced, tt.kept != nil)
+			}
+
+			kept := []string{}
+			for _, line := range lines {
+				kept = append(kept, strings.ToLower(line.Ingredient.Name))
+			}
+			if tt.kept != nil && strings.Join(kept, ",") != strings.Join(tt.kept, ",") {
+				t.Errorf("kept = %v, want %v", kept, tt.kept)
+			}
+
+			for _, warning := range tt.warnings {
+				if !strings.Contains(logged.String(), "[WARN]") || !strings.Contains(logged.String(), warning) {
+					t.Errorf("log = %q, want a warning of %q", logged.String(), warning)
+				}
+			}
+			if tt.warnings == nil && logged.Len() > 0 {
+				t.Errorf("log = %q, want no warning", logged.String())
+			}
+		})
+	}
+}
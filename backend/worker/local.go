@@ -0,0 +1,241 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+
+	"github.com/rjxby/eat-repeat/backend/pantry"
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+var (
+	// recipe time like "Cooking time: 1 h 20 min", the minutes or the hours may be missing
+	timeRegexp     = regexp.MustCompile(`(?i)\b(prep(?:aration)?|cook(?:ing)?|total)(?:\s+time)?\s*[:\-]?\s*((?:\d+\s*(?:hours?|hrs?|h)\b\s*)?(?:\d+\s*(?:minutes?|mins?|m)\b)?)`)
+	durationRegexp = regexp.MustCompile(`(?i)(\d+)\s*(hours?|hrs?|h|minutes?|mins?|m)\b`)
+
+	ingredientsHeadingRegexp  = regexp.MustCompile(`(?i)^ingredients?\s*:?$`)
+	instructionsHeadingRegexp = regexp.MustCompile(`(?i)^(instructions?|method|directions?|preparation|steps)\s*:?$`)
+	sectionHeadingRegexp      = regexp.MustCompile(`(?i)^(nutrition|notes?|tips?)\s*:?$`)
+	// numbered instruction step like "1.", "2)" or "Step 3:"
+	stepNumberRegexp = regexp.MustCompile(`(?i)^(?:step\s*)?\d+\s*[.):]\s*`)
+	bulletRegexp     = regexp.MustCompile(`^[•·*\-–]\s*`)
+
+	// unitCatalogue is the catalogue the units of ingredient lines without an ingredients heading are found in
+	unitCatalogue = pantry.NewCatalogue(store.DefaultUnits())
+)
+
+// localExtractor is the extractor reading the text of recipe pdf files, it finds the title, the description,
+// times, ingredient lines and instructions by the recipe layout usual for recipe cards
+type localExtractor struct{}
+
+func newLocalExtractor() *localExtractor {
+	return &localExtractor{}
+}
+
+// Extract reads the text of the pdf file and parses the recipe of it
+func (e *localExtractor) Extract(ctx context.Context, pdfPath string) (*RecipeJSON, error) {
+	lines, err := readPdfLines(ctx, pdfPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no text in pdf %s", pdfPath)
+	}
+
+	return parseRecipeText(lines), nil
+}
+
+// readPdfLines reads text rows of all pages top to bottom
+func readPdfLines(ctx context.Context, pdfPath string) (lines []string, err error) {
+	file, reader, err := pdf.Open(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// the pdf library panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to read pdf %s: %v", pdfPath, r)
+		}
+	}()
+
+	for i := 1; i <= reader.NumPage(); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		for _, row := range textRows(page.Content().Text) {
+			if line := joinRow(row); line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	return lines, nil
+}
+
+// textRows groups glyphs by their baseline top to bottom, glyphs of a row keep the order
+// they are drawn in, standard fonts have no glyph widths, so their positions can't order them
+func textRows(texts []pdf.Text) [][]pdf.Text {
+	rows := map[int][]pdf.Text{}
+	positions := []int{}
+	for _, text := range texts {
+		position := int(math.Round(text.Y))
+		if _, ok := rows[position]; !ok {
+			positions = append(positions, position)
+		}
+		rows[position] = append(rows[position], text)
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(positions)))
+
+	result := make([][]pdf.Text, 0, len(positions))
+	for _, position := range positions {
+		result = append(result, rows[position])
+	}
+	return result
+}
+
+// joinRow joins glyphs of a row, a gap wider than a quarter of the font size is a space between words
+func joinRow(texts []pdf.Text) string {
+	var builder strings.Builder
+	for i, text := range texts {
+		if i > 0 {
+			previous := texts[i-1]
+			if previous.W > 0 && text.X-(previous.X+previous.W) > previous.FontSize/4 {
+				builder.WriteString(" ")
+			}
+		}
+		builder.WriteString(text.S)
+	}
+
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
+
+// parseRecipeText parses the recipe of text lines, the first line is the title, the lines before
+// the first section are the description, the ingredients and the instructions are listed under their headings
+func parseRecipeText(lines []string) *RecipeJSON {
+	recipe := RecipeJSON{Ingredients: []string{}}
+
+	var description []string
+	var totalTime uint
+	section := "description"
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if i == 0 {
+			recipe.Title = line
+			continue
+		}
+
+		// steps like "Cook 20 min" are not recipe times
+		if matches := timeRegexp.FindAllStringSubmatch(line, -1); section != "instructions" && hasDuration(matches) {
+			for _, match := range matches {
+				minutes := parseMinutes(match[2])
+				switch strings.ToLower(match[1][:1]) {
+				case "p":
+					recipe.PrepTime = minutes
+				case "c":
+					recipe.CookTime = minutes
+				case "t":
+					totalTime = minutes
+				}
+			}
+			continue
+		}
+
+		switch {
+		case ingredientsHeadingRegexp.MatchString(line):
+			section = "ingredients"
+		case instructionsHeadingRegexp.MatchString(line):
+			section = "instructions"
+		case sectionHeadingRegexp.MatchString(line):
+			section = "other"
+		case section == "instructions":
+			recipe.Instructions = appendInstruction(recipe.Instructions, line)
+		case section == "ingredients":
+			recipe.Ingredients = append(recipe.Ingredients, bulletRegexp.ReplaceAllString(line, ""))
+		case isIngredientLine(bulletRegexp.ReplaceAllString(line, "")):
+			recipe.Ingredients = append(recipe.Ingredients, bulletRegexp.ReplaceAllString(line, ""))
+		case section == "description":
+			description = append(description, line)
+		}
+	}
+
+	if recipe.CookTime == 0 && totalTime > recipe.PrepTime {
+		recipe.CookTime = totalTime - recipe.PrepTime
+	}
+
+	recipe.Description = store.TruncateText(strings.Join(description, " "), store.MaxDescriptionLength)
+
+	return &recipe
+}
+
+// isIngredientLine tells an ingredient line without an ingredients heading, it starts with an amount
+// and a unit of the catalogue, e.g. "200 g flour" or "2 tablespoons oil"
+func isIngredientLine(line string) bool {
+	draft, err := pantry.ParseIngredientLine(unitCatalogue, line)
+	return err == nil && draft.Amount > 0 && draft.Unit != ""
+}
+
+// appendInstruction adds a line of the instructions section, a numbered line or a line after a finished
+// sentence starts a new step, other lines are the rest of a step wrapped in the pdf
+func appendInstruction(steps []string, line string) []string {
+	if stepNumberRegexp.MatchString(line) {
+		if step := stepNumberRegexp.ReplaceAllString(line, ""); step != "" {
+			return append(steps, step)
+		}
+		return steps
+	}
+
+	line = bulletRegexp.ReplaceAllString(line, "")
+	if len(steps) == 0 || strings.HasSuffix(steps[len(steps)-1], ".") {
+		return append(steps, line)
+	}
+
+	steps[len(steps)-1] += " " + line
+	return steps
+}
+
+func hasDuration(matches [][]string) bool {
+	for _, match := range matches {
+		if strings.TrimSpace(match[2]) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMinutes sums hours and minutes of a duration like "1 h 20 min"
+func parseMinutes(duration string) uint {
+	var minutes uint
+	for _, match := range durationRegexp.FindAllStringSubmatch(duration, -1) {
+		value, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil {
+			continue
+		}
+
+		if strings.HasPrefix(strings.ToLower(match[2]), "h") {
+			value *= 60
+		}
+		minutes += uint(value)
+	}
+	return minutes
+}
@@ -0,0 +1,164 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestPdf writes a single page pdf with a text line per row
+func writeTestPdf(t *testing.T, lines []string) string {
+	t.Helper()
+
+	var content strings.Builder
+	content.WriteString("BT /F1 12 Tf 50 800 Td\n")
+	for _, line := range lines {
+		escaped := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(line)
+		fmt.Fprintf(&content, "(%s) Tj 0 -14 Td\n", escaped)
+	}
+	content.WriteString("ET")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+	}
+
+	var file bytes.Buffer
+	file.WriteString("%PDF-1.4\n")
+	offsets := []int{}
+	for i, object := range objects {
+		offsets = append(offsets, file.Len())
+		fmt.Fprintf(&file, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := file.Len()
+	fmt.Fprintf(&file, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&file, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&file, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	path := filepath.Join(t.TempDir(), "recipe.pdf")
+	if err := os.WriteFile(path, file.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLocalExtractorReadsPdf(t *testing.T) {
+	path := writeTestPdf(t, []string{
+		"Creamy Tomato Pasta",
+		"A quick weeknight dinner.",
+		"Prep time: 10 min",
+		"Cook time: 1 h 5 min",
+		"Ingredients",
+		"200 g pasta",
+		"- 2 tomatoes",
+		"Method",
+		"1. Boil the pasta",
+		"for 10 min.",
+		"2. Cook 20 min with tomatoes.",
+	})
+
+	recipe, err := newLocalExtractor().Extract(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &RecipeJSON{
+		Title:        "Creamy Tomato Pasta",
+		Description:  "A quick weeknight dinner.",
+		PrepTime:     10,
+		CookTime:     65,
+		Ingredients:  []string{"200 g pasta", "2 tomatoes"},
+		Instructions: []string{"Boil the pasta for 10 min.", "Cook 20 min with tomatoes."},
+	}
+	if !reflect.DeepEqual(recipe, want) {
+		t.Errorf("recipe = %+v, want %+v", recipe, want)
+	}
+}
+
+func TestLocalExtractorFailsOnInvalidPdf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.4 broken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newLocalExtractor().Extract(context.Background(), path); err == nil {
+		t.Error("no error for a broken pdf")
+	}
+}
+
+func TestParseRecipeText(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  RecipeJSON
+	}{
+		{
+			name:  "title only",
+			lines: []string{"Omelette"},
+			want:  RecipeJSON{Title: "Omelette", Ingredients: []string{}},
+		},
+		{
+			name:  "total time without cooking time",
+			lines: []string{"Soup", "Preparation: 15 minutes", "Total time: 45 mins"},
+			want:  RecipeJSON{Title: "Soup", PrepTime: 15, CookTime: 30, Ingredients: []string{}},
+		},
+		{
+			name:  "times in a single line",
+			lines: []string{"Stew", "Prep 20 min • Cook 2 hours"},
+			want:  RecipeJSON{Title: "Stew", PrepTime: 20, CookTime: 120, Ingredients: []string{}},
+		},
+		{
+			name:  "ingredient lines without heading",
+			lines: []string{"Pancakes", "Fluffy and light.", "• 250 ml milk", "1 tbsp sugar", "Mix everything."},
+			want: RecipeJSON{
+				Title:       "Pancakes",
+				Description: "Fluffy and light. Mix everything.",
+				Ingredients: []string{"250 ml milk", "1 tbsp sugar"},
+			},
+		},
+		{
+			name: "ingredient lines of unit aliases",
+			lines: []string{"Vinaigrette", "Sharp and fresh.", "2 tablespoons vinegar", "1 dl olive oil", "5 cl lemon juice",
+				"1/2 teaspoon salt", "3 cloves garlic", "2 tomatoes", "Shake well."},
+			want: RecipeJSON{
+				Title:       "Vinaigrette",
+				Description: "Sharp and fresh. 3 cloves garlic 2 tomatoes Shake well.",
+				Ingredients: []string{"2 tablespoons vinegar", "1 dl olive oil", "5 cl lemon juice", "1/2 teaspoon salt"},
+			},
+		},
+		{
+			name:  "unnumbered instructions",
+			lines: []string{"Toast", "Directions:", "Toast the bread.", "• Spread the butter", "while warm.", "Notes", "Best fresh."},
+			want: RecipeJSON{
+				Title:        "Toast",
+				Ingredients:  []string{},
+				Instructions: []string{"Toast the bread.", "Spread the butter while warm."},
+			},
+		},
+		{
+			name:  "instruction mentioning cooking is not a time",
+			lines: []string{"Rice", "Cook the rice until soft."},
+			want:  RecipeJSON{Title: "Rice", Description: "Cook the rice until soft.", Ingredients: []string{}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseRecipeText(test.lines)
+			if !reflect.DeepEqual(*got, test.want) {
+				t.Errorf("parseRecipeText() = %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// pdfReaderClient is the extractor sending recipe pdf files to the pdf reader service, requests failed
+// by the network, a 5xx or a 429 status are retried with exponential backoff
+type pdfReaderClient struct {
+	endpoint   string
+	client     *http.Client
+	maxRetries int
+	// retryDelay is the delay before the first retry, it doubles with every next one
+	retryDelay time.Duration
+}
+
+// statusError is a response of the pdf reader with unexpected status
+type statusError struct {
+	statusCode int
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.statusCode)
+}
+
+func newPdfReaderClient(settings Settings) *pdfReaderClient {
+	return &pdfReaderClient{
+		endpoint:   settings.PdfReaderEndpoint,
+		client:     &http.Client{Timeout: time.Duration(settings.RequestTimeoutInSeconds) * time.Second},
+		maxRetries: settings.MaxRetries,
+		retryDelay: time.Second,
+	}
+}
+
+// Extract sends the pdf file to the pdf reader and returns the recipe details it has found
+func (c *pdfReaderClient) Extract(ctx context.Context, pdfPath string) (*RecipeJSON, error) {
+	file, err := os.Open(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	body, contentType, err := createMultipartRequestBody(file, pdfPath)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, err := c.send(ctx, body.Bytes(), contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	return processResponse(responseBody)
+}
+
+// send posts the body until it succeeds, fails with a final error or runs out of retries
+func (c *pdfReaderClient) send(ctx context.Context, body []byte, contentType string) ([]byte, error) {
+	delay := c.retryDelay
+	for attempt := 0; ; attempt++ {
+		responseBody, err := c.sendPostRequest(ctx, body, contentType)
+		if err == nil {
+			return responseBody, nil
+		}
+
+		if attempt >= c.maxRetries || !isRetryable(ctx, err) {
+			return nil, err
+		}
+
+		wait := delay
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.retryAfter > wait {
+			wait = statusErr.retryAfter
+		}
+
+		log.Printf("[WARN] pdf reader request failed, retry %d of %d in %s: %v", attempt+1, c.maxRetries, wait, err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+
+		delay *= 2
+	}
+}
+
+// isRetryable reports whether the request may succeed later, requests of a stopped job are never retried
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode >= http.StatusInternalServerError || statusErr.statusCode == http.StatusTooManyRequests
+	}
+
+	// the rest are network errors and timeouts of the request
+	return true
+}
+
+func (c *pdfReaderClient) sendPostRequest(ctx context.Context, body []byte, contentType string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", contentType)
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		// the body is drained, so the connection is reused by the retry
+		_, _ = io.Copy(io.Discard, response.Body)
+		return nil, &statusError{statusCode: response.StatusCode, retryAfter: parseRetryAfter(response.Header.Get("Retry-After"))}
+	}
+
+	return io.ReadAll(response.Body)
+}
+
+// parseRetryAfter reads the Retry-After header in seconds, the date form is ignored
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+func createMultipartRequestBody(file *os.File, fileName string) (*bytes.Buffer, string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	fileField, err := writer.CreateFormFile("file", filepath.Base(fileName))
+	if err != nil {
+		log.Print("[ERROR] failed to create form file")
+		return nil, "", err
+	}
+
+	_, err = io.Copy(fileField, file)
+	if err != nil {
+		log.Print("[ERROR] failed to copy file content")
+		return nil, "", err
+	}
+
+	contentType := writer.FormDataContentType()
+	writer.Close()
+	return body, contentType, nil
+}
+
+func processResponse(responseBody []byte) (*RecipeJSON, error) {
+	var recipeDetails RecipeJSON
+	err := json.Unmarshal(responseBody, &recipeDetails)
+	if err != nil {
+		log.Print("[ERROR] failed to unmarshal JSON")
+		return nil, err
+	}
+
+	return &recipeDetails, nil
+}
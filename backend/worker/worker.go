@@ -1,66 +1,170 @@
 package worker
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
 	"database/sql"
-	"encoding/json"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"math"
-	"mime/multipart"
-	"net/http"
 	"os"
-	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/rjxby/eat-repeat/backend/pantry"
 	"github.com/rjxby/eat-repeat/backend/store"
 )
 
 // Error messages
 var (
 	ErrUpdateJobStatus = fmt.Errorf("failed to update job status")
+	ErrJobNotRunning   = fmt.Errorf("job is not running: %w", store.ErrConflict)
 )
 
 // WorkerProc runs jobs
 type WorkerProc struct {
-	pdfReaderEndpoint      string
-	workerTimeoutInSeconds int64
-	engine                 Engine
+	ctx       context.Context
+	settings  Settings
+	engine    Engine
+	extractor Extractor
+
+	mu      sync.Mutex
+	running map[uint]*runningJob
+}
+
+// Settings of the sync jobs
+type Settings struct {
+	// Extractor is the backend reading recipe pdf files, ExtractorHTTP or ExtractorLocal
+	Extractor         string
+	PdfReaderEndpoint string
+	// TimeoutInSeconds limits the whole job
+	TimeoutInSeconds int64
+	// Concurrency is the max number of requests to the pdf reader in flight
+	Concurrency int
+	// RateLimitPerSecond is the max number of requests started per second, zero means no limit
+	RateLimitPerSecond float64
+	// RequestTimeoutInSeconds limits a single request to the pdf reader
+	RequestTimeoutInSeconds int64
+	// MaxRetries is the number of retries of a failed request to the pdf reader
+	MaxRetries int
+	// MaxFailures is the number of failed syncs after which a recipe is skipped until its failures are reset
+	MaxFailures uint
+}
+
+// runningJob cancels a job in progress, done is closed when the job and its requests are finished
+type runningJob struct {
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
-// New creates WorkerProc
-func New(pdfReaderEndpoint string, workerTimeoutInSeconds int64, engine Engine) *WorkerProc {
+// New creates WorkerProc, jobs are stopped when the context is done
+func New(ctx context.Context, settings Settings, engine Engine) *WorkerProc {
+	if settings.Concurrency < 1 {
+		settings.Concurrency = 1
+	}
+
 	return &WorkerProc{
-		pdfReaderEndpoint:      pdfReaderEndpoint,
-		workerTimeoutInSeconds: workerTimeoutInSeconds,
-		engine:                 engine,
+		ctx:       ctx,
+		settings:  settings,
+		engine:    engine,
+		extractor: newExtractor(settings),
+		running:   make(map[uint]*runningJob),
 	}
 }
 
-// Engine defines an interface to save and load recipes
+// Engine defines an interface to save and load recipes and sync jobs
 type Engine interface {
 	SaveSyncJob(job *store.JobV1) (*store.JobV1, error)
-	LoadRecipes(page, pageSize int, searchTerm string) (*store.Recipes, error)
-	SaveRecipe(recipe *store.RecipeV1) (*store.RecipeV1, error)
+	SaveJobItem(item *store.JobItemV1) error
+	LoadJobs() (*[]store.JobV1, error)
+	GetJob(id uint) (*store.JobV1, error)
+	LoadSyncRecipes() (*[]store.RecipeV1, error)
+	GetRecipe(id uint) (*store.RecipeV1, error)
+	SaveSyncedRecipe(recipe *store.RecipeV1) (*store.RecipeV1, error)
+	SaveRecipeNutrition(nutrition *store.RecipeNutritionV1) error
+	DeleteRecipeNutrition(recipeID uint) error
+	ReplaceRecipeIngredients(recipeID uint, lines []store.RecipeV1IngredientV1) error
+	ReplaceRecipeSteps(recipeID uint, steps []store.RecipeStepV1) error
+	GetIngredients() (*store.Ingredients, error)
+	GetUnits() (*[]store.UnitV1, error)
+	RecordRecipeSyncFailure(id uint, syncError string) error
+	ResetRecipeSyncFailures(id uint) error
 }
 
+// RecipeJSON is the recipe found by an extractor, it's the response of the pdf reader service
 type RecipeJSON struct {
 	Title       string        `json:"title"`
 	SubTitle    string        `json:"sub_title"`
 	Description string        `json:"description"`
+	PrepTime    uint          `json:"prep_time"`
 	CookTime    uint          `json:"cook_time"`
 	Nutrition   NutritionJSON `json:"nutrition_info"`
+	// Ingredients are ingredient lines as they are written in the recipe, e.g. "200 g flour"
+	Ingredients []string `json:"ingredients"`
+	// Instructions are the recipe steps in the order they are cooked
+	Instructions []string `json:"instructions"`
 }
 
+// NutritionJSON is the nutrition per serving, values missing in the recipe are not set
 type NutritionJSON struct {
-	Calories uint `json:"calories_per_serving"`
-	Carbs    uint `json:"net_carbs_per_serving"`
+	Calories *float64 `json:"calories_per_serving"`
+	Carbs    *float64 `json:"net_carbs_per_serving"`
+	Protein  *float64 `json:"protein_per_serving"`
+	Fat      *float64 `json:"fat_per_serving"`
+	Fibre    *float64 `json:"fibre_per_serving"`
+	Sugar    *float64 `json:"sugar_per_serving"`
+	Salt     *float64 `json:"salt_per_serving"`
+}
+
+// recipeResult is the outcome of a recipe sync, a skipped recipe has the reason
+type recipeResult struct {
+	recipe  store.RecipeV1
+	updated *store.RecipeV1
+	skipped string
+	err     error
+	// interrupted is set when the job has stopped during the sync, it's not a failure of the recipe
+	interrupted bool
+}
+
+// RunSyncRecipes runs the synchronization of recipes, the job fails when it takes longer than the worker timeout,
+// recipes with unchanged pdf are skipped unless the sync is forced
+func (p *WorkerProc) RunSyncRecipes(force bool) (*store.JobV1, error) {
+	return p.runJob(func() ([]store.RecipeV1, error) {
+		recipes, err := p.engine.LoadSyncRecipes()
+		if err != nil {
+			return nil, err
+		}
+		return *recipes, nil
+	}, force)
 }
 
-// RunSyncRecipes runs the synchronization of recipes
-func (p *WorkerProc) RunSyncRecipes() (*store.JobV1, error) {
+// RunSyncRecipe runs the synchronization of a single recipe, its pdf is read even when unchanged
+// or failed too many times, the failures of the recipe are reset
+func (p *WorkerProc) RunSyncRecipe(id uint) (*store.JobV1, error) {
+	recipe, err := p.engine.GetRecipe(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if recipe.SyncFailures > 0 {
+		if err := p.engine.ResetRecipeSyncFailures(id); err != nil {
+			return nil, err
+		}
+		recipe.SyncFailures = 0
+		recipe.SyncError = ""
+	}
+
+	return p.runJob(func() ([]store.RecipeV1, error) {
+		return []store.RecipeV1{*recipe}, nil
+	}, true)
+}
+
+// runJob saves a new job and syncs the loaded recipes in the background
+func (p *WorkerProc) runJob(load func() ([]store.RecipeV1, error), force bool) (*store.JobV1, error) {
 	job := store.JobV1{
 		Status:    store.JobStatusPending,
 		CreatedAt: time.Now().UTC(),
@@ -71,121 +175,376 @@ func (p *WorkerProc) RunSyncRecipes() (*store.JobV1, error) {
 		return nil, err
 	}
 
-	go runSyncRecipes(p, savedJob)
+	ctx, cancel := context.WithTimeout(p.ctx, time.Duration(p.settings.TimeoutInSeconds)*time.Second)
+	running := &runningJob{cancel: cancel, done: make(chan struct{})}
+
+	p.mu.Lock()
+	p.running[savedJob.ID] = running
+	p.mu.Unlock()
+
+	// the job is copied, so the sync goroutine doesn't share it with the caller
+	syncJob := *savedJob
+	go func() {
+		defer close(running.done)
+		defer cancel()
+		defer p.forget(syncJob.ID)
+
+		runSyncRecipes(ctx, p, &syncJob, load, force)
+	}()
 
 	return savedJob, nil
 }
 
-func runSyncRecipes(p *WorkerProc, job *store.JobV1) {
+// CancelJob cancels a running job and waits until it stops
+func (p *WorkerProc) CancelJob(id uint) (*store.JobV1, error) {
+	p.mu.Lock()
+	running, ok := p.running[id]
+	p.mu.Unlock()
+
+	if !ok {
+		// the job may exist and be finished already
+		if _, err := p.engine.GetJob(id); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("job %d: %w", id, ErrJobNotRunning)
+	}
+
+	running.cancel()
+	<-running.done
+
+	log.Printf("[INFO] job %d is cancelled", id)
+
+	return p.engine.GetJob(id)
+}
+
+// ResetRecipeSyncFailures lets the next syncs read the recipe pdf again
+func (p *WorkerProc) ResetRecipeSyncFailures(id uint) error {
+	return p.engine.ResetRecipeSyncFailures(id)
+}
+
+// GetJobs loads sync jobs without their items, the latest first
+func (p *WorkerProc) GetJobs() (*[]store.JobV1, error) {
+	return p.engine.LoadJobs()
+}
+
+// GetJob loads a sync job with its per recipe items
+func (p *WorkerProc) GetJob(id uint) (*store.JobV1, error) {
+	return p.engine.GetJob(id)
+}
+
+func (p *WorkerProc) forget(id uint) {
+	p.mu.Lock()
+	delete(p.running, id)
+	p.mu.Unlock()
+}
+
+// runSyncRecipes syncs recipes until all of them are done or the context is done,
+// it returns only when requests of the job are finished
+func runSyncRecipes(ctx context.Context, p *WorkerProc, job *store.JobV1, load func() ([]store.RecipeV1, error), force bool) {
 	job.Status = store.JobStatusInProgress
+	job.StartedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
 	if _, err := p.engine.SaveSyncJob(job); err != nil {
 		log.Print(ErrUpdateJobStatus)
 	}
 
-	recipesToSync, err := p.engine.LoadRecipes(math.MaxInt64, math.MaxInt64, "")
+	recipesToSync, err := load()
 	if err != nil {
 		log.Printf("[ERROR] failed to load recipes: %v", err)
 		updateJobStatus(p, job, store.JobStatusFailed)
 		return
 	}
 
-	resultCh := make(chan *store.RecipeV1)
-	errorCh := make(chan error)
+	units, err := p.engine.GetUnits()
+	if err != nil {
+		log.Printf("[ERROR] failed to load units: %v", err)
+		updateJobStatus(p, job, store.JobStatusFailed)
+		return
+	}
+	catalogue := pantry.NewCatalogue(*units)
+
+	// every recipe sends exactly one result, the buffer lets the pool finish when the job stops waiting
+	resultCh := make(chan recipeResult, len(recipesToSync))
 
 	var wg sync.WaitGroup
+	runPool(ctx, p, catalogue, recipesToSync, force, resultCh, &wg)
+	status := collectResults(ctx, p, catalogue, job, len(recipesToSync), resultCh)
 
-	for _, recipe := range recipesToSync.Recipes {
+	// the pool stops with the job context
+	wg.Wait()
+
+	updateJobStatus(p, job, status)
+}
 
-		// give a break to server, it's not a cloud scale set
-		time.Sleep(time.Duration(2000) * time.Millisecond)
+// runPool starts Concurrency workers sending requests to the pdf reader and feeds them with recipes
+// at the rate limit, recipes without pdf, failed too many times or with unchanged pdf are skipped right away
+func runPool(ctx context.Context, p *WorkerProc, catalogue *pantry.Catalogue, recipes []store.RecipeV1, force bool, resultCh chan<- recipeResult, wg *sync.WaitGroup) {
+	recipeCh := make(chan store.RecipeV1)
 
+	for i := 0; i < p.settings.Concurrency && i < len(recipes); i++ {
 		wg.Add(1)
-		go mapRecipeDetails(recipe, p.pdfReaderEndpoint, resultCh, errorCh, &wg)
+		go func() {
+			defer wg.Done()
+			for recipe := range recipeCh {
+				resultCh <- mapRecipeDetails(ctx, p.extractor, catalogue, recipe)
+			}
+		}()
 	}
 
+	wg.Add(1)
 	go func() {
-		wg.Wait()
+		defer wg.Done()
+		defer close(recipeCh)
+
+		var tick <-chan time.Time
+		if p.settings.RateLimitPerSecond > 0 {
+			ticker := time.NewTicker(rateInterval(p.settings.RateLimitPerSecond))
+			defer ticker.Stop()
+			tick = ticker.C
+		}
 
-		close(resultCh)
-		close(errorCh)
+		sent := 0
+		for _, recipe := range recipes {
+			if reason := skipReason(p, recipe); reason != "" {
+				resultCh <- recipeResult{recipe: recipe, skipped: reason}
+				continue
+			}
 
-		updateJobStatus(p, job, store.JobStatusCompleted)
-	}()
+			// the recipe keeps the new pdf state, it's saved when the pdf is read
+			if changed, err := updatePdfState(&recipe); err == nil && !changed && !force {
+				resultCh <- recipeResult{recipe: recipe, skipped: "recipe pdf is unchanged"}
+				continue
+			}
 
-	timeout := time.After(time.Duration(p.workerTimeoutInSeconds) * time.Second)
-	for i := 0; i < len(recipesToSync.Recipes); i++ {
-		select {
-		case result := <-resultCh:
-			if result != nil {
-				if _, err := p.engine.SaveRecipe(result); err != nil {
-					log.Printf("[ERROR] failed to update recipe (ID: %d) %s", result.ID, err)
-					updateJobStatus(p, job, store.JobStatusFailed)
+			// the first request starts right away, the next ones wait for the rate limit
+			if tick != nil && sent > 0 {
+				select {
+				case <-tick:
+				case <-ctx.Done():
+					return
 				}
 			}
-		case err := <-errorCh:
-			log.Printf("[ERROR] failed to process recipe %s", err)
-		case <-timeout:
-			log.Printf("[ERROR] timeout to process batch in %d seconds", p.workerTimeoutInSeconds)
-			updateJobStatus(p, job, store.JobStatusFailed)
-			return
+
+			select {
+			case recipeCh <- recipe:
+				sent++
+			case <-ctx.Done():
+				return
+			}
 		}
-	}
+	}()
 }
 
-func updateJobStatus(p *WorkerProc, jobToUpdate *store.JobV1, status store.JobStatus) {
-	jobToUpdate.Status = status
-	if _, err := p.engine.SaveSyncJob(jobToUpdate); err != nil {
-		log.Print(ErrUpdateJobStatus)
+// rateInterval is the time between requests started at the rate, a rate too high to tick is limited to a tick per nanosecond
+func rateInterval(ratePerSecond float64) time.Duration {
+	interval := float64(time.Second) / ratePerSecond
+	if math.IsNaN(interval) || interval < 1 {
+		return time.Nanosecond
+	}
+	if interval > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
 	}
-}
 
-func mapRecipeDetails(recipe store.RecipeV1, pdfReaderEndpoint string, resultCh chan<- *store.RecipeV1, errorCh chan<- error, wg *sync.WaitGroup) {
-	defer wg.Done()
+	return time.Duration(interval)
+}
 
+// skipReason tells why the recipe is not synced, it's empty for a recipe to sync
+func skipReason(p *WorkerProc, recipe store.RecipeV1) string {
 	if !recipe.PdfUrl.Valid {
-		return
+		return "recipe has no pdf"
 	}
 
-	file, err := os.Open(recipe.PdfUrl.String)
+	if p.settings.MaxFailures > 0 && recipe.SyncFailures >= p.settings.MaxFailures {
+		return fmt.Sprintf("recipe pdf failed %d times, reset the failures to sync it again", recipe.SyncFailures)
+	}
+
+	return ""
+}
+
+// updatePdfState sets the hash and modification time of the recipe pdf, it reports whether the pdf
+// has changed since the last sync, the file is hashed only when its modification time has changed
+func updatePdfState(recipe *store.RecipeV1) (changed bool, err error) {
+	info, err := os.Stat(recipe.PdfUrl.String)
 	if err != nil {
-		log.Printf("[ERROR] failed to open recipe pdf (ID: %d)", recipe.ID)
-		errorCh <- err
-		return
+		return true, err
+	}
+
+	modifiedAt := info.ModTime().UTC()
+	if recipe.PdfHash != "" && recipe.PdfModifiedAt.Valid && recipe.PdfModifiedAt.Time.Equal(modifiedAt) {
+		return false, nil
 	}
-	defer file.Close()
 
-	body, contenType, err := createMultipartRequestBody(file, recipe.PdfUrl.String)
+	hash, err := hashFile(recipe.PdfUrl.String)
 	if err != nil {
-		log.Printf("[ERROR] failed to create request for recipe pdf (ID: %d)", recipe.ID)
-		errorCh <- err
-		return
+		return true, err
 	}
 
-	responseBody, err := sendPostRequest(pdfReaderEndpoint, body, contenType)
+	changed = hash != recipe.PdfHash
+	recipe.PdfHash = hash
+	recipe.PdfModifiedAt = sql.NullTime{Time: modifiedAt, Valid: true}
+
+	return changed, nil
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		log.Printf("[ERROR] failed to send request for recipe pdf (ID: %d)", recipe.ID)
-		errorCh <- err
-		return
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// collectResults records results of the recipes, it returns the status the job ends with
+func collectResults(ctx context.Context, p *WorkerProc, catalogue *pantry.Catalogue, job *store.JobV1, pending int, resultCh <-chan recipeResult) store.JobStatus {
+	for ; pending > 0; pending-- {
+		select {
+		case result := <-resultCh:
+			recordResult(p, catalogue, job, result)
+		case <-ctx.Done():
+			return contextStatus(ctx, p)
+		}
+	}
+
+	return store.JobStatusCompleted
+}
+
+// contextStatus is the status of a job stopped by its context
+func contextStatus(ctx context.Context, p *WorkerProc) store.JobStatus {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Printf("[ERROR] timeout to process batch in %d seconds", p.settings.TimeoutInSeconds)
+		return store.JobStatusFailed
 	}
 
-	recipeDetails, err := processResponse(responseBody)
+	return store.JobStatusCancelled
+}
+
+// recordResult saves the synced recipe and records its outcome as a job item
+func recordResult(p *WorkerProc, catalogue *pantry.Catalogue, job *store.JobV1, result recipeResult) {
+	item := store.JobItemV1{
+		JobV1ID:     job.ID,
+		RecipeID:    result.recipe.ID,
+		RecipeTitle: result.recipe.Title,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	if result.updated != nil && result.updated.Nutrition != nil {
+		if err := p.engine.SaveRecipeNutrition(result.updated.Nutrition); err != nil {
+			log.Printf("[ERROR] failed to update nutrition of recipe (ID: %d) %s", result.recipe.ID, err)
+			result.err = err
+		}
+	}
+
+	// nutrition of an older pdf is stale when the new one has none
+	if result.updated != nil && result.updated.Nutrition == nil {
+		if err := p.engine.DeleteRecipeNutrition(result.recipe.ID); err != nil {
+			log.Printf("[ERROR] failed to delete nutrition of recipe (ID: %d) %s", result.recipe.ID, err)
+			result.err = err
+		}
+	}
+
+	// recipes read without ingredient lines keep the current ones
+	if result.err == nil && result.updated != nil && len(result.updated.Ingredients) > 0 {
+		if err := replaceIngredients(p, catalogue, result.updated); err != nil {
+			log.Printf("[ERROR] failed to update ingredients of recipe (ID: %d) %s", result.recipe.ID, err)
+			result.err = err
+		}
+	}
+
+	// steps are linked to the ingredients, so they are replaced after them
+	if result.err == nil && result.updated != nil && len(result.updated.Steps) > 0 {
+		if err := replaceSteps(p, result.updated); err != nil {
+			log.Printf("[ERROR] failed to update steps of recipe (ID: %d) %s", result.recipe.ID, err)
+			result.err = err
+		}
+	}
+
+	// the recipe keeps the new pdf hash, so it's saved last, a recipe failed to save is read again by the next sync
+	if result.err == nil && result.updated != nil {
+		if _, err := p.engine.SaveSyncedRecipe(result.updated); err != nil {
+			log.Printf("[ERROR] failed to update recipe (ID: %d) %s", result.recipe.ID, err)
+			result.err = err
+		}
+	}
+
+	switch {
+	case result.err != nil:
+		item.Status = store.JobItemStatusFailed
+		item.Error = result.err.Error()
+		job.Failed++
+
+		if !result.interrupted {
+			if err := p.engine.RecordRecipeSyncFailure(result.recipe.ID, item.Error); err != nil {
+				log.Printf("[ERROR] failed to record sync failure of recipe (ID: %d) %s", result.recipe.ID, err)
+			}
+		}
+	case result.skipped != "":
+		item.Status = store.JobItemStatusSkipped
+		item.Error = result.skipped
+		job.Skipped++
+	default:
+		item.Status = store.JobItemStatusProcessed
+		job.Processed++
+	}
+
+	if err := p.engine.SaveJobItem(&item); err != nil {
+		log.Printf("[ERROR] failed to save job item of recipe (ID: %d) %s", result.recipe.ID, err)
+	}
+
+	job.UpdatedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	if _, err := p.engine.SaveSyncJob(job); err != nil {
+		log.Print(ErrUpdateJobStatus)
+	}
+}
+
+// updateJobStatus saves the job status, a completed or failed job is finished
+func updateJobStatus(p *WorkerProc, jobToUpdate *store.JobV1, status store.JobStatus) {
+	now := time.Now().UTC()
+
+	jobToUpdate.Status = status
+	jobToUpdate.UpdatedAt = sql.NullTime{Time: now, Valid: true}
+	if status == store.JobStatusCompleted || status == store.JobStatusFailed || status == store.JobStatusCancelled {
+		jobToUpdate.FinishedAt = sql.NullTime{Time: now, Valid: true}
+	}
+
+	if _, err := p.engine.SaveSyncJob(jobToUpdate); err != nil {
+		log.Print(ErrUpdateJobStatus)
+	}
+}
+
+// mapRecipeDetails extracts the recipe pdf and maps the details to the recipe
+func mapRecipeDetails(ctx context.Context, extractor Extractor, catalogue *pantry.Catalogue, recipe store.RecipeV1) recipeResult {
+	recipeDetails, err := extractor.Extract(ctx, recipe.PdfUrl.String)
 	if err != nil {
-		log.Printf("[ERROR] failed to process response for recipe pdf (ID: %d)", recipe.ID)
-		errorCh <- err
-		return
+		log.Printf("[ERROR] failed to read recipe pdf (ID: %d) %s", recipe.ID, err)
+		return recipeResult{recipe: recipe, err: err, interrupted: ctx.Err() != nil}
 	}
 
-	updateRecipe := mapRecipe(&recipe, recipeDetails)
-	resultCh <- updateRecipe
+	updateRecipe := mapRecipe(&recipe, recipeDetails, catalogue)
+	return recipeResult{recipe: recipe, updated: updateRecipe}
 }
 
-func mapRecipe(destination *store.RecipeV1, source *RecipeJSON) (result *store.RecipeV1) {
+func mapRecipe(destination *store.RecipeV1, source *RecipeJSON, catalogue *pantry.Catalogue) (result *store.RecipeV1) {
 	if source.Title != "" {
 		destination.Title = source.Title
 	}
 
+	destination.SubTitle = source.SubTitle
 	destination.Description = source.Description
 	destination.CookingTimeInMinutes = source.CookTime
+	if source.PrepTime > 0 {
+		destination.PreparationTimeInMinutes = source.PrepTime
+	}
+	destination.Nutrition = mapNutrition(destination.ID, source.Nutrition)
+	destination.Ingredients = mapIngredients(destination.ID, source.Ingredients, catalogue)
+	destination.Steps = mapSteps(source.Instructions)
+	destination.SyncFailures = 0
+	destination.SyncError = ""
 	destination.UpdatedAt = sql.NullTime{
 		Time:  time.Now().UTC(),
 		Valid: true,
@@ -194,56 +553,67 @@ func mapRecipe(destination *store.RecipeV1, source *RecipeJSON) (result *store.R
 	return destination
 }
 
-func createMultipartRequestBody(file *os.File, fileName string) (*bytes.Buffer, string, error) {
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	fileField, err := writer.CreateFormFile("file", filepath.Base(fileName))
-	if err != nil {
-		log.Print("[ERROR] failed to create form file")
-		return nil, "", err
-	}
+// mapIngredients parses ingredient lines of the recipe, the ingredients are matched by name when the lines are saved,
+// lines which can't be parsed are dropped, it's nil when no line is parsed
+func mapIngredients(recipeID uint, source []string, catalogue *pantry.Catalogue) []store.RecipeV1IngredientV1 {
+	var lines []store.RecipeV1IngredientV1
+	for _, text := range source {
+		draft, err := pantry.ParseIngredientLine(catalogue, text)
+		if err != nil {
+			log.Printf("[WARN] skip ingredient line of recipe (ID: %d) %s", recipeID, err)
+			continue
+		}
 
-	_, err = io.Copy(fileField, file)
-	if err != nil {
-		log.Print("[ERROR] failed to copy file content")
-		return nil, "", err
+		line := store.RecipeV1IngredientV1{
+			RecipeV1ID: recipeID,
+			Ingredient: store.IngredientV1{Name: draft.Ingredient},
+			Amount:     draft.Amount,
+		}
+		if unit, ok := catalogue.Lookup(draft.Unit); ok && draft.Unit != "" {
+			line.Unit = &unit
+		}
+		lines = append(lines, line)
 	}
 
-	contentType := writer.FormDataContentType()
-	writer.Close()
-	return body, contentType, nil
+	return lines
 }
 
-func sendPostRequest(url string, body *bytes.Buffer, contenType string) ([]byte, error) {
-	response, err := http.Post(url, contenType, body)
-	if err != nil {
-		log.Printf("[ERROR] failed to send request: %v", err)
-		return nil, err
+// mapSteps maps instructions to steps, they get timers and ingredients when they are saved, it's nil without instructions
+func mapSteps(source []string) []store.RecipeStepV1 {
+	var steps []store.RecipeStepV1
+	for _, text := range source {
+		if text = strings.TrimSpace(text); text != "" {
+			steps = append(steps, store.RecipeStepV1{Text: text})
+		}
 	}
-	defer response.Body.Close()
 
-	if response.StatusCode != http.StatusOK {
-		log.Printf("[ERROR] unexpected status code: %d", response.StatusCode)
-		return nil, fmt.Errorf("unexpected status code: %d", response.StatusCode)
+	return steps
+}
+
+// mapNutrition maps the nutrition found in the recipe, it's nil when nothing is found
+func mapNutrition(recipeID uint, source NutritionJSON) *store.RecipeNutritionV1 {
+	nutrition := store.RecipeNutritionV1{
+		RecipeV1ID: recipeID,
+		Calories:   mapNutritionValue(source.Calories),
+		Carbs:      mapNutritionValue(source.Carbs),
+		Protein:    mapNutritionValue(source.Protein),
+		Fat:        mapNutritionValue(source.Fat),
+		Fibre:      mapNutritionValue(source.Fibre),
+		Sugar:      mapNutritionValue(source.Sugar),
+		Salt:       mapNutritionValue(source.Salt),
 	}
 
-	responseBody, err := io.ReadAll(response.Body)
-	if err != nil {
-		log.Printf("[ERROR] failed to read response body: %v", err)
-		return nil, err
+	if nutrition == (store.RecipeNutritionV1{RecipeV1ID: recipeID}) {
+		return nil
 	}
 
-	return responseBody, nil
+	return &nutrition
 }
 
-func processResponse(responseBody []byte) (*RecipeJSON, error) {
-	var recipeDetails RecipeJSON
-	err := json.Unmarshal(responseBody, &recipeDetails)
-	if err != nil {
-		log.Print("[ERROR] failed to unmarshal JSON")
-		return nil, err
+func mapNutritionValue(value *float64) sql.NullFloat64 {
+	if value == nil {
+		return sql.NullFloat64{}
 	}
 
-	return &recipeDetails, nil
+	return sql.NullFloat64{Float64: *value, Valid: true}
 }
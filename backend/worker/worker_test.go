@@ -0,0 +1,866 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rjxby/eat-repeat/backend/pantry"
+	"github.com/rjxby/eat-repeat/backend/store"
+)
+
+// fakeEngine keeps jobs and recipes in memory
+type fakeEngine struct {
+	mu      sync.Mutex
+	jobs    map[uint]store.JobV1
+	items   []store.JobItemV1
+	recipes []store.RecipeV1
+	saved   map[uint]store.RecipeV1
+	// nutrition is saved per recipe id
+	nutrition map[uint]store.RecipeNutritionV1
+	// lines and steps are saved per recipe id
+	lines       map[uint][]store.RecipeV1IngredientV1
+	steps       map[uint][]store.RecipeStepV1
+	ingredients []store.IngredientV1
+	// replaceErr fails replacing of ingredient lines
+	replaceErr error
+}
+
+func newFakeEngine(recipes []store.RecipeV1) *fakeEngine {
+	return &fakeEngine{
+		jobs:    make(map[uint]store.JobV1),
+		recipes: recipes,
+		saved:   make(map[uint]store.RecipeV1),
+
+		nutrition: make(map[uint]store.RecipeNutritionV1),
+		lines:     make(map[uint][]store.RecipeV1IngredientV1),
+		steps:     make(map[uint][]store.RecipeStepV1),
+	}
+}
+
+func (e *fakeEngine) SaveSyncJob(job *store.JobV1) (*store.JobV1, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if job.ID == 0 {
+		job.ID = uint(len(e.jobs) + 1)
+	}
+	e.jobs[job.ID] = *job
+
+	return job, nil
+}
+
+func (e *fakeEngine) SaveJobItem(item *store.JobItemV1) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.items = append(e.items, *item)
+	return nil
+}
+
+func (e *fakeEngine) LoadJobs() (*[]store.JobV1, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	jobs := []store.JobV1{}
+	for _, job := range e.jobs {
+		jobs = append(jobs, job)
+	}
+	return &jobs, nil
+}
+
+func (e *fakeEngine) GetJob(id uint) (*store.JobV1, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	job, ok := e.jobs[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &job, nil
+}
+
+func (e *fakeEngine) LoadSyncRecipes() (*[]store.RecipeV1, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	recipes := append([]store.RecipeV1{}, e.recipes...)
+	return &recipes, nil
+}
+
+func (e *fakeEngine) GetRecipe(id uint) (*store.RecipeV1, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, recipe := range e.recipes {
+		if recipe.ID == id {
+			recipe.Ingredients = e.lines[id]
+			return &recipe, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (e *fakeEngine) SaveSyncedRecipe(recipe *store.RecipeV1) (*store.RecipeV1, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.saved[recipe.ID] = *recipe
+	e.replaceRecipe(*recipe)
+	return recipe, nil
+}
+
+func (e *fakeEngine) SaveRecipeNutrition(nutrition *store.RecipeNutritionV1) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.nutrition[nutrition.RecipeV1ID] = *nutrition
+	return nil
+}
+
+func (e *fakeEngine) DeleteRecipeNutrition(recipeID uint) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.nutrition, recipeID)
+	return nil
+}
+
+func (e *fakeEngine) ReplaceRecipeIngredients(recipeID uint, lines []store.RecipeV1IngredientV1) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.replaceErr != nil {
+		return e.replaceErr
+	}
+
+	saved := []store.RecipeV1IngredientV1{}
+	for _, line := range lines {
+		if line.IngredientV1ID == 0 {
+			line.IngredientV1ID = e.ingredientID(line.Ingredient)
+			line.Ingredient.ID = line.IngredientV1ID
+		}
+		saved = append(saved, line)
+	}
+	e.lines[recipeID] = saved
+	return nil
+}
+
+func (e *fakeEngine) ReplaceRecipeSteps(recipeID uint, steps []store.RecipeStepV1) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.steps[recipeID] = steps
+	return nil
+}
+
+// ingredientID finds the ingredient by name or creates it
+func (e *fakeEngine) ingredientID(ingredient store.IngredientV1) uint {
+	for _, existing := range e.ingredients {
+		if existing.Name == ingredient.Name {
+			return existing.ID
+		}
+	}
+
+	ingredient.ID = uint(len(e.ingredients) + 1)
+	e.ingredients = append(e.ingredients, ingredient)
+	return ingredient.ID
+}
+
+func (e *fakeEngine) GetIngredients() (*store.Ingredients, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return &store.Ingredients{Ingredients: append([]store.IngredientV1{}, e.ingredients...)}, nil
+}
+
+func (e *fakeEngine) GetUnits() (*[]store.UnitV1, error) {
+	units := store.DefaultUnits()
+	for i := range units {
+		units[i].ID = uint(i + 1)
+	}
+	return &units, nil
+}
+
+func (e *fakeEngine) RecordRecipeSyncFailure(id uint, syncError string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i := range e.recipes {
+		if e.recipes[i].ID == id {
+			e.recipes[i].SyncFailures++
+			e.recipes[i].SyncError = syncError
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (e *fakeEngine) ResetRecipeSyncFailures(id uint) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i := range e.recipes {
+		if e.recipes[i].ID == id {
+			e.recipes[i].SyncFailures = 0
+			e.recipes[i].SyncError = ""
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (e *fakeEngine) replaceRecipe(recipe store.RecipeV1) {
+	for i := range e.recipes {
+		if e.recipes[i].ID == recipe.ID {
+			e.recipes[i] = recipe
+		}
+	}
+}
+
+func (e *fakeEngine) recipe(id uint) store.RecipeV1 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, recipe := range e.recipes {
+		if recipe.ID == id {
+			return recipe
+		}
+	}
+	return store.RecipeV1{}
+}
+
+// testRecipes makes recipes with pdf files in a temporary directory and a recipe without pdf
+func testRecipes(t *testing.T, withPdf int) []store.RecipeV1 {
+	dir := t.TempDir()
+
+	recipes := []store.RecipeV1{}
+	for i := 1; i <= withPdf; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("recipe %d.pdf", i))
+		if err := os.WriteFile(path, []byte("%PDF-1.4"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		recipes = append(recipes, store.RecipeV1{
+			ID:     uint(i),
+			Title:  fmt.Sprintf("Recipe %d", i),
+			PdfUrl: sql.NullString{String: path, Valid: true},
+		})
+	}
+
+	return append(recipes, store.RecipeV1{ID: uint(withPdf + 1), Title: "Recipe without pdf"})
+}
+
+// blockingReader is a pdf reader which answers only when the request is cancelled
+func blockingReader(inFlight *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		// the server notices the client is gone only after the body is read
+		_, _ = io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitForJob(t *testing.T, engine *fakeEngine, id uint) store.JobV1 {
+	t.Helper()
+
+	var job *store.JobV1
+	waitFor(t, "finished job", func() bool {
+		job, _ = engine.GetJob(id)
+		return job.FinishedAt.Valid
+	})
+
+	return *job
+}
+
+// assertNoLeaks waits until goroutines started after the baseline are finished
+func assertNoLeaks(t *testing.T, worker *WorkerProc, baseline int) {
+	t.Helper()
+
+	worker.extractor.(*pdfReaderClient).client.CloseIdleConnections()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines are running, %d expected:\n%s", runtime.NumGoroutine(), baseline, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunSyncRecipesCompletes(t *testing.T) {
+	reader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"title": "", "sub_title": "with herbs", "description": "extracted", "cook_time": 25,
+			"nutrition_info": {"calories_per_serving": 540, "net_carbs_per_serving": 42.5, "salt_per_serving": 1.2}}`)
+	}))
+	defer reader.Close()
+
+	engine := newFakeEngine(testRecipes(t, 2))
+	worker := New(context.Background(), Settings{PdfReaderEndpoint: reader.URL, TimeoutInSeconds: 10, Concurrency: 2}, engine)
+
+	started, err := worker.RunSyncRecipes(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := waitForJob(t, engine, started.ID)
+
+	if job.Status != store.JobStatusCompleted {
+		t.Errorf("status = %s, want %s", job.Status, store.JobStatusCompleted)
+	}
+	if job.Processed != 2 || job.Failed != 0 || job.Skipped != 1 {
+		t.Errorf("processed/failed/skipped = %d/%d/%d, want 2/0/1", job.Processed, job.Failed, job.Skipped)
+	}
+	if len(engine.items) != 3 {
+		t.Errorf("%d job items, want 3", len(engine.items))
+	}
+
+	saved := engine.saved[1]
+	if saved.Description != "extracted" || saved.SubTitle != "with herbs" || saved.CookingTimeInMinutes != 25 || saved.Title != "Recipe 1" {
+		t.Errorf("saved recipe = %+v", saved)
+	}
+
+	nutrition := engine.nutrition[1]
+	want := store.RecipeNutritionV1{
+		RecipeV1ID: 1,
+		Calories:   sql.NullFloat64{Float64: 540, Valid: true},
+		Carbs:      sql.NullFloat64{Float64: 42.5, Valid: true},
+		Salt:       sql.NullFloat64{Float64: 1.2, Valid: true},
+	}
+	if nutrition != want {
+		t.Errorf("saved nutrition = %+v, want %+v", nutrition, want)
+	}
+}
+
+func TestCancelJobStopsRequests(t *testing.T) {
+	var inFlight atomic.Int32
+	reader := httptest.NewServer(blockingReader(&inFlight))
+
+	baseline := runtime.NumGoroutine()
+
+	engine := newFakeEngine(testRecipes(t, 3))
+	worker := New(context.Background(), Settings{PdfReaderEndpoint: reader.URL, TimeoutInSeconds: 60, Concurrency: 3}, engine)
+
+	started, err := worker.RunSyncRecipes(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "requests to the pdf reader", func() bool { return inFlight.Load() == 3 })
+
+	job, err := worker.CancelJob(started.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != store.JobStatusCancelled {
+		t.Errorf("status = %s, want %s", job.Status, store.JobStatusCancelled)
+	}
+	if !job.FinishedAt.Valid {
+		t.Error("cancelled job is not finished")
+	}
+	if recipe := engine.recipe(1); recipe.SyncFailures != 0 {
+		t.Errorf("sync failures of cancelled recipe = %d, want 0", recipe.SyncFailures)
+	}
+
+	if _, err := worker.CancelJob(started.ID); !errors.Is(err, ErrJobNotRunning) {
+		t.Errorf("cancel of cancelled job error = %v, want %v", err, ErrJobNotRunning)
+	}
+	if _, err := worker.CancelJob(100); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("cancel of unknown job error = %v, want %v", err, store.ErrNotFound)
+	}
+
+	reader.Close()
+	assertNoLeaks(t, worker, baseline)
+}
+
+func TestPoolLimitsRequestsInFlight(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	reader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		for {
+			max := maxInFlight.Load()
+			if current <= max || maxInFlight.CompareAndSwap(max, current) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, `{"description": "extracted"}`)
+	}))
+	defer reader.Close()
+
+	engine := newFakeEngine(testRecipes(t, 6))
+	worker := New(context.Background(), Settings{PdfReaderEndpoint: reader.URL, TimeoutInSeconds: 10, Concurrency: 2}, engine)
+
+	started, err := worker.RunSyncRecipes(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := waitForJob(t, engine, started.ID)
+
+	if job.Status != store.JobStatusCompleted || job.Processed != 6 {
+		t.Errorf("status = %s, processed = %d, want %s, 6", job.Status, job.Processed, store.JobStatusCompleted)
+	}
+	if max := maxInFlight.Load(); max > 2 {
+		t.Errorf("%d requests in flight, want at most 2", max)
+	}
+}
+
+func TestCancelJobWhileRateLimited(t *testing.T) {
+	var inFlight atomic.Int32
+	reader := httptest.NewServer(blockingReader(&inFlight))
+
+	baseline := runtime.NumGoroutine()
+
+	engine := newFakeEngine(testRecipes(t, 3))
+	worker := New(context.Background(), Settings{PdfReaderEndpoint: reader.URL, TimeoutInSeconds: 60, Concurrency: 3, RateLimitPerSecond: 0.001}, engine)
+
+	started, err := worker.RunSyncRecipes(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the first request to the pdf reader", func() bool { return inFlight.Load() == 1 })
+
+	job, err := worker.CancelJob(started.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != store.JobStatusCancelled {
+		t.Errorf("status = %s, want %s", job.Status, store.JobStatusCancelled)
+	}
+
+	reader.Close()
+	assertNoLeaks(t, worker, baseline)
+}
+
+func TestJobTimeoutStopsRequests(t *testing.T) {
+	var inFlight atomic.Int32
+	reader := httptest.NewServer(blockingReader(&inFlight))
+
+	baseline := runtime.NumGoroutine()
+
+	engine := newFakeEngine(testRecipes(t, 2))
+	worker := New(context.Background(), Settings{PdfReaderEndpoint: reader.URL, TimeoutInSeconds: 1, Concurrency: 2}, engine)
+
+	started, err := worker.RunSyncRecipes(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := waitForJob(t, engine, started.ID)
+
+	if job.Status != store.JobStatusFailed {
+		t.Errorf("status = %s, want %s", job.Status, store.JobStatusFailed)
+	}
+
+	reader.Close()
+	assertNoLeaks(t, worker, baseline)
+}
+
+func TestReaderRetriesFailedRequests(t *testing.T) {
+	var requests atomic.Int32
+	reader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			fmt.Fprint(w, `{"description": "extracted"}`)
+		}
+	}))
+	defer reader.Close()
+
+	engine := newFakeEngine(testRecipes(t, 1))
+	worker := New(context.Background(), Settings{PdfReaderEndpoint: reader.URL, TimeoutInSeconds: 10, Concurrency: 1, MaxRetries: 3}, engine)
+	worker.extractor.(*pdfReaderClient).retryDelay = time.Millisecond
+
+	started, err := worker.RunSyncRecipes(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := waitForJob(t, engine, started.ID)
+
+	if job.Processed != 1 || job.Failed != 0 {
+		t.Errorf("processed/failed = %d/%d, want 1/0", job.Processed, job.Failed)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("%d requests, want 3", got)
+	}
+}
+
+func TestReaderDoesNotRetryClientErrors(t *testing.T) {
+	var requests atomic.Int32
+	reader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer reader.Close()
+
+	engine := newFakeEngine(testRecipes(t, 1))
+	worker := New(context.Background(), Settings{PdfReaderEndpoint: reader.URL, TimeoutInSeconds: 10, Concurrency: 1, MaxRetries: 3}, engine)
+	worker.extractor.(*pdfReaderClient).retryDelay = time.Millisecond
+
+	started, err := worker.RunSyncRecipes(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := waitForJob(t, engine, started.ID)
+
+	if job.Failed != 1 {
+		t.Errorf("failed = %d, want 1", job.Failed)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("%d requests, want 1", got)
+	}
+}
+
+func TestFailingRecipeIsSkippedUntilReset(t *testing.T) {
+	var requests atomic.Int32
+	reader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer reader.Close()
+
+	engine := newFakeEngine(testRecipes(t, 1))
+	worker := New(context.Background(), Settings{PdfReaderEndpoint: reader.URL, TimeoutInSeconds: 10, Concurrency: 1, MaxRetries: 1, MaxFailures: 2}, engine)
+	worker.extractor.(*pdfReaderClient).retryDelay = time.Millisecond
+
+	sync := func() store.JobV1 {
+		t.Helper()
+
+		started, err := worker.RunSyncRecipes(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return waitForJob(t, engine, started.ID)
+	}
+
+	for i := 1; i <= 2; i++ {
+		if job := sync(); job.Failed != 1 {
+			t.Fatalf("sync %d failed = %d, want 1", i, job.Failed)
+		}
+	}
+	if recipe := engine.recipe(1); recipe.SyncFailures != 2 || recipe.SyncError == "" {
+		t.Errorf("sync failures = %d, error = %q, want 2 and the error", recipe.SyncFailures, recipe.SyncError)
+	}
+
+	if job := sync(); job.Skipped != 2 || job.Failed != 0 {
+		t.Errorf("skipped/failed = %d/%d, want 2/0", job.Skipped, job.Failed)
+	}
+	if got := requests.Load(); got != 4 {
+		t.Errorf("%d requests, want 4", got)
+	}
+
+	if err := worker.ResetRecipeSyncFailures(1); err != nil {
+		t.Fatal(err)
+	}
+	if job := sync(); job.Failed != 1 {
+		t.Errorf("failed after reset = %d, want 1", job.Failed)
+	}
+	if job := sync(); job.Failed != 1 {
+		t.Fatalf("failed of the second sync after reset = %d, want 1", job.Failed)
+	}
+
+	// the single recipe sync reads the recipe failed too many times and resets its failures
+	started, err := worker.RunSyncRecipe(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job := waitForJob(t, engine, started.ID); job.Failed != 1 || job.Skipped != 0 {
+		t.Errorf("single sync failed/skipped = %d/%d, want 1/0", job.Failed, job.Skipped)
+	}
+	if recipe := engine.recipe(1); recipe.SyncFailures != 1 {
+		t.Errorf("sync failures after single sync = %d, want 1", recipe.SyncFailures)
+	}
+	if got := requests.Load(); got != 10 {
+		t.Errorf("%d requests, want 10", got)
+	}
+}
+
+func TestSyncSkipsUnchangedPdf(t *testing.T) {
+	var requests atomic.Int32
+	reader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, `{"description": "extracted"}`)
+	}))
+	defer reader.Close()
+
+	recipes := testRecipes(t, 2)
+	engine := newFakeEngine(recipes)
+	worker := New(context.Background(), Settings{PdfReaderEndpoint: reader.URL, TimeoutInSeconds: 10, Concurrency: 2}, engine)
+
+	sync := func(run func() (*store.JobV1, error)) store.JobV1 {
+		t.Helper()
+
+		started, err := run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return waitForJob(t, engine, started.ID)
+	}
+	syncAll := func(force bool) func() (*store.JobV1, error) {
+		return func() (*store.JobV1, error) { return worker.RunSyncRecipes(force) }
+	}
+
+	if job := sync(syncAll(false)); job.Processed != 2 {
+		t.Fatalf("first sync processed = %d, want 2", job.Processed)
+	}
+	if recipe := engine.recipe(1); recipe.PdfHash == "" || !recipe.PdfModifiedAt.Valid {
+		t.Errorf("pdf state is not saved: %+v", recipe)
+	}
+
+	if job := sync(syncAll(false)); job.Processed != 0 || job.Skipped != 3 {
+		t.Errorf("unchanged sync processed/skipped = %d/%d, want 0/3", job.Processed, job.Skipped)
+	}
+
+	// the same content with a new modification time is still unchanged
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(recipes[0].PdfUrl.String, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if job := sync(syncAll(false)); job.Processed != 0 {
+		t.Errorf("touched sync processed = %d, want 0", job.Processed)
+	}
+
+	if err := os.WriteFile(recipes[1].PdfUrl.String, []byte("%PDF-1.5"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if job := sync(syncAll(false)); job.Processed != 1 {
+		t.Errorf("changed sync processed = %d, want 1", job.Processed)
+	}
+
+	if job := sync(syncAll(true)); job.Processed != 2 {
+		t.Errorf("forced sync processed = %d, want 2", job.Processed)
+	}
+
+	job := sync(func() (*store.JobV1, error) { return worker.RunSyncRecipe(1) })
+	if job.Processed != 1 || job.Skipped != 0 {
+		t.Errorf("single sync processed/skipped = %d/%d, want 1/0", job.Processed, job.Skipped)
+	}
+
+	if got := requests.Load(); got != 6 {
+		t.Errorf("%d requests, want 6", got)
+	}
+
+	if _, err := worker.RunSyncRecipe(100); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("sync of unknown recipe error = %v, want %v", err, store.ErrNotFound)
+	}
+}
+
+func TestSyncReplacesRecipeIngredientsAndSteps(t *testing.T) {
+	reader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"title": "Pancakes", "ingredients": ["200 g Flour", "0.5 kg flour", "2 eggs", "1 cup milk", "1 cup flour", "200 g", "2 tomatoes", "6 lemons"],
+			"instructions": ["Sift the flour.", "Fry the eggs for 2 minutes."]}`)
+	}))
+	defer reader.Close()
+
+	engine := newFakeEngine(testRecipes(t, 1))
+	units, _ := engine.GetUnits()
+	catalogue := pantry.NewCatalogue(*units)
+	g, _ := catalogue.Lookup("g")
+	dozen, _ := catalogue.Lookup("dozen")
+	engine.ingredients = []store.IngredientV1{{ID: 1, Name: "flour", UnitID: g.ID, Unit: g}, {ID: 2, Name: "tomatoes", UnitID: g.ID, Unit: g},
+		{ID: 3, Name: "lemons", UnitID: dozen.ID, Unit: dozen}}
+
+	worker := New(context.Background(), Settings{PdfReaderEndpoint: reader.URL, TimeoutInSeconds: 10, Concurrency: 1}, engine)
+
+	started, err := worker.RunSyncRecipe(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job := waitForJob(t, engine, started.ID); job.Processed != 1 {
+		t.Fatalf("processed = %d, want 1", job.Processed)
+	}
+
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	// the flour in cups and the tomatoes counted can't convert to grams, the line without name is dropped,
+	// lines without unit of ingredients kept in another unit count pieces
+	lines := engine.lines[1]
+	if len(lines) != 5 {
+		t.Fatalf("lines = %+v, want 5 lines", lines)
+	}
+
+	tests := []struct {
+		ingredient string
+		amount     float64
+		unit       string
+		unitless   bool
+	}{
+		{ingredient: "flour", amount: 200, unitless: true},
+		{ingredient: "flour", amount: 0.5, unit: "kg"},
+		{ingredient: "eggs", amount: 2, unitless: true},
+		{ingredient: "milk", amount: 1, unitless: true},
+		{ingredient: "lemons", amount: 6, unit: "pcs"},
+	}
+	for i, tt := range tests {
+		line := lines[i]
+		if line.Ingredient.Name != tt.ingredient || line.Amount != tt.amount {
+			t.Errorf("line %d = %s %v, want %s %v", i, line.Ingredient.Name, line.Amount, tt.ingredient, tt.amount)
+		}
+		if tt.unitless && line.Unit != nil {
+			t.Errorf("line %d unit = %s, want the ingredient unit", i, line.Unit.Name)
+		}
+		if !tt.unitless && (line.Unit == nil || line.Unit.Name != tt.unit || line.UnitID == nil) {
+			t.Errorf("line %d unit = %+v, want %s", i, line.Unit, tt.unit)
+		}
+	}
+
+	if lines[0].IngredientV1ID != 1 || lines[1].IngredientV1ID != 1 {
+		t.Errorf("flour lines are not matched to the existing ingredient: %d, %d", lines[0].IngredientV1ID, lines[1].IngredientV1ID)
+	}
+
+	// new ingredients are measured in the unit of their line, lines without unit count pieces
+	wantUnits := map[string]string{"flour": "g", "tomatoes": "g", "lemons": "dozen", "eggs": "pcs", "milk": "cup"}
+	for _, ingredient := range engine.ingredients {
+		if ingredient.Unit.Name != wantUnits[ingredient.Name] || ingredient.UnitID == 0 {
+			t.Errorf("ingredient %s unit = %s (%d), want %s", ingredient.Name, ingredient.Unit.Name, ingredient.UnitID, wantUnits[ingredient.Name])
+		}
+	}
+
+	// steps are linked to the ingredients they mention
+	steps := engine.steps[1]
+	if len(steps) != 2 {
+		t.Fatalf("steps = %+v, want 2 steps", steps)
+	}
+	if steps[0].Text != "Sift the flour." || steps[0].TimerInSeconds.Valid || len(steps[0].Ingredients) != 1 || steps[0].Ingredients[0].IngredientV1ID != 1 {
+		t.Errorf("step 1 = %+v", steps[0])
+	}
+	if steps[1].TimerInSeconds.Int64 != 120 || len(steps[1].Ingredients) != 1 || steps[1].Ingredients[0].Ingredient.Name != "eggs" {
+		t.Errorf("step 2 = %+v", steps[1])
+	}
+}
+
+func TestFailedSyncIsRetried(t *testing.T) {
+	var requests atomic.Int32
+	reader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, `{"description": "extracted", "ingredients": ["200 g flour"]}`)
+	}))
+	defer reader.Close()
+
+	engine := newFakeEngine(testRecipes(t, 1))
+	engine.replaceErr = errors.New("database is locked")
+	worker := New(context.Background(), Settings{PdfReaderEndpoint: reader.URL, TimeoutInSeconds: 10, Concurrency: 1, MaxFailures: 3}, engine)
+
+	sync := func() store.JobV1 {
+		t.Helper()
+
+		started, err := worker.RunSyncRecipes(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return waitForJob(t, engine, started.ID)
+	}
+
+	if job := sync(); job.Failed != 1 {
+		t.Fatalf("failed = %d, want 1", job.Failed)
+	}
+	if recipe := engine.recipe(1); recipe.PdfHash != "" || recipe.Description != "" || recipe.SyncFailures != 1 {
+		t.Errorf("recipe of failed sync = %+v, want no pdf hash and description and a failure", recipe)
+	}
+
+	engine.mu.Lock()
+	engine.replaceErr = nil
+	engine.mu.Unlock()
+
+	if job := sync(); job.Processed != 1 || job.Failed != 0 {
+		t.Errorf("processed/failed of the next sync = %d/%d, want 1/0", job.Processed, job.Failed)
+	}
+	if recipe := engine.recipe(1); recipe.PdfHash == "" || recipe.Description != "extracted" || recipe.SyncFailures != 0 {
+		t.Errorf("recipe of the next sync = %+v, want the pdf hash and description saved", recipe)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("%d requests, want 2", got)
+	}
+}
+
+func TestSyncDeletesStaleNutrition(t *testing.T) {
+	var requests atomic.Int32
+	reader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			fmt.Fprint(w, `{"description": "extracted", "nutrition_info": {"calories_per_serving": 540}}`)
+			return
+		}
+		fmt.Fprint(w, `{"description": "extracted again"}`)
+	}))
+	defer reader.Close()
+
+	engine := newFakeEngine(testRecipes(t, 1))
+	worker := New(context.Background(), Settings{PdfReaderEndpoint: reader.URL, TimeoutInSeconds: 10, Concurrency: 1}, engine)
+
+	for i := 1; i <= 2; i++ {
+		started, err := worker.RunSyncRecipe(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job := waitForJob(t, engine, started.ID); job.Processed != 1 {
+			t.Fatalf("sync %d processed = %d, want 1", i, job.Processed)
+		}
+
+		engine.mu.Lock()
+		_, ok := engine.nutrition[1]
+		engine.mu.Unlock()
+		if want := i == 1; ok != want {
+			t.Errorf("sync %d saved nutrition = %t, want %t", i, ok, want)
+		}
+	}
+}
+
+func TestRateInterval(t *testing.T) {
+	tests := []struct {
+		rate float64
+		want time.Duration
+	}{
+		{rate: 2, want: 500 * time.Millisecond},
+		{rate: 0.5, want: 2 * time.Second},
+		{rate: 1e12, want: time.Nanosecond},
+		{rate: math.Inf(1), want: time.Nanosecond},
+		{rate: math.NaN(), want: time.Nanosecond},
+		{rate: 1e-300, want: time.Duration(math.MaxInt64)},
+	}
+
+	for _, tt := range tests {
+		if got := rateInterval(tt.rate); got != tt.want {
+			t.Errorf("rateInterval(%v) = %v, want %v", tt.rate, got, tt.want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"strconv"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/rjxby/eat-repeat/backend/pantry"
 	"github.com/rjxby/eat-repeat/backend/scheduler"
 	"github.com/rjxby/eat-repeat/backend/server"
+	"github.com/rjxby/eat-repeat/backend/shopper"
 	"github.com/rjxby/eat-repeat/backend/store"
 	"github.com/rjxby/eat-repeat/backend/worker"
 )
@@ -34,17 +36,32 @@ func main() {
 		os.Exit(1)
 	}
 
+	ctx := context.Background()
+
+	workerSettings := worker.Settings{
+		Extractor:          appSettings.PdfExtractor,
+		PdfReaderEndpoint:  appSettings.PdfReaderEndpoint,
+		TimeoutInSeconds:   appSettings.WorkerTimeoutInSeconds,
+		Concurrency:        appSettings.WorkerConcurrency,
+		RateLimitPerSecond: appSettings.WorkerRateLimitPerSecond,
+
+		RequestTimeoutInSeconds: appSettings.PdfReaderTimeoutInSeconds,
+		MaxRetries:              appSettings.PdfReaderMaxRetries,
+		MaxFailures:             appSettings.SyncMaxFailures,
+	}
+
 	srv := server.Server{
 		Chef:          chef.New(dataStore),
-		Scheduler:     scheduler.New(),
+		Scheduler:     scheduler.New(dataStore),
 		Pantry:        pantry.New(dataStore),
-		Worker:        worker.New(appSettings.PdfReaderEndpoint, appSettings.WorkerTimeoutInSeconds, dataStore),
+		Shopper:       shopper.New(dataStore),
+		Worker:        worker.New(ctx, workerSettings, dataStore),
 		Version:       revision,
 		TemplateCache: templateCache,
 		Settings:      appSettings,
 	}
 
-	if err := srv.Run(context.Background()); err != nil {
+	if err := srv.Run(ctx); err != nil {
 		log.Printf("[ERROR] failed, %+v", err)
 	}
 }
@@ -72,6 +89,11 @@ func parseEnvironment() server.Settings {
 	settings := server.Settings{
 		RunMigration:           false,
 		WorkerTimeoutInSeconds: 900, // 900s = 15 min
+		WorkerConcurrency:      2,
+
+		PdfReaderTimeoutInSeconds: 120,
+		PdfReaderMaxRetries:       3,
+		SyncMaxFailures:           3,
 	}
 
 	runMigrationStr := os.Getenv("RUN_MIGRATION")
@@ -83,11 +105,23 @@ func parseEnvironment() server.Settings {
 		}
 	}
 
-	pdfReaderEndpointStr := os.Getenv("PDF_READER_ENDPOINT")
-	if pdfReaderEndpointStr == "" {
-		log.Fatal("PDF_READER_ENDPOINT environment variable is not set")
-	} else {
-		settings.PdfReaderEndpoint = pdfReaderEndpointStr
+	settings.PdfReaderEndpoint = os.Getenv("PDF_READER_ENDPOINT")
+
+	// recipe pdf files are read locally when there is no pdf reader service
+	settings.PdfExtractor = os.Getenv("PDF_EXTRACTOR")
+	switch settings.PdfExtractor {
+	case "":
+		settings.PdfExtractor = worker.ExtractorLocal
+		if settings.PdfReaderEndpoint != "" {
+			settings.PdfExtractor = worker.ExtractorHTTP
+		}
+	case worker.ExtractorHTTP:
+		if settings.PdfReaderEndpoint == "" {
+			log.Fatal("PDF_READER_ENDPOINT environment variable is not set")
+		}
+	case worker.ExtractorLocal:
+	default:
+		log.Fatalf("PDF_EXTRACTOR environment variable should be %s or %s", worker.ExtractorHTTP, worker.ExtractorLocal)
 	}
 
 	workerTimeoutInSecondsStr := os.Getenv("WORKER_TIMEOUT_IN_SECONDS")
@@ -99,6 +133,59 @@ func parseEnvironment() server.Settings {
 		}
 	}
 
+	workerConcurrencyStr := os.Getenv("WORKER_CONCURRENCY")
+	if workerConcurrencyStr != "" {
+		var err error
+		settings.WorkerConcurrency, err = strconv.Atoi(workerConcurrencyStr)
+		if err != nil {
+			fmt.Println("Error parsing WORKER_CONCURRENCY environment variable:", err)
+		}
+	}
+
+	workerRateLimitPerSecondStr := os.Getenv("WORKER_RATE_LIMIT_PER_SECOND")
+	if workerRateLimitPerSecondStr != "" {
+		var err error
+		settings.WorkerRateLimitPerSecond, err = strconv.ParseFloat(workerRateLimitPerSecondStr, 64)
+		if err != nil {
+			fmt.Println("Error parsing WORKER_RATE_LIMIT_PER_SECOND environment variable:", err)
+		}
+
+		// zero means no limit, a limit must be a finite positive number of requests
+		rate := settings.WorkerRateLimitPerSecond
+		if math.IsNaN(rate) || math.IsInf(rate, 0) || rate < 0 {
+			fmt.Println("Error parsing WORKER_RATE_LIMIT_PER_SECOND environment variable: not a finite positive number:", workerRateLimitPerSecondStr)
+			settings.WorkerRateLimitPerSecond = 0
+		}
+	}
+
+	pdfReaderTimeoutInSecondsStr := os.Getenv("PDF_READER_TIMEOUT_IN_SECONDS")
+	if pdfReaderTimeoutInSecondsStr != "" {
+		var err error
+		settings.PdfReaderTimeoutInSeconds, err = strconv.ParseInt(pdfReaderTimeoutInSecondsStr, 10, 64)
+		if err != nil {
+			fmt.Println("Error parsing PDF_READER_TIMEOUT_IN_SECONDS environment variable:", err)
+		}
+	}
+
+	pdfReaderMaxRetriesStr := os.Getenv("PDF_READER_MAX_RETRIES")
+	if pdfReaderMaxRetriesStr != "" {
+		var err error
+		settings.PdfReaderMaxRetries, err = strconv.Atoi(pdfReaderMaxRetriesStr)
+		if err != nil {
+			fmt.Println("Error parsing PDF_READER_MAX_RETRIES environment variable:", err)
+		}
+	}
+
+	syncMaxFailuresStr := os.Getenv("SYNC_MAX_FAILURES")
+	if syncMaxFailuresStr != "" {
+		maxFailures, err := strconv.ParseUint(syncMaxFailuresStr, 10, 32)
+		if err != nil {
+			fmt.Println("Error parsing SYNC_MAX_FAILURES environment variable:", err)
+		} else {
+			settings.SyncMaxFailures = uint(maxFailures)
+		}
+	}
+
 	staticContentEndpointStr := os.Getenv("STATIC_CONTENT_ENDPOINT")
 	if staticContentEndpointStr == "" {
 		log.Fatal("STATIC_CONTENT_ENDPOINT environment variable is not set")